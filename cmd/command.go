@@ -0,0 +1,485 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	adminv1 "transmission-proxy/api/proxy/v1"
+	"transmission-proxy/conf"
+	"transmission-proxy/internal/data"
+	"transmission-proxy/internal/domain"
+	"transmission-proxy/internal/service"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/go-kratos/kratos/v2/transport/http"
+	"github.com/hekmon/cunits/v2"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// commandUsage 子命令说明
+const commandUsage = `Usage: %s [-conf dir] [command]
+
+不指定命令时启动代理服务
+
+Commands:
+  ban <ip>...        封禁ip，-ttl 指定封禁时长，-reason 指定封禁原因
+  unban <ip>...      解禁ip
+  bans list          列出封禁的ip，-q 按ip、网段或封禁原因搜索
+  bans clear         清空封禁列表
+  trackers show      显示 Tracker 池与订阅列表状态
+  trackers refresh   立即更新 Tracker 列表并添加到所有种子
+  stats show         显示上传下载统计
+  stats history      显示历史流量统计，-resolution 指定统计精度
+  stats save         立即保存统计数据
+  stats reset        清零上传下载总量
+  config init        从模板创建配置文件
+  doctor             检查 nftables 权限、tr 连接以及 tr 能否访问 root_url
+
+封禁与统计命令默认请求正在运行的代理的管理接口，使用 -addr 指定代理地址，
+使用 -token 指定访问令牌，默认使用配置文件中的 trigger.admin.token
+封禁命令使用 -local 时直接修改代理创建的 nftables 封禁表，代理正在运行时不能使用
+`
+
+// runCommand 执行子命令
+func runCommand(args []string) error {
+	// 读取配置等依赖使用全局日志，子命令只输出错误
+	log.SetLogger(commandLogger())
+
+	name, args := args[0], args[1:]
+	switch name {
+	case "ban", "unban":
+		return runBanCommand(name, args)
+	case "bans":
+		return runBansCommand(args)
+	case "trackers":
+		return runTrackersCommand(args)
+	case "stats":
+		return runStatsCommand(args)
+	case "config":
+		return runConfigCommand(args)
+	case "doctor":
+		return runDoctor(args)
+	case "help":
+		flag.Usage()
+		return nil
+	default:
+		return fmt.Errorf("未知的命令: %s", name)
+	}
+}
+
+// commandFlags 子命令的参数
+type commandFlags struct {
+	*flag.FlagSet
+	addr  *string
+	token *string
+	local *bool
+}
+
+func newCommandFlags(name string, local bool) *commandFlags {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	f := &commandFlags{
+		FlagSet: fs,
+		addr:    fs.String("addr", "", "proxy address, default is derived from trigger.http in the config file"),
+		token:   fs.String("token", "", "admin API token, default is trigger.admin.token in the config file"),
+	}
+	if local {
+		f.local = fs.Bool("local", false, "modify the nftables ban sets directly instead of calling the running proxy")
+	}
+	return f
+}
+
+// client 创建请求正在运行的代理的管理接口客户端
+func (f *commandFlags) client(ctx context.Context) (adminv1.AdminHTTPClient, func(), error) {
+	addr, token := *f.addr, *f.token
+	if addr == "" || token == "" {
+		bootstrap, cleanup, err := loadCommandConf()
+		switch {
+		case err == nil:
+			cleanup()
+		case addr == "":
+			return nil, nil, err
+		}
+		// 指定了代理地址时配置文件可以不存在
+		if addr == "" {
+			addr, err = proxyAddr(bootstrap)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		if token == "" {
+			token = bootstrap.GetTrigger().GetAdmin().GetToken()
+		}
+	}
+	conn, err := http.NewClient(ctx,
+		http.WithEndpoint(strings.TrimSuffix(addr, "/")),
+		http.WithTimeout(5*time.Minute),
+		http.WithMiddleware(commandError(), commandAuth(token)),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	return adminv1.NewAdminHTTPClient(conn), func() { _ = conn.Close() }, nil
+}
+
+// commandError 无法访问代理时提示代理是否正在运行
+func commandError() middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			reply, err := handler(ctx, req)
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				return nil, fmt.Errorf("无法访问代理，代理是否正在运行: %w", err)
+			}
+			return reply, err
+		}
+	}
+}
+
+// commandAuth 设置管理接口的访问令牌，没有令牌时代理只允许本机访问
+func commandAuth(token string) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if tr, ok := transport.FromClientContext(ctx); ok && token != "" {
+				tr.RequestHeader().Set("Authorization", "Bearer "+token)
+			}
+			return handler(ctx, req)
+		}
+	}
+}
+
+// loadCommandConf 读取配置文件，配置文件不存在时不从模板创建
+func loadCommandConf() (*conf.Bootstrap, func(), error) {
+	path := filepath.Join(conf.FlagConf, conf.ConfigFileName)
+	if _, err := os.Stat(path); err != nil {
+		return nil, nil, fmt.Errorf("%w，可以使用 config init 创建配置文件", err)
+	}
+	bootstrap, _, cleanup, err := conf.LoadConf(conf.FlagConf)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bootstrap, cleanup, nil
+}
+
+// proxyAddr 根据配置文件中的监听地址生成本机访问代理的地址
+func proxyAddr(bootstrap *conf.Bootstrap) (string, error) {
+	config := bootstrap.GetTrigger().GetHttp()
+	host := config.GetHost()
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	// 没有设置端口时代理监听随机端口
+	if config.GetPort() == 0 {
+		return "", errors.New("配置文件中没有设置 trigger.http.port，请使用 -addr 指定代理地址")
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(int(config.GetPort()))), nil
+}
+
+// commandLogger 子命令只输出错误日志
+func commandLogger() log.Logger {
+	return log.NewFilter(log.NewStdLogger(os.Stderr), log.FilterLevel(log.LevelError))
+}
+
+func runBanCommand(name string, args []string) error {
+	f := newCommandFlags(name, true)
+	ttl := new(time.Duration)
+	reason := new(string)
+	if name == "ban" {
+		ttl = f.Duration("ttl", 0, "ban duration, 0 means permanent")
+		reason = f.String("reason", "", "ban reason")
+	}
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+	ips := f.Args()
+	if len(ips) == 0 {
+		return fmt.Errorf("用法: %s [-local] <ip>...", name)
+	}
+	for _, ip := range ips {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("无效的ip: %s", ip)
+		}
+	}
+
+	ctx := context.Background()
+	if *f.local {
+		// 封禁原因与到期时间保存在代理进程中，nftables 封禁表中只有ip
+		if *ttl != 0 || *reason != "" {
+			return errors.New("-local 不支持 -ttl 与 -reason")
+		}
+		uc, err := f.localAppUsecase(ctx)
+		if err != nil {
+			return err
+		}
+		if name == "ban" {
+			return uc.BanIP(ctx, ips)
+		}
+		return uc.UnbanIP(ctx, ips)
+	}
+	c, cleanup, err := f.client(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if name == "ban" {
+		_, err = c.Ban(ctx, &adminv1.BanRequest{Ips: ips, Reason: *reason, Ttl: int64(ttl.Seconds())})
+	} else {
+		_, err = c.Unban(ctx, &adminv1.UnbanRequest{Ips: ips})
+	}
+	return err
+}
+
+// localAppUsecase 直接修改 nftables 封禁表的用例
+// 代理在内存中保存封禁列表，直接修改 nftables 封禁表后两者不一致，代理正在运行时返回错误
+func (f *commandFlags) localAppUsecase(ctx context.Context) (*domain.AppUsecase, error) {
+	if f.proxyRunning(ctx) {
+		return nil, errors.New("代理正在运行，请不使用 -local 通过代理的管理接口修改封禁列表")
+	}
+	logger := commandLogger()
+	banIPRepo, err := data.NewLocalBanIPDao(logger)
+	if err != nil {
+		return nil, err
+	}
+	return domain.NewAppUsecase(nil, nil, banIPRepo, domain.NewQueueLock(), logger), nil
+}
+
+// proxyRunning 判断能否访问正在运行的代理，收到任何响应都说明代理正在运行
+// 无法确定代理地址时认为代理没有运行
+func (f *commandFlags) proxyRunning(ctx context.Context) bool {
+	c, cleanup, err := f.client(ctx)
+	if err != nil {
+		return false
+	}
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err = c.ListBans(ctx, &adminv1.ListBansRequest{PageSize: 1})
+	var urlErr *url.Error
+	return !errors.As(err, &urlErr)
+}
+
+func runBansCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("用法: bans list|clear [-local]")
+	}
+	sub, args := args[0], args[1:]
+	f := newCommandFlags("bans "+sub, true)
+	query := f.String("q", "", "search by ip, CIDR or reason")
+	page := f.Int("page", 1, "page number")
+	pageSize := f.Int("size", 100, "page size")
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	reply := &adminv1.ListBansReply{}
+	if *f.local {
+		uc, err := f.localAppUsecase(ctx)
+		if err != nil {
+			return err
+		}
+		switch sub {
+		case "list":
+		case "clear":
+			if err := uc.ClearBanList(ctx); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("未知的命令: bans %s", sub)
+		}
+		// 直接读取 nftables 封禁表时不分页
+		bannedIPs, err := uc.SearchBannedIPs(ctx, *query)
+		if err != nil {
+			return err
+		}
+		for _, bannedIP := range bannedIPs {
+			reply.Bans = append(reply.Bans, &adminv1.BannedIP{Ip: bannedIP.IP})
+		}
+		reply.Total = int32(len(bannedIPs))
+	} else {
+		c, cleanup, err := f.client(ctx)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		switch sub {
+		case "list":
+			reply, err = c.ListBans(ctx, &adminv1.ListBansRequest{
+				Query:    *query,
+				Page:     int32(*page),
+				PageSize: int32(*pageSize),
+			})
+		case "clear":
+			reply, err = c.ClearBans(ctx, &emptypb.Empty{})
+		default:
+			return fmt.Errorf("未知的命令: bans %s", sub)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	unixTime := func(t int64) string {
+		if t == 0 {
+			return "-"
+		}
+		return time.Unix(t, 0).Format(time.DateTime)
+	}
+	for _, ban := range reply.GetBans() {
+		if ban.GetSource() == "" {
+			fmt.Println(ban.GetIp())
+			continue
+		}
+		fmt.Printf("%-40s %-19s %-5s 到期: %-19s %s\n", ban.GetIp(), unixTime(ban.GetBannedAt()),
+			ban.GetSource(), unixTime(ban.GetExpiresAt()), ban.GetReason())
+	}
+	if len(reply.GetBans()) < int(reply.GetTotal()) {
+		fmt.Printf("共 %d 个ip，第 %d 页，每页 %d 个\n", reply.GetTotal(), reply.GetPage(), reply.GetPageSize())
+	} else {
+		fmt.Printf("共 %d 个ip\n", reply.GetTotal())
+	}
+	return nil
+}
+
+func runTrackersCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("用法: trackers show|refresh")
+	}
+	sub, args := args[0], args[1:]
+	f := newCommandFlags("trackers "+sub, false)
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	c, cleanup, err := f.client(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	switch sub {
+	case "show":
+	case "refresh":
+		if _, err := c.RunTask(ctx, &adminv1.RunTaskRequest{Name: service.TaskTrackerRefresh}); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("未知的命令: trackers %s", sub)
+	}
+	reply, err := c.GetTrackers(ctx, &emptypb.Empty{})
+	if err != nil {
+		return err
+	}
+
+	for _, tracker := range reply.GetTrackers() {
+		fmt.Printf("%-12s %s\n", tracker.GetSource(), tracker.GetUrl())
+	}
+	fmt.Printf("共 %d 个 Tracker，上限 %d 个\n", len(reply.GetTrackers()), reply.GetMaxSize())
+
+	subscription := reply.GetSubscription()
+	if subscription.GetUrl() == "" {
+		fmt.Println("没有配置订阅列表")
+		return nil
+	}
+	updatedAt := "从未"
+	if subscription.GetUpdatedAt() != 0 {
+		updatedAt = time.Unix(subscription.GetUpdatedAt(), 0).Format(time.DateTime)
+	}
+	fmt.Printf("订阅列表: %s，%d 个 Tracker，更新时间: %s\n", subscription.GetUrl(),
+		subscription.GetTrackerCount(), updatedAt)
+	if subscription.GetError() != "" {
+		fmt.Printf("上次更新失败: %s\n", subscription.GetError())
+	}
+	return nil
+}
+
+func runStatsCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("用法: stats show|history|save|reset")
+	}
+	sub, args := args[0], args[1:]
+	f := newCommandFlags("stats "+sub, false)
+	resolution := f.String("resolution", "day", "resolution of stats history: hour, day or month")
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	c, cleanup, err := f.client(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	size := func(n int64) string {
+		return cunits.ImportInByte(float64(n)).GetHumanSizeRepresentation()
+	}
+
+	var reply *adminv1.StatsReply
+	switch sub {
+	case "show":
+		reply, err = c.GetStats(ctx, &emptypb.Empty{})
+	case "reset":
+		reply, err = c.ResetStats(ctx, &emptypb.Empty{})
+	case "save":
+		task, err := c.RunTask(ctx, &adminv1.RunTaskRequest{Name: service.TaskStatsSave})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("已保存统计数据，耗时 %dms\n", task.GetElapsedMs())
+		return nil
+	case "history":
+		history, err := c.GetStatsHistory(ctx, &adminv1.GetStatsHistoryRequest{Resolution: *resolution})
+		if err != nil {
+			return err
+		}
+		for _, point := range history.GetPoints() {
+			fmt.Printf("%s  下载: %-12s 上传: %s\n", time.Unix(point.GetTime(), 0).Format(time.DateTime),
+				size(point.GetDownloaded()), size(point.GetUploaded()))
+		}
+		return nil
+	default:
+		return fmt.Errorf("未知的命令: stats %s", sub)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("所有时间下载: %s\n", size(reply.GetTotalDownloaded()+reply.GetTotalDownloadedSession()))
+	fmt.Printf("所有时间上传: %s\n", size(reply.GetTotalUploaded()+reply.GetTotalUploadedSession()))
+	fmt.Printf("本次会话下载: %s\n", size(reply.GetTotalDownloadedSession()))
+	fmt.Printf("本次会话上传: %s\n", size(reply.GetTotalUploadedSession()))
+	fmt.Printf("下载速度: %s/s\n", size(reply.GetDownloadSpeed()))
+	fmt.Printf("上传速度: %s/s\n", size(reply.GetUploadSpeed()))
+	return nil
+}
+
+func runConfigCommand(args []string) error {
+	if len(args) == 0 || args[0] != "init" {
+		return errors.New("用法: config init [-force]")
+	}
+	fs := flag.NewFlagSet("config init", flag.ContinueOnError)
+	force := fs.Bool("force", false, "overwrite the existing config file")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	path := filepath.Join(conf.FlagConf, conf.ConfigFileName)
+	if _, err := os.Stat(path); err == nil && !*force {
+		return fmt.Errorf("配置文件 %s 已存在，使用 -force 覆盖", path)
+	}
+	if err := conf.CopyFS(conf.TemplateFS, conf.TemplateName, path); err != nil {
+		return err
+	}
+	fmt.Printf("已创建配置文件 %s\n", path)
+	return nil
+}
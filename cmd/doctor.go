@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	nethttp "net/http"
+	"net/url"
+	"time"
+
+	"transmission-proxy/internal/data"
+
+	"github.com/google/uuid"
+)
+
+// doctor 逐项检查运行环境并输出结果
+type doctor struct {
+	failed int
+}
+
+func (d *doctor) ok(name string, format string, args ...any) {
+	fmt.Printf("[ OK ] %s: %s\n", name, fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) warn(name string, format string, args ...any) {
+	fmt.Printf("[WARN] %s: %s\n", name, fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) fail(name string, format string, args ...any) {
+	d.failed = d.failed + 1
+	fmt.Printf("[FAIL] %s: %s\n", name, fmt.Sprintf(format, args...))
+}
+
+// runDoctor 检查 nftables 权限、tr 连接以及 tr 能否访问 root_url
+func runDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout of each check")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	d := &doctor{}
+
+	bootstrap, cleanup, err := loadCommandConf()
+	if err != nil {
+		d.fail("配置文件", "%v", err)
+		return fmt.Errorf("%d 项检查失败", d.failed)
+	}
+	defer cleanup()
+	d.ok("配置文件", "有效")
+
+	if err := data.CheckNFTables(); err != nil {
+		d.fail("nftables", "%v，代理需要 CAP_NET_ADMIN 权限", err)
+	} else {
+		d.ok("nftables", "有权限修改")
+	}
+
+	// 正在运行的代理
+	if addr, err := proxyAddr(bootstrap); err != nil {
+		d.warn("代理服务", "%v", err)
+	} else {
+		client := &nethttp.Client{Timeout: *timeout}
+		resp, err := client.Get(addr + "/healthz")
+		if err != nil {
+			d.warn("代理服务", "%s 无法访问，代理没有运行: %v", addr, err)
+		} else {
+			_ = resp.Body.Close()
+			d.ok("代理服务", "%s 正在运行", addr)
+		}
+	}
+
+	infra, infraCleanup, err := data.NewTRInfra(bootstrap, commandLogger())
+	if err != nil {
+		d.fail("Transmission", "%v", err)
+		return fmt.Errorf("%d 项检查失败", d.failed)
+	}
+	defer infraCleanup()
+
+	rootURL := bootstrap.GetTrigger().GetHttp().GetRootUrl()
+	probeURL := ""
+	if rootURL == "" {
+		d.warn("root_url", "没有设置 trigger.http.root_url，tr 无法下载代理缓存的种子文件")
+	} else {
+		// 不存在的种子文件，tr 只会收到 404，不会添加种子
+		probeURL, err = url.JoinPath(rootURL, "download", "doctor-"+uuid.New().String()+".torrent")
+		if err != nil {
+			d.fail("root_url", "%v", err)
+			probeURL = ""
+		}
+	}
+
+	for _, backend := range infra.Backends.List() {
+		name := "Transmission " + backend.Name
+		connected, version, err := backend.Status()
+		if !connected {
+			d.fail(name, "无法访问: %v", err)
+			continue
+		}
+		d.ok(name, "RPC 版本 %d", version)
+
+		if probeURL == "" {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		statusCode, err := backend.ProbeTorrentURL(ctx, probeURL)
+		cancel()
+		if err != nil {
+			d.fail(name+" -> root_url", "tr 无法访问 %s: %v", rootURL, err)
+			continue
+		}
+		d.ok(name+" -> root_url", "tr 可以访问 %s (HTTP %d)", rootURL, statusCode)
+	}
+
+	if d.failed > 0 {
+		return fmt.Errorf("%d 项检查失败", d.failed)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// levelLogger 可以在运行时修改日志等级的 Logger
+type levelLogger struct {
+	logger log.Logger
+	level  atomic.Int32
+}
+
+func newLevelLogger(logger log.Logger, level log.Level) *levelLogger {
+	l := &levelLogger{logger: logger}
+	l.SetLevel(level)
+	return l
+}
+
+// SetLevel 修改日志等级
+func (l *levelLogger) SetLevel(level log.Level) {
+	l.level.Store(int32(level))
+}
+
+// Level 获取当前日志等级
+func (l *levelLogger) Level() log.Level {
+	return log.Level(l.level.Load())
+}
+
+func (l *levelLogger) Log(level log.Level, keyvals ...any) error {
+	if level < l.Level() {
+		return nil
+	}
+	return l.logger.Log(level, keyvals...)
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
 
 	"transmission-proxy/conf"
 	_ "transmission-proxy/encoding"
@@ -10,8 +13,12 @@ import (
 
 	"github.com/go-kratos/kratos/v2"
 	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/go-kratos/kratos/v2/transport/grpc"
 	"github.com/go-kratos/kratos/v2/transport/http"
 
+	"google.golang.org/protobuf/proto"
+
 	_ "github.com/azicen/kratos-extension/encoding"
 	_ "github.com/joho/godotenv/autoload"
 	_ "go.uber.org/automaxprocs"
@@ -25,18 +32,33 @@ var (
 	Version string
 
 	guid, _ = os.Hostname()
+
+	// checkConfig 只校验配置文件后退出
+	checkConfig bool
 )
 
-func newApp(logger log.Logger, hs *http.Server, _ *trigger.ScheduledTask) *kratos.App {
+func init() {
+	flag.BoolVar(&checkConfig, "check-config", false, "validate the config file and exit")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), commandUsage, filepath.Base(os.Args[0]))
+		fmt.Fprintln(flag.CommandLine.Output(), "\nFlags:")
+		flag.PrintDefaults()
+	}
+}
+
+func newApp(logger log.Logger, hs *http.Server, gs *grpc.Server, _ *trigger.ScheduledTask) *kratos.App {
+	servers := []transport.Server{hs}
+	// 没有设置 trigger.grpc 时不启动 gRPC 服务
+	if gs != nil {
+		servers = append(servers, gs)
+	}
 	appInstance := kratos.New(
 		kratos.ID(guid),
 		kratos.Name(Name),
 		kratos.Version(Version),
 		kratos.Metadata(map[string]string{}),
 		kratos.Logger(logger),
-		kratos.Server(
-			hs,
-		),
+		kratos.Server(servers...),
 	)
 
 	return appInstance
@@ -45,9 +67,27 @@ func newApp(logger log.Logger, hs *http.Server, _ *trigger.ScheduledTask) *krato
 func main() {
 	flag.Parse()
 
-	bc, bcCleanup, err := conf.LoadConf(conf.FlagConf)
+	// 返回错误而不是 panic，确保退出前执行清理
+	var err error
+	if flag.NArg() > 0 {
+		err = runCommand(flag.Args())
+	} else {
+		err = run()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	if checkConfig {
+		return runCheckConfig()
+	}
+
+	bc, reloader, bcCleanup, err := conf.LoadConf(conf.FlagConf)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer bcCleanup()
 
@@ -57,17 +97,81 @@ func main() {
 		"ts", log.DefaultTimestamp,
 		"caller", log.Caller(5),
 	)
-	logger = log.NewFilter(logger, log.FilterLevel(logLevel))
+	levelLogger := newLevelLogger(logger, logLevel)
+	logger = levelLogger
 	log.NewHelper(logger).Debugw("guid", guid, "version", Version)
 
-	app, cleanup, err := initApp(bc, logger)
+	reloader.Subscribe(func(previous, current *conf.Bootstrap) {
+		l := log.NewHelper(logger)
+		if previous.GetService().GetLogLevel() != current.GetService().GetLogLevel() {
+			level := log.ParseLevel(current.GetService().GetLogLevel())
+			l.Infof("配置已更新: service.log_level %v -> %v", levelLogger.Level(), level)
+			levelLogger.SetLevel(level)
+		}
+		for _, key := range restartRequired(previous, current) {
+			l.Warnf("配置 %s 已变化，需要重启才能生效", key)
+		}
+	})
+	if err := reloader.Watch(logger); err != nil {
+		return err
+	}
+
+	tracingCleanup, err := initTracerProvider(serviceConf.GetTracing())
 	if err != nil {
-		panic(err)
+		return err
+	}
+	defer tracingCleanup()
+
+	// tr 无法访问时不会失败，代理以降级模式启动并在后台重新连接
+	app, cleanup, err := initApp(bc, reloader, logger)
+	if err != nil {
+		return err
 	}
 	defer cleanup()
 
 	// start and wait for stop signal
-	if err := app.Run(); err != nil {
-		panic(err)
+	return app.Run()
+}
+
+// runCheckConfig 校验配置文件，配置文件不存在时不从模板创建
+func runCheckConfig() error {
+	path := filepath.Join(conf.FlagConf, conf.ConfigFileName)
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	_, _, cleanup, err := conf.LoadConf(conf.FlagConf)
+	if err != nil {
+		return err
+	}
+	cleanup()
+	fmt.Printf("%s: 配置有效\n", path)
+	return nil
+}
+
+// restartRequired 返回变化后需要重启才能生效的配置
+func restartRequired(previous, current *conf.Bootstrap) []string {
+	previousHTTP, currentHTTP := previous.GetTrigger().GetHttp(), current.GetTrigger().GetHttp()
+	previousGRPC, currentGRPC := previous.GetTrigger().GetGrpc(), current.GetTrigger().GetGrpc()
+	previousTR, currentTR := previous.GetInfra().GetTr(), current.GetInfra().GetTr()
+
+	keys := make([]string, 0)
+	changed := func(key string, equal bool) {
+		if !equal {
+			keys = append(keys, key)
+		}
 	}
+	changed("service.tracing", proto.Equal(previous.GetService().GetTracing(), current.GetService().GetTracing()))
+	changed("trigger.http.host", previousHTTP.GetHost() == currentHTTP.GetHost())
+	changed("trigger.http.port", previousHTTP.GetPort() == currentHTTP.GetPort())
+	changed("trigger.http.timeout", proto.Equal(previousHTTP.GetTimeout(), currentHTTP.GetTimeout()))
+	changed("trigger.grpc", proto.Equal(previousGRPC, currentGRPC))
+	changed("infra.tr.rpc_url", previousTR.GetRpcUrl() == currentTR.GetRpcUrl())
+	changed("infra.tr.backends", slices.EqualFunc(previousTR.GetBackends(), currentTR.GetBackends(),
+		func(a, b *conf.Infra_TR_Backend) bool { return proto.Equal(a, b) }))
+	changed("infra.tr.placement", previousTR.GetPlacement() == currentTR.GetPlacement())
+	changed("infra.tr.rpc_timeout", proto.Equal(previousTR.GetRpcTimeout(), currentTR.GetRpcTimeout()))
+	changed("infra.tr.rpc_retries", previousTR.GetRpcRetries() == currentTR.GetRpcRetries())
+	changed("infra.geoip", proto.Equal(previous.GetInfra().GetGeoip(), current.GetInfra().GetGeoip()))
+	changed("infra.traffic", proto.Equal(previous.GetInfra().GetTraffic(), current.GetInfra().GetTraffic()))
+	return keys
 }
@@ -50,6 +50,7 @@ func generateProtoAPI() {
 		"--go_out=paths=source_relative:./api",
 		"--go-http_out=paths=source_relative:./api",
 		"--go-grpc_out=paths=source_relative:./api",
+		"--validate_out=lang=go,paths=source_relative:./api",
 	}
 	args = append(args, protoFiles...)
 	cmd := exec.Command("protoc", args...)
@@ -67,6 +68,7 @@ func generateProtoConfig() {
 		"--proto_path=./conf",
 		"--proto_path=./proto/extension",
 		"--go_out=paths=source_relative:./conf",
+		"--validate_out=lang=go,paths=source_relative:./conf",
 		"./conf/conf.proto",
 	}
 	cmd := exec.Command("protoc", args...)
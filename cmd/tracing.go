@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+
+	"transmission-proxy/conf"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// initTracerProvider 初始化全局 TracerProvider
+// 没有配置接收端时不启用链路追踪
+func initTracerProvider(config *conf.Service_Tracing) (cleanup func(), err error) {
+	cleanup = func() {}
+	if config.GetEndpoint() == "" {
+		return
+	}
+
+	opts := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(config.GetEndpoint()),
+	}
+	if config.GetInsecure() {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(context.Background(), opts...)
+	if err != nil {
+		return
+	}
+
+	sampleRatio := 1.0
+	if config.SampleRatio != nil {
+		sampleRatio = config.GetSampleRatio()
+	}
+
+	provider := tracesdk.NewTracerProvider(
+		tracesdk.WithBatcher(exporter),
+		tracesdk.WithSampler(tracesdk.ParentBased(tracesdk.TraceIDRatioBased(sampleRatio))),
+		tracesdk.WithResource(resource.NewSchemaless(
+			semconv.ServiceName(Name),
+			semconv.ServiceVersion(Version),
+			semconv.ServiceInstanceID(guid),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	cleanup = func() {
+		_ = provider.Shutdown(context.Background())
+	}
+	return
+}
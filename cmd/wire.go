@@ -17,7 +17,7 @@ import (
 )
 
 // initApp init kratos application.
-func initApp(*conf.Bootstrap, log.Logger) (*kratos.App, func(), error) {
+func initApp(*conf.Bootstrap, *conf.Reloader, log.Logger) (*kratos.App, func(), error) {
 	panic(wire.Build(
 		data.ProviderSet,
 		domain.ProviderSet,
@@ -26,28 +26,40 @@ import (
 // Injectors from wire.go:
 
 // initApp init kratos application.
-func initApp(bootstrap *conf.Bootstrap, logger log.Logger) (*kratos.App, func(), error) {
+func initApp(bootstrap *conf.Bootstrap, reloader *conf.Reloader, logger log.Logger) (*kratos.App, func(), error) {
 	infra, cleanup, err := data.NewInfra(bootstrap, logger)
 	if err != nil {
 		return nil, nil, err
 	}
 	appRepo := data.NewAppDao(infra, logger)
 	banIPRepo := data.NewBanIPDao(infra, logger)
-	appUsecase := domain.NewAppUsecase(appRepo, banIPRepo, logger)
+	queueLock := domain.NewQueueLock()
+	appUsecase := domain.NewAppUsecase(bootstrap, appRepo, banIPRepo, queueLock, logger)
 	appService := service.NewAppService(appUsecase)
 	torrentRepo, err := data.NewTorrentDao(infra, logger)
 	if err != nil {
 		cleanup()
 		return nil, nil, err
 	}
-	torrentUsecase := domain.NewTorrentUsecase(bootstrap, banIPRepo, torrentRepo, logger)
+	geoIPRepo, err := data.NewGeoIPDao(infra, logger)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	trafficRepo := data.NewTrafficDao(infra, logger)
+	torrentUsecase := domain.NewTorrentUsecase(bootstrap, appRepo, banIPRepo, geoIPRepo, torrentRepo, trafficRepo, queueLock, logger)
 	authService := service.NewAuthService(torrentUsecase)
+	statisticsService := service.NewStatisticsService(torrentUsecase)
 	syncService := service.NewSyncService(torrentUsecase)
 	torrentService := service.NewTorrentService(torrentUsecase)
 	transferService := service.NewTransferService(appUsecase)
-	server := trigger.NewHTTPServer(bootstrap, appService, authService, syncService, torrentService, transferService, logger)
-	scheduledTask, cleanup2 := trigger.NewScheduledTask(bootstrap, torrentUsecase, logger)
-	app := newApp(logger, server, scheduledTask)
+	adminService := service.NewAdminService(appUsecase, torrentUsecase)
+	registry := trigger.NewMetricsRegistry(torrentUsecase)
+	adminToken := trigger.NewAdminToken(bootstrap, reloader)
+	server := trigger.NewHTTPServer(bootstrap, adminService, appService, authService, statisticsService, syncService, torrentService, transferService, torrentUsecase, registry, adminToken, logger)
+	grpcServer := trigger.NewGRPCServer(bootstrap, adminService, appService, authService, statisticsService, syncService, torrentService, transferService, adminToken, logger)
+	scheduledTask, cleanup2 := trigger.NewScheduledTask(bootstrap, reloader, appUsecase, torrentUsecase, logger)
+	app := newApp(logger, server, grpcServer, scheduledTask)
 	return app, func() {
 		cleanup2()
 		cleanup()
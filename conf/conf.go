@@ -3,12 +3,13 @@ package conf
 import (
 	"embed"
 	"flag"
+	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/go-kratos/kratos/v2/config"
 	"github.com/go-kratos/kratos/v2/config/env"
-	"github.com/go-kratos/kratos/v2/config/file"
+	"github.com/go-kratos/kratos/v2/log"
 )
 
 var (
@@ -29,38 +30,42 @@ const (
 //go:embed conf.template.toml
 var TemplateFS embed.FS
 
-// LoadConf 读取配置文件
-func LoadConf(path string, s ...config.Source) (*Bootstrap, func(), error) {
+// LoadConf 读取配置文件，返回的 Reloader 用于监听配置文件变化
+func LoadConf(path string, s ...config.Source) (*Bootstrap, *Reloader, func(), error) {
 	path = filepath.Join(path, ConfigFileName)
 	// 检查文件是否存在
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		err := CopyFS(TemplateFS, TemplateName, path)
 		if err != nil {
-			return nil, func() {}, err
+			return nil, nil, func() {}, err
 		}
 	}
 
 	source := []config.Source{
 		env.NewSource(ENVPrefix),
-		file.NewSource(path),
+		newFileSource(path),
 	}
 	source = append(source, s...)
 	c := config.New(
 		config.WithSource(source...),
 	)
 	if err := c.Load(); err != nil {
-		return nil, func() {}, err
+		return nil, nil, func() {}, err
 	}
-	bc := &Bootstrap{}
-	if err := c.Scan(bc); err != nil {
-		return nil, func() {}, err
+	bc, warnings, err := scan(c)
+	for _, warning := range warnings {
+		log.Warn(warning)
+	}
+	if err != nil {
+		c.Close()
+		return nil, nil, func() {}, fmt.Errorf("%s: %w", path, err)
 	}
 
 	cleanup := func() {
 		c.Close()
 	}
 
-	return bc, cleanup, nil
+	return bc, newReloader(c, bc), cleanup, nil
 }
 
 // CopyFS 从嵌入文件中复
@@ -0,0 +1,81 @@
+package conf
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-kratos/kratos/v2/config"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// envName 配置项对应的环境变量名，例如 infra.tr.rpc_url 对应 TRP_INFRA_TR_RPC_URL
+func envName(path []string) string {
+	return ENVPrefix + strings.ToUpper(strings.Join(path, "_"))
+}
+
+// envOverrides 读取覆盖配置文件的环境变量
+// 每个非列表的配置项都可以使用对应的环境变量覆盖，没有设置时返回 nil
+func envOverrides() *config.KeyValue {
+	values := make(map[string]any)
+	collectEnv(values, nil, (&Bootstrap{}).ProtoReflect().Descriptor())
+	if len(values) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil
+	}
+	return &config.KeyValue{
+		Key:    "env",
+		Value:  data,
+		Format: "json",
+	}
+}
+
+// collectEnv 按配置结构查找环境变量
+func collectEnv(values map[string]any, path []string, md protoreflect.MessageDescriptor) {
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.IsList() || fd.IsMap() {
+			continue
+		}
+		fieldPath := append(append([]string{}, path...), string(fd.Name()))
+
+		if fd.Kind() == protoreflect.MessageKind &&
+			fd.Message().FullName() != (&durationpb.Duration{}).ProtoReflect().Descriptor().FullName() {
+			child := make(map[string]any)
+			collectEnv(child, fieldPath, fd.Message())
+			if len(child) > 0 {
+				values[string(fd.Name())] = child
+			}
+			continue
+		}
+
+		value, ok := os.LookupEnv(envName(fieldPath))
+		if !ok {
+			continue
+		}
+		values[string(fd.Name())] = envValue(fd, value)
+	}
+}
+
+// envValue 将环境变量转换为配置项的类型，无法转换时保留字符串，由读取配置时报错
+func envValue(fd protoreflect.FieldDescriptor, value string) any {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		if v, err := strconv.ParseBool(value); err == nil {
+			return v
+		}
+	case protoreflect.Int32Kind, protoreflect.Int64Kind, protoreflect.Uint32Kind, protoreflect.Uint64Kind,
+		protoreflect.Sint32Kind, protoreflect.Sint64Kind, protoreflect.FloatKind, protoreflect.DoubleKind:
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			return v
+		}
+	default:
+	}
+	return value
+}
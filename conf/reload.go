@@ -0,0 +1,80 @@
+package conf
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/go-kratos/kratos/v2/config"
+	"github.com/go-kratos/kratos/v2/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// watchKeys 监听变化的配置根节点
+var watchKeys = []string{"service", "trigger", "infra"}
+
+// Reloader 监听配置文件变化，重新读取配置后通知订阅者
+type Reloader struct {
+	c config.Config
+
+	mu       sync.Mutex
+	current  *Bootstrap
+	handlers []func(previous, current *Bootstrap)
+}
+
+func newReloader(c config.Config, bc *Bootstrap) *Reloader {
+	return &Reloader{
+		c:       c,
+		current: bc,
+	}
+}
+
+// Current 获取当前的配置
+func (r *Reloader) Current() *Bootstrap {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Subscribe 订阅配置变化，配置变化时按订阅顺序调用
+func (r *Reloader) Subscribe(handler func(previous, current *Bootstrap)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers = append(r.handlers, handler)
+}
+
+// Watch 开始监听配置文件变化
+func (r *Reloader) Watch(logger log.Logger) error {
+	l := log.NewHelper(logger)
+	for _, key := range watchKeys {
+		err := r.c.Watch(key, func(string, config.Value) {
+			r.reload(l)
+		})
+		// 配置文件中没有的节点不需要监听
+		if err != nil && !errors.Is(err, config.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// reload 重新读取配置，配置没有变化时不通知订阅者
+// 一次文件修改可能触发多个节点的回调，比较后只通知一次
+func (r *Reloader) reload(l *log.Helper) {
+	bc, _, err := scan(r.c)
+	if err != nil {
+		l.Errorf("重新读取配置失败，继续使用当前配置: %v", err)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if proto.Equal(r.current, bc) {
+		return
+	}
+	previous := r.current
+	r.current = bc
+	l.Infof("配置文件已变化，重新加载配置")
+	for _, handler := range r.handlers {
+		handler(previous, bc)
+	}
+}
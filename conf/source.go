@@ -0,0 +1,81 @@
+package conf
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-kratos/kratos/v2/config"
+	"github.com/go-kratos/kratos/v2/config/file"
+)
+
+var _ config.Source = (*fileSource)(nil)
+
+// fileSource 配置文件源
+// kratos 的文件源监听文件本身，编辑器保存时用新文件替换配置文件后监听会失效，
+// 这里改为监听所在目录并按文件名过滤事件
+// 读取配置文件后合并覆盖配置项的环境变量，重新加载时环境变量仍然优先
+type fileSource struct {
+	path string
+	config.Source
+}
+
+func newFileSource(path string) config.Source {
+	return &fileSource{
+		path:   filepath.Clean(path),
+		Source: file.NewSource(path),
+	}
+}
+
+func (s *fileSource) Load() ([]*config.KeyValue, error) {
+	kvs, err := s.Source.Load()
+	if err != nil {
+		return nil, err
+	}
+	if kv := envOverrides(); kv != nil {
+		kvs = append(kvs, kv)
+	}
+	return kvs, nil
+}
+
+func (s *fileSource) Watch() (config.Watcher, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := fw.Add(filepath.Dir(s.path)); err != nil {
+		_ = fw.Close()
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &fileWatcher{s: s, fw: fw, ctx: ctx, cancel: cancel}, nil
+}
+
+type fileWatcher struct {
+	s  *fileSource
+	fw *fsnotify.Watcher
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (w *fileWatcher) Next() ([]*config.KeyValue, error) {
+	for {
+		select {
+		case <-w.ctx.Done():
+			return nil, w.ctx.Err()
+		case event := <-w.fw.Events:
+			if filepath.Clean(event.Name) != w.s.path || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			return w.s.Load()
+		case err := <-w.fw.Errors:
+			return nil, err
+		}
+	}
+}
+
+func (w *fileWatcher) Stop() error {
+	w.cancel()
+	return w.fw.Close()
+}
@@ -0,0 +1,118 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/go-kratos/kratos/v2/config"
+)
+
+// fieldError protoc-gen-validate 生成的字段校验错误
+type fieldError interface {
+	Field() string
+	Reason() string
+	Cause() error
+}
+
+// multiError protoc-gen-validate 生成的多个校验错误
+type multiError interface {
+	AllErrors() []error
+}
+
+// embeddedReason 嵌套消息校验失败时的原因，具体错误在 Cause 中
+const embeddedReason = "embedded message failed validation"
+
+// scan 读取配置，处理废弃的配置项并校验
+func scan(c config.Config) (*Bootstrap, []string, error) {
+	bc := &Bootstrap{}
+	if err := c.Scan(bc); err != nil {
+		return nil, nil, fmt.Errorf("读取配置失败: %w", err)
+	}
+	warnings := migrate(bc)
+	if err := validate(bc); err != nil {
+		return nil, warnings, err
+	}
+	return bc, warnings, nil
+}
+
+// migrate 将废弃的配置项转换为新的配置项，返回需要提示的警告
+func migrate(bc *Bootstrap) []string {
+	warnings := make([]string, 0)
+	if http := bc.GetTrigger().GetHttp(); http.GetRootRul() != "" {
+		if http.GetRootUrl() == "" {
+			http.RootUrl = http.GetRootRul()
+		}
+		warnings = append(warnings, "配置 trigger.http.root_rul 已废弃，请使用 trigger.http.root_url")
+	}
+	return warnings
+}
+
+// validate 校验配置，错误信息包含配置项与对应的环境变量
+func validate(bc *Bootstrap) error {
+	issues := make([]string, 0)
+	collectIssues(&issues, nil, bc.ValidateAll())
+
+	tr := bc.GetInfra().GetTr()
+	if tr != nil && tr.GetRpcUrl() == "" && len(tr.GetBackends()) == 0 {
+		issues = append(issues, describeIssue([]string{"infra", "tr", "rpc_url"},
+			"rpc_url 与 backends 至少需要设置一个"))
+	}
+
+	if len(issues) == 0 {
+		return nil
+	}
+	return errors.New("配置校验失败:\n  " + strings.Join(issues, "\n  "))
+}
+
+// collectIssues 展开嵌套的校验错误
+func collectIssues(issues *[]string, path []string, err error) {
+	if err == nil {
+		return
+	}
+	var m multiError
+	if errors.As(err, &m) {
+		for _, e := range m.AllErrors() {
+			collectIssues(issues, path, e)
+		}
+		return
+	}
+	var f fieldError
+	if !errors.As(err, &f) {
+		*issues = append(*issues, describeIssue(path, err.Error()))
+		return
+	}
+
+	fieldPath := append(append([]string{}, path...), snakeCase(f.Field()))
+	if f.Reason() == embeddedReason && f.Cause() != nil {
+		collectIssues(issues, fieldPath, f.Cause())
+		return
+	}
+	*issues = append(*issues, describeIssue(fieldPath, f.Reason()))
+}
+
+// describeIssue 描述一个配置项的错误，可以用环境变量覆盖的配置项同时给出环境变量名
+func describeIssue(path []string, reason string) string {
+	key := strings.Join(path, ".")
+	if strings.ContainsRune(key, '[') {
+		return fmt.Sprintf("%s: %s", key, reason)
+	}
+	return fmt.Sprintf("%s (环境变量 %s): %s", key, envName(path), reason)
+}
+
+// snakeCase 将生成代码中的字段名转换为配置文件中的字段名，例如 RequestInterval 转换为 request_interval
+func snakeCase(field string) string {
+	var b strings.Builder
+	runes := []rune(field)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
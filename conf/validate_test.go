@@ -0,0 +1,34 @@
+package conf
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// TestValidateRequestInterval 刷新间隔可以不设置，设置为 0 时校验失败
+func TestValidateRequestInterval(t *testing.T) {
+	newBootstrap := func() *Bootstrap {
+		return &Bootstrap{
+			Trigger: &Trigger{Http: &Trigger_HTTP{}},
+			Infra:   &Infra{Tr: &Infra_TR{RpcUrl: "http://localhost:9091/transmission/rpc"}},
+		}
+	}
+	if err := validate(newBootstrap()); err != nil {
+		t.Fatalf("没有设置刷新间隔时校验失败: %v", err)
+	}
+
+	for _, field := range []string{"request_interval", "transfer_request_interval"} {
+		bc := newBootstrap()
+		if field == "request_interval" {
+			bc.Infra.Tr.RequestInterval = durationpb.New(0)
+		} else {
+			bc.Infra.Tr.TransferRequestInterval = durationpb.New(0)
+		}
+		err := validate(bc)
+		if err == nil || !strings.Contains(err.Error(), field) {
+			t.Errorf("%s 为 0 时校验返回 %v", field, err)
+		}
+	}
+}
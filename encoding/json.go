@@ -1,13 +1,16 @@
 package encoding
 
 import (
+	"bytes"
 	"encoding/json"
 	"reflect"
+	"strings"
 
 	"github.com/go-kratos/kratos/v2/encoding"
 	"google.golang.org/genproto/googleapis/api/httpbody"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	wrapperspb "google.golang.org/protobuf/types/known/wrapperspb"
 )
 
@@ -86,5 +89,88 @@ func (h *HTTPBodyMarshaler) Marshal(v proto.Message) ([]byte, error) {
 	if sv, ok := v.(*wrapperspb.StringValue); ok {
 		return []byte(sv.Value), nil
 	}
-	return h.Marshaler.Marshal(v)
+	data, err := h.Marshaler.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return int64AsNumber(v.ProtoReflect().Descriptor(), data)
+}
+
+// int64AsNumber protojson 将 64 位整数编码为字符串，qb 返回的是数字，按消息定义将这些字段转换为数字
+func int64AsNumber(desc protoreflect.MessageDescriptor, data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	value = convertMessage(desc, value)
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)))
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func convertMessage(desc protoreflect.MessageDescriptor, value interface{}) interface{} {
+	// 知名类型有特殊的 JSON 格式，保持 protojson 的编码
+	if strings.HasPrefix(string(desc.FullName()), "google.protobuf.") {
+		return value
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	fields := desc.Fields()
+	for key, fieldValue := range object {
+		fd := fields.ByName(protoreflect.Name(key))
+		if fd == nil {
+			fd = fields.ByJSONName(key)
+		}
+		if fd == nil {
+			continue
+		}
+		object[key] = convertField(fd, fieldValue)
+	}
+	return object
+}
+
+func convertField(fd protoreflect.FieldDescriptor, value interface{}) interface{} {
+	switch {
+	case fd.IsMap():
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return value
+		}
+		for key, v := range object {
+			object[key] = convertSingular(fd.MapValue(), v)
+		}
+		return object
+	case fd.IsList():
+		list, ok := value.([]interface{})
+		if !ok {
+			return value
+		}
+		for i, v := range list {
+			list[i] = convertSingular(fd, v)
+		}
+		return list
+	}
+	return convertSingular(fd, value)
+}
+
+func convertSingular(fd protoreflect.FieldDescriptor, value interface{}) interface{} {
+	switch fd.Kind() {
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if s, ok := value.(string); ok {
+			return json.Number(s)
+		}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return convertMessage(fd.Message(), value)
+	}
+	return value
 }
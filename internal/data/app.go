@@ -2,11 +2,23 @@ package data
 
 import (
 	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
 
+	"transmission-proxy/conf"
 	"transmission-proxy/internal/domain"
 
+	"github.com/go-kratos/kratos/v2/encoding"
 	"github.com/go-kratos/kratos/v2/log"
 	"github.com/hekmon/transmissionrpc/v3"
+	col "github.com/noxiouz/golang-generics-util/collection"
+)
+
+const (
+	PreferencesFileName = "preferences.json"
 )
 
 var preferencesFields = []string{
@@ -28,14 +40,44 @@ var preferencesFields = []string{
 	"alt-speed-down",
 	"alt-speed-enabled",
 	"alt-speed-up",
+	"speed-limit-down",
+	"speed-limit-down-enabled",
+	"speed-limit-up",
+	"speed-limit-up-enabled",
+	"port-forwarding-enabled",
 	"peer-limit-global",
 	"peer-limit-per-torrent",
 	"version",
 }
 
+// ProxyPreferences 代理模拟实现的首选项（写盘）
+type ProxyPreferences struct {
+	DontCountSlowTorrents      bool  `json:"dont_count_slow_torrents"`
+	SlowTorrentDlRateThreshold int32 `json:"slow_torrent_dl_rate_threshold"`
+	SlowTorrentUlRateThreshold int32 `json:"slow_torrent_ul_rate_threshold"`
+	SlowTorrentInactiveTimer   int32 `json:"slow_torrent_inactive_timer"`
+
+	// SlowSlots 每个后端因慢速种子而额外增加的队列数量 key: <后端名称>
+	SlowSlots map[string]QueueSlots `json:"slow_slots,omitempty"`
+
+	// SlowDownloadSlots SlowSeedSlots 旧版本所有后端共用的数量，只在读取时迁移到 SlowSlots
+	SlowDownloadSlots int64 `json:"slow_download_slots,omitempty"`
+	SlowSeedSlots     int64 `json:"slow_seed_slots,omitempty"`
+}
+
+// QueueSlots 队列数量（写盘）
+type QueueSlots struct {
+	Download int64 `json:"download"`
+	Seed     int64 `json:"seed"`
+}
+
 type appDao struct {
 	infra *Infra
 	log   *log.Helper
+
+	// proxyPreferences 已加载的代理首选项
+	proxyPreferences col.Option[domain.ProxyPreferences]
+	mutex            sync.Mutex
 }
 
 // NewAppDao .
@@ -43,12 +85,15 @@ func NewAppDao(infra *Infra, logger log.Logger) domain.AppRepo {
 	return &appDao{
 		infra: infra,
 		log:   log.NewHelper(logger),
+
+		proxyPreferences: col.None[domain.ProxyPreferences](),
 	}
 }
 
 // GetPreferences 获取首选项
+// 有多个 tr 后端时使用第一个已连接的后端的首选项，首选项由 SetPreferences 设置到所有后端
 func (d *appDao) GetPreferences(ctx context.Context) (transmissionrpc.SessionArguments, error) {
-	pre, err := d.infra.TR.SessionArgumentsGet(ctx, preferencesFields)
+	pre, err := d.infra.Backends.FirstConnected().TR.SessionArgumentsGet(ctx, preferencesFields)
 	if err != nil {
 		return transmissionrpc.SessionArguments{}, err
 	}
@@ -56,10 +101,144 @@ func (d *appDao) GetPreferences(ctx context.Context) (transmissionrpc.SessionArg
 }
 
 // SetPreferences 设置首选项
-func (d *appDao) SetPreferences(ctx context.Context, pre transmissionrpc.SessionArguments) error {
-	err := d.infra.TR.SessionArgumentsSet(ctx, pre)
+// 有多个 tr 后端时设置到所有后端，队列数量加上每个后端因慢速种子额外增加的数量
+// 有后端未连接时返回错误，调用方在下次设置时重试
+func (d *appDao) SetPreferences(ctx context.Context, pre transmissionrpc.SessionArguments,
+	slowSlots map[string]domain.QueueSlots) error {
+
+	return d.infra.Backends.each(func(_ int, backend *Backend) error {
+		backendPre := pre
+		slots := slowSlots[backend.Name]
+		if pre.DownloadQueueSize != nil {
+			size := *pre.DownloadQueueSize + slots.Download
+			backendPre.DownloadQueueSize = &size
+		}
+		if pre.SeedQueueSize != nil {
+			size := *pre.SeedQueueSize + slots.Seed
+			backendPre.SeedQueueSize = &size
+		}
+		return backend.TR.SessionArgumentsSet(ctx, backendPre)
+	})
+}
+
+// GetBackendPreferences 获取每个已连接后端的首选项，按配置顺序排列
+// 部分后端失败时跳过，所有后端都失败时返回错误
+func (d *appDao) GetBackendPreferences(ctx context.Context) ([]domain.BackendPreferences, error) {
+	backends := d.infra.Backends.List()
+	pres := make([]transmissionrpc.SessionArguments, len(backends))
+	ok, err := d.infra.Backends.eachConnected(func(index int, backend *Backend) error {
+		pre, err := backend.TR.SessionArgumentsGet(ctx, preferencesFields)
+		if err != nil {
+			return err
+		}
+		pres[index] = pre
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]domain.BackendPreferences, 0, len(backends))
+	for index, backend := range backends {
+		if ok[index] {
+			res = append(res, domain.BackendPreferences{Backend: backend.Name, Preferences: pres[index]})
+		}
+	}
+	return res, nil
+}
+
+// SetBackendPreferences 设置指定后端的首选项
+func (d *appDao) SetBackendPreferences(ctx context.Context, name string,
+	pre transmissionrpc.SessionArguments) error {
+
+	for _, backend := range d.infra.Backends.List() {
+		if backend.Name == name {
+			return backend.TR.SessionArgumentsSet(ctx, pre)
+		}
+	}
+	return fmt.Errorf("tr 后端 %s 不存在", name)
+}
+
+// GetProxyPreferences 获取代理模拟实现的首选项
+func (d *appDao) GetProxyPreferences(_ context.Context) (pre domain.ProxyPreferences, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.proxyPreferences.HasValue() {
+		return cloneProxyPreferences(d.proxyPreferences.Value()), nil
+	}
+
+	// qb 的默认值
+	pp := ProxyPreferences{
+		DontCountSlowTorrents:      false,
+		SlowTorrentDlRateThreshold: 2,
+		SlowTorrentUlRateThreshold: 2,
+		SlowTorrentInactiveTimer:   60,
+	}
+
+	path := filepath.Join(conf.FlagConf, PreferencesFileName)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	if err == nil {
+		err = encoding.GetCodec("json").Unmarshal(data, &pp)
+		if err != nil {
+			return
+		}
+	}
+
+	pre = domain.ProxyPreferences{
+		DontCountSlowTorrents:      pp.DontCountSlowTorrents,
+		SlowTorrentDlRateThreshold: pp.SlowTorrentDlRateThreshold,
+		SlowTorrentUlRateThreshold: pp.SlowTorrentUlRateThreshold,
+		SlowTorrentInactiveTimer:   pp.SlowTorrentInactiveTimer,
+		SlowSlots:                  make(map[string]domain.QueueSlots, len(pp.SlowSlots)),
+	}
+	for name, slots := range pp.SlowSlots {
+		pre.SlowSlots[name] = domain.QueueSlots{Download: slots.Download, Seed: slots.Seed}
+	}
+	// 旧版本的数量增加到了所有后端
+	if pp.SlowSlots == nil && (pp.SlowDownloadSlots != 0 || pp.SlowSeedSlots != 0) {
+		for _, backend := range d.infra.Backends.List() {
+			pre.SlowSlots[backend.Name] = domain.QueueSlots{Download: pp.SlowDownloadSlots, Seed: pp.SlowSeedSlots}
+		}
+	}
+	d.proxyPreferences = col.Some(pre)
+	return cloneProxyPreferences(pre), nil
+}
+
+// SaveProxyPreferences 保存代理模拟实现的首选项
+func (d *appDao) SaveProxyPreferences(_ context.Context, pre domain.ProxyPreferences) (err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	pp := ProxyPreferences{
+		DontCountSlowTorrents:      pre.DontCountSlowTorrents,
+		SlowTorrentDlRateThreshold: pre.SlowTorrentDlRateThreshold,
+		SlowTorrentUlRateThreshold: pre.SlowTorrentUlRateThreshold,
+		SlowTorrentInactiveTimer:   pre.SlowTorrentInactiveTimer,
+		SlowSlots:                  make(map[string]QueueSlots, len(pre.SlowSlots)),
+	}
+	for name, slots := range pre.SlowSlots {
+		pp.SlowSlots[name] = QueueSlots{Download: slots.Download, Seed: slots.Seed}
+	}
+	json, err := encoding.GetCodec("json").Marshal(&pp)
 	if err != nil {
-		return err
+		return
 	}
-	return nil
+
+	path := filepath.Join(conf.FlagConf, PreferencesFileName)
+	err = writeFileAtomic(path, json, 0644)
+	if err != nil {
+		return
+	}
+	d.proxyPreferences = col.Some(cloneProxyPreferences(pre))
+	return
+}
+
+// cloneProxyPreferences 复制代理首选项，缓存的首选项不会被调用方修改
+func cloneProxyPreferences(pre domain.ProxyPreferences) domain.ProxyPreferences {
+	pre.SlowSlots = maps.Clone(pre.SlowSlots)
+	return pre
 }
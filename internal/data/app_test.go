@@ -0,0 +1,56 @@
+package data
+
+import (
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"transmission-proxy/conf"
+	"transmission-proxy/internal/domain"
+
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// TestProxyPreferencesSlowSlots 慢速种子数量按后端保存，旧版本共用的数量迁移到所有后端
+func TestProxyPreferencesSlowSlots(t *testing.T) {
+	ctx := context.Background()
+	conf.FlagConf = t.TempDir()
+	infra := &Infra{Backends: &Backends{list: []*Backend{{Name: "main"}, {Name: "anime"}}}}
+	path := filepath.Join(conf.FlagConf, PreferencesFileName)
+	legacy := `{"dont_count_slow_torrents":true,"slow_download_slots":1,"slow_seed_slots":2}`
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pre, err := NewAppDao(infra, log.DefaultLogger).GetProxyPreferences(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]domain.QueueSlots{"main": {Download: 1, Seed: 2}, "anime": {Download: 1, Seed: 2}}
+	if !pre.DontCountSlowTorrents || !maps.Equal(pre.SlowSlots, want) {
+		t.Fatalf("迁移后的首选项 %+v, 期望慢速种子数量 %v", pre, want)
+	}
+
+	// 修改返回的首选项不影响缓存，保存后重新读取文件
+	appRepo := NewAppDao(infra, log.DefaultLogger)
+	pre.SlowSlots["anime"] = domain.QueueSlots{Seed: 3}
+	delete(pre.SlowSlots, "main")
+	if err = appRepo.SaveProxyPreferences(ctx, pre); err != nil {
+		t.Fatal(err)
+	}
+	pre.SlowSlots["anime"] = domain.QueueSlots{}
+	cached, err := appRepo.GetProxyPreferences(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := NewAppDao(infra, log.DefaultLogger).GetProxyPreferences(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]domain.QueueSlots{"anime": {Seed: 3}}
+	if !maps.Equal(cached.SlowSlots, want) || !maps.Equal(saved.SlowSlots, want) {
+		t.Errorf("慢速种子数量 缓存 %v, 文件 %v, 期望 %v", cached.SlowSlots, saved.SlowSlots, want)
+	}
+}
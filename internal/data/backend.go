@@ -0,0 +1,537 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"transmission-proxy/conf"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/hekmon/transmissionrpc/v3"
+)
+
+const (
+	// DefaultBackendName 只配置 rpc_url 时后端的名称
+	DefaultBackendName = "default"
+
+	// 添加种子时选择后端的策略
+	PlacementCategory    = "category"
+	PlacementLeastLoaded = "least_loaded"
+	PlacementRoundRobin  = "round_robin"
+)
+
+// backendIDBits 种子 ID 中 tr 种子 ID 占用的位数，更高的位保存后端的序号
+// tr 的种子 ID 从 1 开始自增，不会超过 2^48
+const backendIDBits = 48
+
+const (
+	// defaultRPCTimeout 单次 tr RPC 请求的默认超时时间
+	defaultRPCTimeout = 10 * time.Second
+	// defaultRPCRetries tr RPC 请求失败时的默认重试次数
+	defaultRPCRetries = 2
+	// rpcRetryBackoff 第一次重试前的等待时间，之后每次翻倍
+	rpcRetryBackoff = 500 * time.Millisecond
+
+	// disconnectFailures 连续失败的请求数达到该值时标记后端为未连接
+	disconnectFailures = 3
+
+	// 重新连接 tr 后端的等待时间，每次失败后翻倍
+	reconnectMinBackoff = time.Second
+	reconnectMaxBackoff = time.Minute
+)
+
+// ErrBackendDisconnected tr 后端未连接，请求不会发送到 tr
+var ErrBackendDisconnected = errors.New("tr 后端未连接")
+
+// backendState tr 后端的连接状态
+type backendState struct {
+	connected bool
+	version   int64
+	err       error
+}
+
+// Backend tr 后端
+type Backend struct {
+	Name string
+	TR   *transmissionrpc.Client
+
+	// Labels 添加到该后端的种子额外添加的标签
+	Labels []string
+	// Categories 总是添加到该后端的 qb 分类
+	Categories []string
+
+	log   *log.Helper
+	state atomic.Pointer[backendState]
+	// failures 连续失败的请求数，请求成功或重新连接后清零
+	failures atomic.Int32
+	// disconnected 连接断开时通知重连任务
+	disconnected chan struct{}
+}
+
+// Backends 所有的 tr 后端
+type Backends struct {
+	list      []*Backend
+	placement string
+
+	// next 轮流添加种子时下一个后端的序号
+	next atomic.Uint64
+
+	// cancel 停止重连任务
+	cancel context.CancelFunc
+}
+
+// newBackends 按配置创建所有 tr 后端
+// tr 无法访问时以未连接状态启动，由重连任务在后台按退避时间重新连接
+func newBackends(config *conf.Infra_TR, ll *log.Helper) (*Backends, error) {
+	backendConfigs := config.GetBackends()
+	if len(backendConfigs) == 0 {
+		backendConfigs = []*conf.Infra_TR_Backend{{
+			Name:   DefaultBackendName,
+			RpcUrl: config.GetRpcUrl(),
+		}}
+	}
+
+	placement := config.GetPlacement()
+	switch placement {
+	case "":
+		placement = PlacementCategory
+	case PlacementCategory, PlacementLeastLoaded, PlacementRoundRobin:
+	default:
+		return nil, fmt.Errorf("未知的种子添加策略: %s", placement)
+	}
+
+	timeout := defaultRPCTimeout
+	if config.GetRpcTimeout() != nil {
+		timeout = config.GetRpcTimeout().AsDuration()
+	}
+	retries := defaultRPCRetries
+	if config.RpcRetries != nil {
+		retries = int(config.GetRpcRetries())
+	}
+
+	backends := &Backends{
+		list:      make([]*Backend, 0, len(backendConfigs)),
+		placement: placement,
+	}
+	names := make(map[string]struct{}, len(backendConfigs))
+	for i, backendConfig := range backendConfigs {
+		name := backendConfig.GetName()
+		if name == "" {
+			name = fmt.Sprintf("tr%d", i)
+		}
+		if _, ok := names[name]; ok {
+			return nil, fmt.Errorf("tr 后端名称重复: %s", name)
+		}
+		names[name] = struct{}{}
+
+		backend, err := newBackend(name, backendConfig.GetRpcUrl(), timeout, retries, ll)
+		if err != nil {
+			return nil, fmt.Errorf("tr 后端 %s: %w", name, err)
+		}
+		backend.Labels = backendConfig.GetLabels()
+		backend.Categories = backendConfig.GetCategories()
+		backends.list = append(backends.list, backend)
+	}
+
+	// 启动时检查一次连接，失败时不影响启动
+	_ = backends.each(func(_ int, backend *Backend) error {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := backend.connect(ctx); err != nil {
+			ll.Warnf("无法连接 tr 后端 %s，以降级模式启动并在后台重新连接: %v", backend.Name, err)
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	backends.cancel = cancel
+	for _, backend := range backends.list {
+		go backend.reconnectLoop(ctx)
+	}
+	return backends, nil
+}
+
+// newBackend 创建 tr 后端，不会连接 tr
+func newBackend(name string, rpcURL string, timeout time.Duration, retries int, ll *log.Helper) (*Backend, error) {
+	endpoint, err := url.Parse(rpcURL)
+	if err != nil {
+		return nil, err
+	}
+	backend := &Backend{
+		Name:         name,
+		log:          ll,
+		disconnected: make(chan struct{}, 1),
+	}
+	backend.state.Store(&backendState{err: ErrBackendDisconnected})
+	backendUp.WithLabelValues(name).Set(0)
+
+	backend.TR, err = transmissionrpc.New(endpoint, &transmissionrpc.Config{
+		CustomClient: newTRRPCHTTPClient(name, &trRetryTransport{
+			backend: backend,
+			timeout: timeout,
+			retries: retries,
+			next:    http.DefaultTransport.(*http.Transport).Clone(),
+		}),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return backend, nil
+}
+
+// Close 停止重连任务
+func (b *Backends) Close() {
+	b.cancel()
+}
+
+// Default 默认后端，即配置中的第一个后端
+func (b *Backends) Default() *Backend {
+	return b.list[0]
+}
+
+// FirstConnected 第一个已连接的后端，所有后端都未连接时返回默认后端
+func (b *Backends) FirstConnected() *Backend {
+	for _, backend := range b.list {
+		if backend.Connected() {
+			return backend
+		}
+	}
+	return b.Default()
+}
+
+// List 所有后端
+func (b *Backends) List() []*Backend {
+	return b.list
+}
+
+// globalID 将后端中的种子 ID 转换为代理中的种子 ID
+func globalID(index int, id int64) int64 {
+	return int64(index)<<backendIDBits | id
+}
+
+// localID 将代理中的种子 ID 转换为后端的序号与后端中的种子 ID
+func localID(id int64) (int, int64) {
+	return int(id >> backendIDBits), id & (1<<backendIDBits - 1)
+}
+
+// setGlobalID 将后端返回的种子 ID 转换为代理中的种子 ID
+func setGlobalID(torrent *transmissionrpc.Torrent, index int) {
+	if torrent.ID == nil {
+		return
+	}
+	id := globalID(index, *torrent.ID)
+	torrent.ID = &id
+}
+
+// each 并发地在每个后端上执行 fn，返回所有后端的错误
+func (b *Backends) each(fn func(index int, backend *Backend) error) error {
+	errs := make([]error, len(b.list))
+	wg := sync.WaitGroup{}
+	for i, backend := range b.list {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(i, backend); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", backend.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// eachConnected 并发地在每个已连接的后端上执行 fn，跳过未连接的后端
+// 返回每个后端是否执行成功，部分后端失败时只记录日志，所有后端都未连接或失败时返回所有后端的错误
+func (b *Backends) eachConnected(fn func(index int, backend *Backend) error) ([]bool, error) {
+	ok := make([]bool, len(b.list))
+	errs := make([]error, len(b.list))
+	wg := sync.WaitGroup{}
+	for i, backend := range b.list {
+		if !backend.Connected() {
+			errs[i] = fmt.Errorf("%s: %w", backend.Name, ErrBackendDisconnected)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(i, backend); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", backend.Name, err)
+				return
+			}
+			ok[i] = true
+		}()
+	}
+	wg.Wait()
+
+	if !slices.Contains(ok, true) {
+		return ok, errors.Join(errs...)
+	}
+	for i, backend := range b.list {
+		if errs[i] != nil && !errors.Is(errs[i], ErrBackendDisconnected) {
+			backend.log.Warnf("跳过请求失败的 tr 后端: %v", errs[i])
+		}
+	}
+	return ok, nil
+}
+
+// connected 已连接的后端序号
+func (b *Backends) connected() []int {
+	indexes := make([]int, 0, len(b.list))
+	for i, backend := range b.list {
+		if backend.Connected() {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// eachIDs 将代理中的种子 ID 按后端分组，在对应的后端上执行 fn
+func (b *Backends) eachIDs(ids []int64, fn func(backend *Backend, ids []int64) error) error {
+	groups := make(map[int][]int64, len(b.list))
+	for _, id := range ids {
+		index, trID := localID(id)
+		if index >= len(b.list) {
+			return fmt.Errorf("种子 ID %d 不属于任何 tr 后端", id)
+		}
+		groups[index] = append(groups[index], trID)
+	}
+	return b.each(func(index int, backend *Backend) error {
+		if len(groups[index]) == 0 {
+			return nil
+		}
+		return fn(backend, groups[index])
+	})
+}
+
+// Status 获取后端的连接状态
+func (b *Backend) Status() (connected bool, version int64, err error) {
+	state := b.state.Load()
+	return state.connected, state.version, state.err
+}
+
+// Connected 后端是否已连接
+func (b *Backend) Connected() bool {
+	return b.state.Load().connected
+}
+
+// connect 检查 tr RPC 版本，成功后标记为已连接
+func (b *Backend) connect(ctx context.Context) error {
+	ok, version, minimumVersion, err := b.TR.RPCVersion(withProbe(ctx))
+	if err == nil && !ok {
+		err = fmt.Errorf("远程传输 RPC 版本 (v%d) 与传输库 (v%d) 不兼容：远程至少需要 v%d",
+			version, transmissionrpc.RPCVersion, minimumVersion)
+	}
+	if err != nil {
+		b.state.Store(&backendState{err: err})
+		return err
+	}
+
+	b.failures.Store(0)
+	previous := b.state.Swap(&backendState{connected: true, version: version})
+	backendUp.WithLabelValues(b.Name).Set(1)
+	if !previous.connected {
+		b.log.Infof("已连接 tr 后端 %s，远程传输 RPC 版本: v%d", b.Name, version)
+	}
+	return nil
+}
+
+// disconnect 标记为未连接并通知重连任务
+func (b *Backend) disconnect(err error) {
+	state := b.state.Load()
+	if !state.connected {
+		return
+	}
+	if !b.state.CompareAndSwap(state, &backendState{err: err}) {
+		return
+	}
+	backendUp.WithLabelValues(b.Name).Set(0)
+	b.log.Warnf("tr 后端 %s 连接断开: %v", b.Name, err)
+	select {
+	case b.disconnected <- struct{}{}:
+	default:
+	}
+}
+
+// requestFailed 记录一次失败的请求，连续失败 disconnectFailures 次后断开连接
+// 单次超时或响应丢失不会断开，避免健康的后端被跳过
+func (b *Backend) requestFailed(err error) {
+	if b.failures.Add(1) >= disconnectFailures {
+		b.disconnect(err)
+	}
+}
+
+// reconnectLoop 未连接时按退避时间重新连接，直到 ctx 结束
+func (b *Backend) reconnectLoop(ctx context.Context) {
+	backoff := reconnectMinBackoff
+	for {
+		if connected, _, _ := b.Status(); connected {
+			backoff = reconnectMinBackoff
+			select {
+			case <-b.disconnected:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		if err := b.connect(ctx); err != nil {
+			b.log.Debugf("重新连接 tr 后端 %s 失败，%s 后重试: %v", b.Name, backoff, err)
+			backoff = min(backoff*2, reconnectMaxBackoff)
+		}
+	}
+}
+
+// probeKey 标记检查连接的请求，未连接时仍然发送到 tr
+type probeKey struct{}
+
+func withProbe(ctx context.Context) context.Context {
+	return context.WithValue(ctx, probeKey{}, true)
+}
+
+func isProbe(ctx context.Context) bool {
+	probe, _ := ctx.Value(probeKey{}).(bool)
+	return probe
+}
+
+// retryableRPCMethods 只读的 tr RPC 方法，失败时可以重试
+// 其余方法可能已经在 tr 中执行，例如响应超时的 torrent-add 或 queue-move-top，重试会重复执行
+var retryableRPCMethods = map[string]struct{}{
+	"torrent-get":   {},
+	"session-get":   {},
+	"session-stats": {},
+	"free-space":    {},
+}
+
+// trRetryTransport 为每次 tr RPC 请求设置超时时间，只读的请求在网络错误与 5xx 响应时重试
+// 后端未连接时直接返回 ErrBackendDisconnected，避免每次请求都等待超时
+type trRetryTransport struct {
+	backend *Backend
+	timeout time.Duration
+	retries int
+	next    http.RoundTripper
+}
+
+// RoundTrip .
+func (t *trRetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	probe := isProbe(req.Context())
+	if connected, _, err := t.backend.Status(); !connected && !probe {
+		return nil, fmt.Errorf("%w: %v", ErrBackendDisconnected, err)
+	}
+
+	method := trRPCMethod(req)
+	retries := 0
+	if _, ok := retryableRPCMethods[method]; ok {
+		retries = t.retries
+	}
+
+	backoff := rpcRetryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := t.attempt(req)
+		retryable := err != nil || resp.StatusCode >= http.StatusInternalServerError
+		if !retryable || attempt >= retries || req.Context().Err() != nil {
+			// 检查连接的请求由重连任务处理结果，调用方取消的请求不代表后端故障
+			if !probe && req.Context().Err() == nil {
+				switch {
+				case err != nil:
+					t.backend.requestFailed(err)
+				case resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusConflict:
+					t.backend.requestFailed(fmt.Errorf("HTTP %s", resp.Status))
+				default:
+					t.backend.failures.Store(0)
+				}
+			}
+			return resp, err
+		}
+
+		trRPCRetries.WithLabelValues(t.backend.Name, method).Inc()
+		select {
+		case <-time.After(backoff):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		backoff = backoff * 2
+	}
+}
+
+// attempt 发送一次请求，超时时间内读取完整的响应体
+func (t *trRetryTransport) attempt(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	defer cancel()
+
+	attemptReq := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		attemptReq.Body = body
+	}
+	resp, err := t.next.RoundTrip(attemptReq)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// place 选择添加种子的后端，只选择已连接的后端
+// 分类在后端 categories 中的种子总是添加到对应的后端，这些后端都未连接时按策略选择其余的后端
+func (b *Backends) place(ctx context.Context, category string) (int, error) {
+	candidates := b.connected()
+	if len(candidates) == 0 {
+		return 0, ErrBackendDisconnected
+	}
+	if category != "" {
+		for _, i := range candidates {
+			if slices.Contains(b.list[i].Categories, category) {
+				return i, nil
+			}
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0], nil
+	}
+
+	switch b.placement {
+	case PlacementRoundRobin:
+		return candidates[(b.next.Add(1)-1)%uint64(len(candidates))], nil
+	case PlacementLeastLoaded:
+		counts := make([]int, len(b.list))
+		ok, err := b.eachConnected(func(index int, backend *Backend) error {
+			torrents, err := backend.TR.TorrentGet(ctx, []string{"id"}, nil)
+			counts[index] = len(torrents)
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+		least := -1
+		for i, count := range counts {
+			if ok[i] && (least < 0 || count < counts[least]) {
+				least = i
+			}
+		}
+		return least, nil
+	default:
+		return candidates[0], nil
+	}
+}
@@ -0,0 +1,83 @@
+package data
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"transmission-proxy/conf"
+	"transmission-proxy/internal/domain"
+
+	"github.com/go-kratos/kratos/v2/encoding"
+)
+
+const (
+	BanInfosFileName = "bans.json"
+
+	// BanInfosVersion 当前封禁信息文件的版本
+	BanInfosVersion = 1
+)
+
+// BanInfos 通过管理接口封禁的ip的附加信息（写盘）
+type BanInfos struct {
+	Version int                `json:"version"` // 文件版本
+	Bans    map[string]BanInfo `json:"bans"`    // key: <ip>
+}
+
+// BanInfo 封禁的ip的附加信息
+type BanInfo struct {
+	Reason    string `json:"reason,omitempty"`
+	ExpiresAt int64  `json:"expires_at,omitempty"` // 到期时间（Unix 秒），永久封禁时为 0
+}
+
+// banInfosPath 封禁信息文件路径
+func banInfosPath() string {
+	return filepath.Join(conf.FlagConf, BanInfosFileName)
+}
+
+// GetBanInfos 获取通过管理接口封禁的ip的附加信息，文件不存在时返回空
+func (d *banIPDao) GetBanInfos(_ context.Context) (map[string]domain.BanInfo, error) {
+	infos := make(map[string]domain.BanInfo)
+	data, err := os.ReadFile(banInfosPath())
+	if os.IsNotExist(err) {
+		return infos, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var bi BanInfos
+	err = encoding.GetCodec("json").Unmarshal(data, &bi)
+	if err != nil {
+		return nil, err
+	}
+	for ip, info := range bi.Bans {
+		banInfo := domain.BanInfo{Reason: info.Reason}
+		if info.ExpiresAt > 0 {
+			banInfo.ExpiresAt = time.Unix(info.ExpiresAt, 0)
+		}
+		infos[ip] = banInfo
+	}
+	return infos, nil
+}
+
+// SaveBanInfos 保存通过管理接口封禁的ip的附加信息
+func (d *banIPDao) SaveBanInfos(_ context.Context, infos map[string]domain.BanInfo) error {
+	bi := BanInfos{
+		Version: BanInfosVersion,
+		Bans:    make(map[string]BanInfo, len(infos)),
+	}
+	for ip, info := range infos {
+		banInfo := BanInfo{Reason: info.Reason}
+		if !info.ExpiresAt.IsZero() {
+			banInfo.ExpiresAt = info.ExpiresAt.Unix()
+		}
+		bi.Bans[ip] = banInfo
+	}
+	data, err := encoding.GetCodec("json").Marshal(&bi)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(banInfosPath(), data, 0644)
+}
@@ -2,12 +2,17 @@ package data
 
 import (
 	"context"
-	"github.com/go-kratos/kratos/v2/log"
-	"github.com/google/nftables"
-	col "github.com/noxiouz/golang-generics-util/collection"
+	"fmt"
 	"net"
+	"sync"
 	"time"
+
 	"transmission-proxy/internal/domain"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/nftables"
+	col "github.com/noxiouz/golang-generics-util/collection"
+	"go.opentelemetry.io/otel/codes"
 )
 
 type banIPDao struct {
@@ -19,6 +24,9 @@ type banIPDao struct {
 
 	// banlistIPV6 IPV6黑名单列表
 	banlistIPV6 map[string]time.Time
+
+	// mutex 保护黑名单列表，nftables 的修改与提交也需要互斥
+	mutex sync.RWMutex
 }
 
 // NewBanIPDao .
@@ -34,6 +42,9 @@ func NewBanIPDao(infra *Infra, logger log.Logger) domain.BanIPRepo {
 
 // GetBannedIPV4Status 获取封禁ipv4状态
 func (d *banIPDao) GetBannedIPV4Status(_ context.Context, ips []string) (map[string]col.Option[*time.Time], error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
 	statuses := make(map[string]col.Option[*time.Time], len(ips))
 	for _, ip := range ips {
 		banTime, ok := d.banlistIPV4[ip]
@@ -48,6 +59,9 @@ func (d *banIPDao) GetBannedIPV4Status(_ context.Context, ips []string) (map[str
 
 // GetBannedIPV6Status 获取封禁ipv6状态
 func (d *banIPDao) GetBannedIPV6Status(_ context.Context, ips []string) (map[string]col.Option[*time.Time], error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
 	statuses := make(map[string]col.Option[*time.Time], len(ips))
 	for _, ip := range ips {
 		banTime, ok := d.banlistIPV6[ip]
@@ -61,7 +75,13 @@ func (d *banIPDao) GetBannedIPV6Status(_ context.Context, ips []string) (map[str
 }
 
 // BanIPV4 封禁ipv4
-func (d *banIPDao) BanIPV4(_ context.Context, ips []string) error {
+func (d *banIPDao) BanIPV4(ctx context.Context, ips []string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.banIPV4(ctx, ips)
+}
+
+func (d *banIPDao) banIPV4(ctx context.Context, ips []string) error {
 	readyIP := make([]net.IP, 0, len(ips))
 	for _, ip := range ips {
 		netIP := net.ParseIP(ip)
@@ -78,7 +98,7 @@ func (d *banIPDao) BanIPV4(_ context.Context, ips []string) error {
 	if err != nil {
 		return err
 	}
-	if err := d.infra.NFT.Flush(); err != nil {
+	if err := d.flush(ctx); err != nil {
 		return err
 	}
 
@@ -86,11 +106,19 @@ func (d *banIPDao) BanIPV4(_ context.Context, ips []string) error {
 	for _, netIP := range readyIP {
 		d.banlistIPV4[netIP.String()] = nowTime
 	}
+	banOperations.WithLabelValues(ipFamilyV4, banOperationBan).Add(float64(len(readyIP)))
+	bannedIPs.WithLabelValues(ipFamilyV4).Set(float64(len(d.banlistIPV4)))
 	return nil
 }
 
 // BanIPV6 封禁ipv6
-func (d *banIPDao) BanIPV6(_ context.Context, ips []string) error {
+func (d *banIPDao) BanIPV6(ctx context.Context, ips []string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.banIPV6(ctx, ips)
+}
+
+func (d *banIPDao) banIPV6(ctx context.Context, ips []string) error {
 	readyIP := make([]net.IP, 0, len(ips))
 	for _, ip := range ips {
 		ipNet := net.ParseIP(ip)
@@ -107,19 +135,27 @@ func (d *banIPDao) BanIPV6(_ context.Context, ips []string) error {
 	if err != nil {
 		return err
 	}
-	if err := d.infra.NFT.Flush(); err != nil {
+	if err := d.flush(ctx); err != nil {
 		return err
 	}
 
 	nowTime := time.Now()
 	for _, netIP := range readyIP {
-		d.banlistIPV4[netIP.String()] = nowTime
+		d.banlistIPV6[netIP.String()] = nowTime
 	}
+	banOperations.WithLabelValues(ipFamilyV6, banOperationBan).Add(float64(len(readyIP)))
+	bannedIPs.WithLabelValues(ipFamilyV6).Set(float64(len(d.banlistIPV6)))
 	return nil
 }
 
 // UnbanIPV4 解禁ipv4
-func (d *banIPDao) UnbanIPV4(_ context.Context, ips []string) error {
+func (d *banIPDao) UnbanIPV4(ctx context.Context, ips []string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.unbanIPV4(ctx, ips)
+}
+
+func (d *banIPDao) unbanIPV4(ctx context.Context, ips []string) error {
 	readyIP := make([]net.IP, 0, len(ips))
 	for _, ip := range ips {
 		netIP := net.ParseIP(ip)
@@ -136,18 +172,26 @@ func (d *banIPDao) UnbanIPV4(_ context.Context, ips []string) error {
 	if err != nil {
 		return err
 	}
-	if err := d.infra.NFT.Flush(); err != nil {
+	if err := d.flush(ctx); err != nil {
 		return err
 	}
 
 	for _, netIP := range readyIP {
-		d.banlistIPV4[netIP.String()] = time.Now()
+		delete(d.banlistIPV4, netIP.String())
 	}
+	banOperations.WithLabelValues(ipFamilyV4, banOperationUnban).Add(float64(len(readyIP)))
+	bannedIPs.WithLabelValues(ipFamilyV4).Set(float64(len(d.banlistIPV4)))
 	return nil
 }
 
 // UnbanIPV6 解禁ipv6
-func (d *banIPDao) UnbanIPV6(_ context.Context, ips []string) error {
+func (d *banIPDao) UnbanIPV6(ctx context.Context, ips []string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.unbanIPV6(ctx, ips)
+}
+
+func (d *banIPDao) unbanIPV6(ctx context.Context, ips []string) error {
 	readyIP := make([]net.IP, 0, len(ips))
 	for _, ip := range ips {
 		ipNet := net.ParseIP(ip)
@@ -164,17 +208,22 @@ func (d *banIPDao) UnbanIPV6(_ context.Context, ips []string) error {
 	if err != nil {
 		return err
 	}
-	if err := d.infra.NFT.Flush(); err != nil {
+	if err := d.flush(ctx); err != nil {
 		return err
 	}
 
 	for _, netIP := range readyIP {
-		d.banlistIPV4[netIP.String()] = time.Now()
+		delete(d.banlistIPV6, netIP.String())
 	}
+	banOperations.WithLabelValues(ipFamilyV6, banOperationUnban).Add(float64(len(readyIP)))
+	bannedIPs.WithLabelValues(ipFamilyV6).Set(float64(len(d.banlistIPV6)))
 	return nil
 }
 
 func (d *banIPDao) UpBanIPV4List(ctx context.Context, ips []string) (err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
 	ipSet := make(map[string]struct{}, len(ips))
 	for _, ip := range ips {
 		ipSet[ip] = struct{}{}
@@ -193,11 +242,11 @@ func (d *banIPDao) UpBanIPV4List(ctx context.Context, ips []string) (err error)
 			readyRemove = append(readyRemove, ip)
 		}
 	}
-	err = d.BanIPV4(ctx, readyAdd)
+	err = d.banIPV4(ctx, readyAdd)
 	if err != nil {
 		return
 	}
-	err = d.UnbanIPV4(ctx, readyRemove)
+	err = d.unbanIPV4(ctx, readyRemove)
 	if err != nil {
 		return err
 	}
@@ -205,6 +254,9 @@ func (d *banIPDao) UpBanIPV4List(ctx context.Context, ips []string) (err error)
 }
 
 func (d *banIPDao) UpBanIPV6List(ctx context.Context, ips []string) (err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
 	ipSet := make(map[string]struct{}, len(ips))
 	for _, ip := range ips {
 		ipSet[ip] = struct{}{}
@@ -223,11 +275,11 @@ func (d *banIPDao) UpBanIPV6List(ctx context.Context, ips []string) (err error)
 			readyRemove = append(readyRemove, ip)
 		}
 	}
-	err = d.BanIPV4(ctx, readyAdd)
+	err = d.banIPV6(ctx, readyAdd)
 	if err != nil {
 		return
 	}
-	err = d.UnbanIPV4(ctx, readyRemove)
+	err = d.unbanIPV6(ctx, readyRemove)
 	if err != nil {
 		return err
 	}
@@ -235,20 +287,99 @@ func (d *banIPDao) UpBanIPV6List(ctx context.Context, ips []string) (err error)
 }
 
 // ClearBanList 清空Ban列表
-func (d *banIPDao) ClearBanList(_ context.Context) (err error) {
+func (d *banIPDao) ClearBanList(ctx context.Context) (err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// 清空 set 中的元素，set 被封禁规则引用，删除时 nftables 返回 EBUSY
+	d.infra.NFT.FlushSet(BanIPV4Set)
+	d.infra.NFT.FlushSet(BanIPV6Set)
+	err = d.flush(ctx)
+	if err != nil {
+		return
+	}
 	d.banlistIPV4 = make(map[string]time.Time, len(d.banlistIPV4))
 	d.banlistIPV6 = make(map[string]time.Time, len(d.banlistIPV6))
-	// 重置 set
-	d.infra.NFT.DelSet(BanIPV4Set)
-	d.infra.NFT.DelSet(BanIPV6Set)
-	err = d.infra.NFT.AddSet(BanIPV4Set, nil)
+	bannedIPs.WithLabelValues(ipFamilyV4).Set(0)
+	bannedIPs.WithLabelValues(ipFamilyV6).Set(0)
+	return
+}
+
+// GetBannedIPs 获取所有封禁的ip
+func (d *banIPDao) GetBannedIPs(_ context.Context) ([]domain.BannedIP, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	bannedIPs := make([]domain.BannedIP, 0, len(d.banlistIPV4)+len(d.banlistIPV6))
+	for ip, banTime := range d.banlistIPV4 {
+		bannedIPs = append(bannedIPs, domain.BannedIP{IP: ip, BannedAt: banTime})
+	}
+	for ip, banTime := range d.banlistIPV6 {
+		bannedIPs = append(bannedIPs, domain.BannedIP{IP: ip, BannedAt: banTime})
+	}
+	return bannedIPs, nil
+}
+
+// CheckTables 检查 nftables 中的封禁表是否存在
+func (d *banIPDao) CheckTables(_ context.Context) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	_, err := d.infra.NFT.GetSetByName(BanIPV4Table, BanIPV4SetName)
 	if err != nil {
-		return
+		return err
 	}
-	err = d.infra.NFT.AddSet(BanIPV6Set, nil)
+	_, err = d.infra.NFT.GetSetByName(BanIPV6Table, BanIPV6SetName)
+	return err
+}
+
+// flush 提交 nftables 更改
+func (d *banIPDao) flush(ctx context.Context) error {
+	_, span := tracer.Start(ctx, "nftables flush")
+	defer span.End()
+	err := d.infra.NFT.Flush()
 	if err != nil {
-		return
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 	}
-	err = d.infra.NFT.Flush()
-	return
+	return err
+}
+
+// NewLocalBanIPDao 直接修改正在运行的代理创建的 nftables 封禁表
+// 封禁表不存在时返回错误，已有的封禁从 nftables 中读取，没有封禁时间
+func NewLocalBanIPDao(logger log.Logger) (domain.BanIPRepo, error) {
+	nft, err := nftables.New()
+	if err != nil {
+		return nil, err
+	}
+	d := &banIPDao{
+		infra: &Infra{NFT: nft},
+		log:   log.NewHelper(logger),
+	}
+	d.banlistIPV4, err = loadBanSet(nft, BanIPV4Table, BanIPV4SetName)
+	if err != nil {
+		return nil, err
+	}
+	d.banlistIPV6, err = loadBanSet(nft, BanIPV6Table, BanIPV6SetName)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// loadBanSet 读取 nftables 封禁 set 中的ip
+func loadBanSet(nft *nftables.Conn, table *nftables.Table, name string) (map[string]time.Time, error) {
+	set, err := nft.GetSetByName(table, name)
+	if err != nil {
+		return nil, fmt.Errorf("读取 nftables 封禁表 %s 失败，代理是否正在运行: %w", name, err)
+	}
+	elements, err := nft.GetSetElements(set)
+	if err != nil {
+		return nil, err
+	}
+	banlist := make(map[string]time.Time, len(elements))
+	for _, element := range elements {
+		banlist[net.IP(element.Key).String()] = time.Time{}
+	}
+	return banlist, nil
 }
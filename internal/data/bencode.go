@@ -0,0 +1,124 @@
+package data
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// pieceHashSize 种子片段 SHA1 哈希长度（字节）
+const pieceHashSize = 20
+
+var errBencodeInvalid = errors.New("无效的 bencode 数据")
+
+// parseTorrentPieceHashes 从种子文件中解析片段哈希
+func parseTorrentPieceHashes(data []byte) ([]string, error) {
+	value, _, err := decodeBencode(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := value.(map[string]any)
+	if !ok {
+		return nil, errBencodeInvalid
+	}
+	info, ok := root["info"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: 缺少 info", errBencodeInvalid)
+	}
+	pieces, ok := info["pieces"].([]byte)
+	if !ok || len(pieces)%pieceHashSize != 0 {
+		return nil, fmt.Errorf("%w: 无效的 pieces", errBencodeInvalid)
+	}
+
+	hashes := make([]string, 0, len(pieces)/pieceHashSize)
+	for i := 0; i < len(pieces); i = i + pieceHashSize {
+		hashes = append(hashes, hex.EncodeToString(pieces[i:i+pieceHashSize]))
+	}
+	return hashes, nil
+}
+
+// decodeBencode 解码 bencode 数据，返回解码后的值和下一个值的位置
+// 字符串解码为 []byte，整数解码为 int64
+func decodeBencode(data []byte, pos int) (any, int, error) {
+	if pos >= len(data) {
+		return nil, pos, errBencodeInvalid
+	}
+
+	switch c := data[pos]; {
+	case c == 'i':
+		end := indexByte(data, pos+1, 'e')
+		if end < 0 {
+			return nil, pos, errBencodeInvalid
+		}
+		n, err := strconv.ParseInt(string(data[pos+1:end]), 10, 64)
+		if err != nil {
+			return nil, pos, errBencodeInvalid
+		}
+		return n, end + 1, nil
+
+	case c == 'l':
+		list := make([]any, 0)
+		pos = pos + 1
+		for pos < len(data) && data[pos] != 'e' {
+			var item any
+			var err error
+			item, pos, err = decodeBencode(data, pos)
+			if err != nil {
+				return nil, pos, err
+			}
+			list = append(list, item)
+		}
+		if pos >= len(data) {
+			return nil, pos, errBencodeInvalid
+		}
+		return list, pos + 1, nil
+
+	case c == 'd':
+		dict := make(map[string]any)
+		pos = pos + 1
+		for pos < len(data) && data[pos] != 'e' {
+			var key, item any
+			var err error
+			key, pos, err = decodeBencode(data, pos)
+			if err != nil {
+				return nil, pos, err
+			}
+			keyBytes, ok := key.([]byte)
+			if !ok {
+				return nil, pos, errBencodeInvalid
+			}
+			item, pos, err = decodeBencode(data, pos)
+			if err != nil {
+				return nil, pos, err
+			}
+			dict[string(keyBytes)] = item
+		}
+		if pos >= len(data) {
+			return nil, pos, errBencodeInvalid
+		}
+		return dict, pos + 1, nil
+
+	case c >= '0' && c <= '9':
+		colon := indexByte(data, pos, ':')
+		if colon < 0 {
+			return nil, pos, errBencodeInvalid
+		}
+		size, err := strconv.Atoi(string(data[pos:colon]))
+		// 与剩余长度比较，避免超大的长度前缀相加后溢出
+		if err != nil || size < 0 || size > len(data)-colon-1 {
+			return nil, pos, errBencodeInvalid
+		}
+		return data[colon+1 : colon+1+size], colon + 1 + size, nil
+	}
+	return nil, pos, errBencodeInvalid
+}
+
+func indexByte(data []byte, start int, b byte) int {
+	for i := start; i < len(data); i++ {
+		if data[i] == b {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,106 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDecodeBencode(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data string
+		want any
+		next int
+	}{
+		{"string", "4:spam", []byte("spam"), 6},
+		{"empty string", "0:", []byte{}, 2},
+		{"int", "i42e", int64(42), 4},
+		{"negative int", "i-3e", int64(-3), 4},
+		{"list", "l4:spami42ee", []any{[]byte("spam"), int64(42)}, 12},
+		{"nested list", "lli1eelee", []any{[]any{int64(1)}, []any{}}, 9},
+		{"dict", "d3:cow3:moo4:spami1ee", map[string]any{"cow": []byte("moo"), "spam": int64(1)}, 21},
+		{"nested dict", "d4:infod6:lengthi1eee",
+			map[string]any{"info": map[string]any{"length": int64(1)}}, 21},
+		{"trailing data", "i1ei2e", int64(1), 3},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, next, err := decodeBencode([]byte(tt.data), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) || next != tt.next {
+				t.Errorf("decodeBencode(%q) = %#v, %d, want %#v, %d", tt.data, got, next, tt.want, tt.next)
+			}
+		})
+	}
+}
+
+func TestDecodeBencodeInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"unknown type", "x"},
+		{"truncated string", "5:spam"},
+		{"string without colon", "4spam"},
+		{"negative length", "-1:a"},
+		{"signed length", "0-1:a"},
+		{"huge length", strconv.Itoa(int(^uint(0)>>1)) + ":spam"},
+		{"length overflows int", "99999999999999999999999:spam"},
+		{"truncated int", "i42"},
+		{"invalid int", "i4x2e"},
+		{"truncated list", "l4:spam"},
+		{"truncated nested list", "lli1ee"},
+		{"truncated dict", "d3:cow3:moo"},
+		{"dict without value", "d3:cowe"},
+		{"dict with int key", "di1e3:mooe"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := decodeBencode([]byte(tt.data), 0)
+			if !errors.Is(err, errBencodeInvalid) {
+				t.Errorf("decodeBencode(%q) err = %v, want %v", tt.data, err, errBencodeInvalid)
+			}
+		})
+	}
+}
+
+func TestParseTorrentPieceHashes(t *testing.T) {
+	piece := func(b byte) string {
+		return strings.Repeat(string([]byte{b}), pieceHashSize)
+	}
+	torrent := func(pieces string) []byte {
+		return []byte("d8:announce3:url4:infod6:lengthi1e6:pieces" +
+			strconv.Itoa(len(pieces)) + ":" + pieces + "ee")
+	}
+
+	hashes, err := parseTorrentPieceHashes(torrent(piece(0x01) + piece(0xab)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{strings.Repeat("01", pieceHashSize), strings.Repeat("ab", pieceHashSize)}
+	if !reflect.DeepEqual(hashes, want) {
+		t.Errorf("hashes = %v, want %v", hashes, want)
+	}
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"pieces not a multiple of 20", torrent(piece(0x01) + "abc")},
+		{"pieces not a string", []byte("d4:infod6:piecesi1eee")},
+		{"missing info", []byte("d8:announce3:urle")},
+		{"info not a dict", []byte("d4:info3:urle")},
+		{"root not a dict", []byte("l4:infoe")},
+		{"truncated", torrent(piece(0x01))[:30]},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseTorrentPieceHashes(tt.data); !errors.Is(err, errBencodeInvalid) {
+				t.Errorf("err = %v, want %v", err, errBencodeInvalid)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package data
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+
+	"github.com/google/nftables"
+	"github.com/hekmon/transmissionrpc/v3"
+)
+
+// fetchStatusPattern tr 下载种子文件失败时错误信息中的 HTTP 状态码
+// tr 3 为 "http error 404: Not Found"，tr 4 为 "Couldn't fetch torrent: Not Found (404)"
+// 没有收到响应时状态码为 0
+var fetchStatusPattern = regexp.MustCompile(`http error (\d+)|fetch torrent: .*\((\d+)\)`)
+
+// CheckNFTables 检查是否有权限读取 nftables
+func CheckNFTables() error {
+	nft, err := nftables.New()
+	if err != nil {
+		return err
+	}
+	_, err = nft.ListTables()
+	return err
+}
+
+// ProbeTorrentURL 让 tr 从 url 下载种子文件，检查 tr 能否访问代理
+// url 应该指向不存在的种子文件，tr 收到任何 HTTP 响应都说明可以访问，返回响应的状态码
+// tr 没有收到响应时返回 0 与 tr 的错误
+func (b *Backend) ProbeTorrentURL(ctx context.Context, url string) (int, error) {
+	paused := true
+	_, err := b.TR.TorrentAdd(ctx, transmissionrpc.TorrentAddPayload{
+		Filename: &url,
+		Paused:   &paused,
+	})
+	if err == nil {
+		return 200, nil
+	}
+	match := fetchStatusPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return 0, err
+	}
+	statusCode, _ := strconv.Atoi(match[1] + match[2])
+	if statusCode == 0 {
+		return 0, err
+	}
+	return statusCode, nil
+}
@@ -0,0 +1,49 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic 原子地写入文件
+// 先写入同目录下的临时文件并同步到磁盘，再重命名覆盖目标文件，写入过程中崩溃不会损坏原文件
+func writeFileAtomic(path string, data []byte, perm os.FileMode) (err error) {
+	dir := filepath.Dir(path)
+	file, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return
+	}
+	tmpPath := file.Name()
+	defer func() {
+		if err != nil {
+			_ = file.Close()
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err = file.Write(data); err != nil {
+		return
+	}
+	if err = file.Chmod(perm); err != nil {
+		return
+	}
+	if err = file.Sync(); err != nil {
+		return
+	}
+	if err = file.Close(); err != nil {
+		return
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		return
+	}
+
+	// 同步目录，保证重命名落盘
+	dirFile, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = dirFile.Close()
+	}()
+	return dirFile.Sync()
+}
@@ -0,0 +1,117 @@
+package data
+
+import (
+	"context"
+	"net"
+
+	"transmission-proxy/internal/domain"
+
+	"github.com/dgraph-io/ristretto"
+	gocache "github.com/eko/gocache/lib/v4/cache"
+	"github.com/eko/gocache/lib/v4/store"
+	ristrettostore "github.com/eko/gocache/store/ristretto/v4"
+	"github.com/go-kratos/kratos/v2/log"
+	col "github.com/noxiouz/golang-generics-util/collection"
+)
+
+// GeoIPCacheSize GeoIP查询结果缓存数量
+const GeoIPCacheSize = 50000
+
+// geoIPRecord mmdb 中的国家信息
+// MaxMind 与 DB-IP 的数据库使用相同的结构
+type geoIPRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"registered_country"`
+}
+
+type geoIPDao struct {
+	infra *Infra
+	log   *log.Helper
+
+	// cache key: <ip> 没有记录的IP缓存为空的国家
+	cache *gocache.Cache[*domain.Country]
+}
+
+// NewGeoIPDao .
+func NewGeoIPDao(infra *Infra, logger log.Logger) (domain.GeoIPRepo, error) {
+	cacheConf, err := ristretto.NewCache(&ristretto.Config{
+		NumCounters: GeoIPCacheSize * 10, // 缓存数量的10倍
+		MaxCost:     GeoIPCacheSize,      // 每个结果计为1
+		BufferItems: 64,                  // number of keys per Get buffer.
+	})
+	if err != nil {
+		return nil, err
+	}
+	cacheStore := ristrettostore.NewRistretto(
+		cacheConf,
+		store.WithCost(1),
+	)
+
+	return &geoIPDao{
+		infra: infra,
+		log:   log.NewHelper(logger),
+		cache: gocache.New[*domain.Country](cacheStore),
+	}, nil
+}
+
+// IsEnabled 是否配置了 GeoIP 数据库
+func (d *geoIPDao) IsEnabled(_ context.Context) bool {
+	return d.infra.GeoIP != nil
+}
+
+// LookupCountry 查询IP所属国家
+func (d *geoIPDao) LookupCountry(ctx context.Context, ip string) (col.Option[*domain.Country], error) {
+	if d.infra.GeoIP == nil {
+		return col.None[*domain.Country](), nil
+	}
+
+	country, err := d.cache.Get(ctx, ip)
+	if err != nil && !CacheNotFoundErr.Is(err) {
+		return col.None[*domain.Country](), err
+	}
+	if err != nil {
+		country, err = d.lookup(ip)
+		if err != nil {
+			return col.None[*domain.Country](), err
+		}
+		err = d.cache.Set(ctx, ip, country)
+		if err != nil {
+			return col.None[*domain.Country](), err
+		}
+	}
+
+	if country.Code == "" {
+		return col.None[*domain.Country](), nil
+	}
+	return col.Some(country), nil
+}
+
+// lookup 从数据库中查询IP所属国家
+func (d *geoIPDao) lookup(ip string) (*domain.Country, error) {
+	country := &domain.Country{}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return country, nil
+	}
+
+	var record geoIPRecord
+	err := d.infra.GeoIP.Lookup(addr, &record)
+	if err != nil {
+		return nil, err
+	}
+
+	// 没有国家信息时（如卫星、匿名代理）使用注册国家
+	country.Code = record.Country.ISOCode
+	country.Name = record.Country.Names["en"]
+	if country.Code == "" {
+		country.Code = record.RegisteredCountry.ISOCode
+		country.Name = record.RegisteredCountry.Names["en"]
+	}
+	return country, nil
+}
@@ -1,14 +1,10 @@
 package data
 
 import (
-	"context"
-	"errors"
-	"fmt"
-	"net/url"
+	"path/filepath"
 	"time"
 
 	"transmission-proxy/conf"
-	"transmission-proxy/internal/domain"
 
 	"github.com/dgraph-io/ristretto"
 	gocache "github.com/eko/gocache/lib/v4/cache"
@@ -18,7 +14,8 @@ import (
 	"github.com/google/nftables"
 	"github.com/google/nftables/expr"
 	"github.com/google/wire"
-	"github.com/hekmon/transmissionrpc/v3"
+	"github.com/oschwald/maxminddb-golang"
+	"go.etcd.io/bbolt"
 )
 
 // ProviderSet is service providers.
@@ -27,10 +24,15 @@ var ProviderSet = wire.NewSet(
 	NewAppDao,
 	NewBanIPDao,
 	NewTorrentDao,
+	NewGeoIPDao,
+	NewTrafficDao,
 )
 
-// PeerCacheSize Peer缓存大小
-const PeerCacheSize = 1 << 20 // 1M内存
+// PeerStoreSize Peer存储数量上限
+const PeerStoreSize = 50000
+
+// DefaultRequestInterval 配置文件中没有设置 request_interval 时刷新 tr 数据的时间间隔
+const DefaultRequestInterval = 10 * time.Second
 
 var (
 	BanIPV4SetName = "trp_black_ipv4"
@@ -163,46 +165,41 @@ var (
 
 // Infra .
 type Infra struct {
-	TR  *transmissionrpc.Client
-	NFT *nftables.Conn
+	// Backends 所有的 tr 后端
+	Backends *Backends
+	NFT      *nftables.Conn
 
-	// PeerCache key: <hash:ip:port>
-	PeerCache *gocache.Cache[*domain.Peer]
+	// PeerStore key: <hash:ip:port>
+	PeerStore *PeerStore
 
 	// TmpTorrentFileData 临时种子文件缓存
 	TmpTorrentFileData *gocache.Cache[[]byte]
 
+	// GeoIP 离线 GeoIP 数据库，未配置时为 nil
+	GeoIP *maxminddb.Reader
+
+	// Traffic 流量统计数据库
+	Traffic *bbolt.DB
+
 	stateRefreshInterval int64
 }
 
+// requestInterval 刷新 tr 数据的时间间隔，配置文件中没有设置时使用 DefaultRequestInterval
+func requestInterval(bootstrap *conf.Bootstrap) time.Duration {
+	interval := bootstrap.GetInfra().GetTr().GetRequestInterval()
+	if interval == nil {
+		return DefaultRequestInterval
+	}
+	return interval.AsDuration()
+}
+
 // NewInfra .
 func NewInfra(bootstrap *conf.Bootstrap, logger log.Logger) (*Infra, func(), error) {
 	config := bootstrap.GetInfra()
-	stateRefreshInterval := bootstrap.GetInfra().GetTr().GetRequestInterval().AsDuration().Seconds()
+	stateRefreshInterval := requestInterval(bootstrap).Seconds()
 
 	ll := log.NewHelper(logger)
 
-	endpoint, err := url.Parse(config.GetTr().GetRpcUrl())
-	if err != nil {
-		return nil, nil, err
-	}
-	tr, err := transmissionrpc.New(endpoint, nil)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	ok, rpcVersion, rpcMinimumVersion, err := tr.RPCVersion(context.Background())
-	if err != nil {
-		return nil, nil, err
-	}
-	if !ok {
-		return nil, nil, errors.New(
-			fmt.Sprintf("远程传输 RPC 版本 (v%d) 与传输库 (v%d) 不兼容：远程至少需要 v%d",
-				rpcVersion, transmissionrpc.RPCVersion, rpcMinimumVersion),
-		)
-	}
-	ll.Infof("远程传输 RPC 版本: v%d", rpcVersion)
-
 	// 创建 nftables 句柄
 	nft, err := nftables.New()
 	if err != nil {
@@ -241,45 +238,49 @@ func NewInfra(bootstrap *conf.Bootstrap, logger log.Logger) (*Infra, func(), err
 	}
 
 	// 创建缓存
-	peerCacheConf, err := ristretto.NewCache(&ristretto.Config{
-		NumCounters: 50000,         // 缓存数量
-		MaxCost:     PeerCacheSize, // 最大缓存容量(字节, 1M内存)
-		BufferItems: 64,            // number of keys per Get buffer.
-	})
+	tmpTorrentCache, err := newTmpTorrentCache()
 	if err != nil {
 		return nil, nil, err
 	}
-	peerCacheStore := ristrettostore.NewRistretto(
-		peerCacheConf,
-	)
-	peerCache := gocache.New[*domain.Peer](peerCacheStore)
 
-	// 创建缓存
-	tmpTorrentCacheConf, err := ristretto.NewCache(&ristretto.Config{
-		NumCounters: 100,     // 缓存数量
-		MaxCost:     1 << 30, // 最大缓存容量(字节, 1G内存)
-		BufferItems: 64,      // number of keys per Get buffer.
+	// 打开 GeoIP 数据库
+	var geoIP *maxminddb.Reader
+	if path := config.GetGeoip().GetDatabasePath(); path != "" {
+		geoIP, err = maxminddb.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		ll.Infof("GeoIP 数据库: %s (%s)", path, geoIP.Metadata.DatabaseType)
+	}
+
+	// 打开流量统计数据库
+	traffic, err := bbolt.Open(filepath.Join(conf.FlagConf, TrafficDBFileName), 0644, &bbolt.Options{
+		Timeout: time.Second,
 	})
 	if err != nil {
 		return nil, nil, err
 	}
-	tmpTorrentStore := ristrettostore.NewRistretto(
-		tmpTorrentCacheConf,
-		store.WithExpiration(10*time.Minute), // 默认过期时间 1分钟
-	)
-	tmpTorrentCache := gocache.New[[]byte](tmpTorrentStore)
+
+	// 连接 tr 后端
+	backends, err := newBackends(config.GetTr(), ll)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	infra := &Infra{
-		TR:                   tr,
+		Backends:             backends,
 		NFT:                  nft,
-		PeerCache:            peerCache,
+		PeerStore:            NewPeerStore(PeerStoreSize),
 		TmpTorrentFileData:   tmpTorrentCache,
+		GeoIP:                geoIP,
+		Traffic:              traffic,
 		stateRefreshInterval: int64(stateRefreshInterval),
 	}
 
 	cleanup := func() {
 		var err error
 		ll.Info("closing the infra resources")
+		backends.Close()
 		nft.DelChain(BanIPV4InputChain)
 		nft.DelChain(BanIPV4OutputChain)
 		nft.DelChain(BanIPV6InputChain)
@@ -293,7 +294,54 @@ func NewInfra(bootstrap *conf.Bootstrap, logger log.Logger) (*Infra, func(), err
 			ll.Errorf("clean NFT sending error: %v", err)
 		}
 
+		if err = traffic.Close(); err != nil {
+			ll.Errorf("close traffic database error: %v", err)
+		}
+
+		if geoIP != nil {
+			if err = geoIP.Close(); err != nil {
+				ll.Errorf("close GeoIP database error: %v", err)
+			}
+		}
+
 		ll.Info("completion of Infra resource closure")
 	}
 	return infra, cleanup, nil
 }
+
+// NewTRInfra 只连接 tr 的 Infra，不创建 nftables、GeoIP 与流量统计数据库
+// 用于在没有特权的环境中使用真实的 tr 仓储，例如对接模拟的 tr RPC 服务器
+func NewTRInfra(bootstrap *conf.Bootstrap, logger log.Logger) (*Infra, func(), error) {
+	ll := log.NewHelper(logger)
+	tmpTorrentCache, err := newTmpTorrentCache()
+	if err != nil {
+		return nil, nil, err
+	}
+	backends, err := newBackends(bootstrap.GetInfra().GetTr(), ll)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &Infra{
+		Backends:             backends,
+		PeerStore:            NewPeerStore(PeerStoreSize),
+		TmpTorrentFileData:   tmpTorrentCache,
+		stateRefreshInterval: int64(requestInterval(bootstrap).Seconds()),
+	}, backends.Close, nil
+}
+
+// newTmpTorrentCache 创建临时种子文件缓存
+func newTmpTorrentCache() (*gocache.Cache[[]byte], error) {
+	tmpTorrentCacheConf, err := ristretto.NewCache(&ristretto.Config{
+		NumCounters: 100,     // 缓存数量
+		MaxCost:     1 << 30, // 最大缓存容量(字节, 1G内存)
+		BufferItems: 64,      // number of keys per Get buffer.
+	})
+	if err != nil {
+		return nil, err
+	}
+	tmpTorrentStore := ristrettostore.NewRistretto(
+		tmpTorrentCacheConf,
+		store.WithExpiration(10*time.Minute), // 默认过期时间 1分钟
+	)
+	return gocache.New[[]byte](tmpTorrentStore), nil
+}
@@ -0,0 +1,179 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"transmission-proxy/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// IP 族
+	ipFamilyV4 = "ipv4"
+	ipFamilyV6 = "ipv6"
+
+	// 封禁操作
+	banOperationBan   = "ban"
+	banOperationUnban = "unban"
+)
+
+// tracer 数据层的 Tracer
+var tracer = otel.Tracer("transmission-proxy/internal/data")
+
+var (
+	trRPCDuration = promauto.With(metrics.Registerer).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Name:      "transmission_rpc_duration_seconds",
+		Help:      "Transmission RPC 请求耗时（秒）",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"backend", "method"})
+
+	trRPCErrors = promauto.With(metrics.Registerer).NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "transmission_rpc_errors_total",
+		Help:      "Transmission RPC 请求失败次数",
+	}, []string{"backend", "method"})
+
+	trRPCRetries = promauto.With(metrics.Registerer).NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "transmission_rpc_retries_total",
+		Help:      "Transmission RPC 请求重试次数",
+	}, []string{"backend", "method"})
+
+	backendUp = promauto.With(metrics.Registerer).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Name:      "transmission_backend_up",
+		Help:      "Transmission 后端是否已连接",
+	}, []string{"backend"})
+
+	bannedIPs = promauto.With(metrics.Registerer).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Name:      "banned_ips",
+		Help:      "当前封禁的 IP 数量",
+	}, []string{"family"})
+
+	banOperations = promauto.With(metrics.Registerer).NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "ban_operations_total",
+		Help:      "封禁/解禁的 IP 数量",
+	}, []string{"family", "operation"})
+
+	trackerSubscriptionFetches = promauto.With(metrics.Registerer).NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "tracker_subscription_fetches_total",
+		Help:      "Tracker 订阅列表获取次数",
+	}, []string{"result"})
+
+	trackerSubscriptionLastSuccess = promauto.With(metrics.Registerer).NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Name:      "tracker_subscription_last_success_timestamp_seconds",
+		Help:      "最近一次成功获取 Tracker 订阅列表的时间（Unix 时间戳）",
+	})
+
+	trackerSubscriptionLines = promauto.With(metrics.Registerer).NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Name:      "tracker_subscription_lines",
+		Help:      "最近一次获取的 Tracker 订阅列表行数",
+	})
+)
+
+// trRPCTransport 记录 Transmission RPC 请求的指标与链路追踪
+type trRPCTransport struct {
+	backend string
+	next    http.RoundTripper
+}
+
+// newTRRPCHTTPClient 创建记录指标与链路追踪的 Transmission RPC HTTP 客户端
+func newTRRPCHTTPClient(backend string, next http.RoundTripper) *http.Client {
+	return &http.Client{
+		Transport: &trRPCTransport{
+			backend: backend,
+			next:    next,
+		},
+	}
+}
+
+// RoundTrip .
+func (t *trRPCTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	method := trRPCMethod(req)
+	ctx, span := tracer.Start(req.Context(), "transmission-rpc "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.method", method),
+			attribute.String("transmission.backend", t.backend),
+		),
+	)
+	defer span.End()
+	req = req.WithContext(ctx)
+
+	startTime := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	trRPCDuration.WithLabelValues(t.backend, method).Observe(time.Since(startTime).Seconds())
+	if err != nil {
+		trRPCErrors.WithLabelValues(t.backend, method).Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return resp, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+
+	// 409 用于刷新 CSRF Token，客户端会自动重试
+	if resp.StatusCode == http.StatusConflict {
+		return resp, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		trRPCErrors.WithLabelValues(t.backend, method).Inc()
+		span.SetStatus(codes.Error, resp.Status)
+		return resp, nil
+	}
+
+	// tr 在响应体的 result 字段中返回 RPC 错误
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		trRPCErrors.WithLabelValues(t.backend, method).Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	var payload struct {
+		Result string `json:"result"`
+	}
+	if json.Unmarshal(body, &payload) != nil || payload.Result != "success" {
+		trRPCErrors.WithLabelValues(t.backend, method).Inc()
+		span.SetStatus(codes.Error, payload.Result)
+	}
+	return resp, nil
+}
+
+// trRPCMethod 从请求体中获取 RPC 方法名
+func trRPCMethod(req *http.Request) string {
+	if req.GetBody == nil {
+		return "unknown"
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "unknown"
+	}
+	defer func() {
+		_ = body.Close()
+	}()
+	var payload struct {
+		Method string `json:"method"`
+	}
+	if json.NewDecoder(body).Decode(&payload) != nil || payload.Method == "" {
+		return "unknown"
+	}
+	return payload.Method
+}
@@ -0,0 +1,135 @@
+package data
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"transmission-proxy/internal/domain"
+)
+
+// PeerStore 有界的 Peer 存储
+// 超出容量时只淘汰不活跃的 Peer，活跃 Peer 的统计量不会因淘汰而丢失
+// 存储的 Peer 不会被修改，更新时需要写入新的 Peer
+type PeerStore struct {
+	mutex   sync.RWMutex
+	maxSize int
+	peers   map[domain.PeerKey]*peerEntry
+
+	// inactive 按最后活跃时间排序的不活跃 Peer，淘汰时从堆顶取出
+	inactive inactivePeers
+}
+
+// peerEntry 存储的 Peer
+type peerEntry struct {
+	key  domain.PeerKey
+	peer *domain.Peer
+	// index 在 inactive 中的位置，活跃时为 -1
+	index int
+}
+
+// NewPeerStore .
+func NewPeerStore(maxSize int) *PeerStore {
+	return &PeerStore{
+		maxSize: maxSize,
+		peers:   make(map[domain.PeerKey]*peerEntry, 1024),
+	}
+}
+
+// Get 获取Peer
+func (s *PeerStore) Get(key domain.PeerKey) (*domain.Peer, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	entry, ok := s.peers[key]
+	if !ok {
+		return nil, false
+	}
+	return entry.peer, true
+}
+
+// Set 设置Peer
+func (s *PeerStore) Set(key domain.PeerKey, peer *domain.Peer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry, exist := s.peers[key]
+	if !exist {
+		if len(s.peers) >= s.maxSize {
+			s.evictInactive(len(s.peers) - s.maxSize + 1)
+		}
+		entry = &peerEntry{key: key, index: -1}
+		s.peers[key] = entry
+	}
+	entry.peer = peer
+
+	switch {
+	case peer.IsActive && entry.index >= 0:
+		heap.Remove(&s.inactive, entry.index)
+	case !peer.IsActive && entry.index >= 0:
+		heap.Fix(&s.inactive, entry.index)
+	case !peer.IsActive:
+		heap.Push(&s.inactive, entry)
+	}
+}
+
+// Deactivate 将指定时间之前没有更新的Peer标记为不活跃
+// 已返回的Peer可能正在被读取，使用副本替换
+func (s *PeerStore) Deactivate(before time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, entry := range s.peers {
+		if entry.peer.IsActive && entry.peer.LastSeen.Before(before) {
+			inactivePeer := *entry.peer
+			inactivePeer.IsActive = false
+			entry.peer = &inactivePeer
+			heap.Push(&s.inactive, entry)
+		}
+	}
+}
+
+// Len Peer数量
+func (s *PeerStore) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.peers)
+}
+
+// evictInactive 按最后活跃时间淘汰不活跃的Peer
+// 没有足够的不活跃Peer时允许超出容量
+func (s *PeerStore) evictInactive(count int) {
+	for ; count > 0 && s.inactive.Len() > 0; count-- {
+		entry := heap.Pop(&s.inactive).(*peerEntry)
+		delete(s.peers, entry.key)
+	}
+}
+
+// inactivePeers 不活跃 Peer 的最小堆，LastSeen 最早的在堆顶
+type inactivePeers []*peerEntry
+
+func (h inactivePeers) Len() int {
+	return len(h)
+}
+
+func (h inactivePeers) Less(i, j int) bool {
+	return h[i].peer.LastSeen.Before(h[j].peer.LastSeen)
+}
+
+func (h inactivePeers) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *inactivePeers) Push(x any) {
+	entry := x.(*peerEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *inactivePeers) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	entry.index = -1
+	*h = old[:len(old)-1]
+	return entry
+}
@@ -0,0 +1,42 @@
+package data
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"transmission-proxy/internal/domain"
+)
+
+func TestPeerStoreEvictInactive(t *testing.T) {
+	now := time.Now()
+	key := func(i int) domain.PeerKey {
+		return domain.PeerKey{Hash: "hash", IP: "203.0.113." + strconv.Itoa(i), Port: 6881}
+	}
+	s := NewPeerStore(4)
+	for i := 0; i < 4; i++ {
+		s.Set(key(i), &domain.Peer{IsActive: true, LastSeen: now.Add(time.Duration(i) * time.Second)})
+	}
+
+	// 0、1、2 断开连接，1 重新连接
+	s.Deactivate(now.Add(3 * time.Second))
+	s.Set(key(1), &domain.Peer{IsActive: true, LastSeen: now.Add(4 * time.Second)})
+
+	// 淘汰最早不活跃的 0，再淘汰 2，只剩活跃 Peer 时允许超出容量
+	for i, evicted := range []int{0, 2, -1} {
+		s.Set(key(10+i), &domain.Peer{IsActive: true, LastSeen: now.Add(5 * time.Second)})
+		if evicted >= 0 {
+			if _, ok := s.Get(key(evicted)); ok {
+				t.Errorf("peer %d not evicted", evicted)
+			}
+		}
+	}
+	for _, i := range []int{1, 3, 10, 11, 12} {
+		if _, ok := s.Get(key(i)); !ok {
+			t.Errorf("active peer %d evicted", i)
+		}
+	}
+	if s.Len() != 5 {
+		t.Errorf("len = %d, want 5", s.Len())
+	}
+}
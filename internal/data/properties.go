@@ -0,0 +1,128 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"transmission-proxy/conf"
+
+	"github.com/go-kratos/kratos/v2/encoding"
+)
+
+const (
+	PropertiesFileName = "properties.json"
+
+	// propertiesBackupSuffix 最近一次成功加载的属性文件备份
+	propertiesBackupSuffix = ".bak"
+
+	// PropertiesVersion 当前属性文件的版本
+	PropertiesVersion = 1
+)
+
+// HistoricalStatistics 历史统计数据（写盘统计）
+type HistoricalStatistics struct {
+	Version         int   `json:"version"`          // 文件版本
+	TotalDownloaded int64 `json:"total_downloaded"` // 所有时间下载总量（字节）
+	TotalUploaded   int64 `json:"total_uploaded"`   // 所有时间上传总量（字节）
+}
+
+// propertiesMigrations 属性文件迁移，下标为迁移前的版本
+var propertiesMigrations = []func(properties map[string]json.RawMessage) error{
+	// 0 -> 1: 没有版本字段的旧文件
+	// 旧版本读取时会把上传总量赋值给下载总量，已写入的下载总量无法恢复，保持原值
+	func(_ map[string]json.RawMessage) error {
+		return nil
+	},
+}
+
+// propertiesPath 属性文件路径
+func propertiesPath() string {
+	return filepath.Join(conf.FlagConf, PropertiesFileName)
+}
+
+// loadProperties 加载属性文件
+func loadProperties(path string) (HistoricalStatistics, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return HistoricalStatistics{}, err
+	}
+	return decodeProperties(data)
+}
+
+// decodeProperties 解析属性文件，旧版本的文件会迁移到当前版本
+func decodeProperties(data []byte) (hs HistoricalStatistics, err error) {
+	properties := make(map[string]json.RawMessage)
+	err = encoding.GetCodec("json").Unmarshal(data, &properties)
+	if err != nil {
+		return
+	}
+
+	version := 0
+	if raw, ok := properties["version"]; ok {
+		err = json.Unmarshal(raw, &version)
+		if err != nil {
+			return
+		}
+	}
+	if version < 0 {
+		err = fmt.Errorf("无效的属性文件版本: %d", version)
+		return
+	}
+	for ; version < len(propertiesMigrations); version++ {
+		err = propertiesMigrations[version](properties)
+		if err != nil {
+			return
+		}
+	}
+
+	// 更高版本的文件仍尝试读取已知字段
+	delete(properties, "version")
+	data, err = json.Marshal(properties)
+	if err != nil {
+		return
+	}
+	err = encoding.GetCodec("json").Unmarshal(data, &hs)
+	if err != nil {
+		return
+	}
+	hs.Version = PropertiesVersion
+	if hs.TotalDownloaded < 0 || hs.TotalUploaded < 0 {
+		err = fmt.Errorf("无效的历史统计数据: 下载 %d, 上传 %d", hs.TotalDownloaded, hs.TotalUploaded)
+	}
+	return
+}
+
+// saveProperties 原子地写入属性文件
+func saveProperties(path string, hs HistoricalStatistics) error {
+	data, err := encoding.GetCodec("json").Marshal(&hs)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// recoverProperties 属性文件损坏时从备份恢复
+// 备份也不可用时使用空的统计数据，损坏的文件会被保留以便手动恢复
+func (d *torrentDao) recoverProperties(path string, cause error) (HistoricalStatistics, error) {
+	corruptPath := fmt.Sprintf("%s.corrupt-%d", path, time.Now().Unix())
+	err := os.Rename(path, corruptPath)
+	if err != nil {
+		return HistoricalStatistics{}, err
+	}
+	d.log.Errorf("属性文件 %s 已损坏，已移动到 %s: %v", path, corruptPath, cause)
+
+	hs, err := loadProperties(path + propertiesBackupSuffix)
+	if err != nil {
+		d.log.Errorf("无法从备份恢复属性文件，历史统计数据将重新计算: %v", err)
+		hs = HistoricalStatistics{}
+	} else {
+		d.log.Warnf("已从备份恢复属性文件")
+	}
+	hs.Version = PropertiesVersion
+
+	err = saveProperties(path, hs)
+	return hs, err
+}
@@ -3,17 +3,18 @@ package data
 import (
 	"bufio"
 	"context"
+	stderrors "errors"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"path/filepath"
+	"sync"
+	"time"
 
-	"transmission-proxy/conf"
 	"transmission-proxy/internal/domain"
 	"transmission-proxy/internal/errors"
 
 	"github.com/eko/gocache/lib/v4/store"
-	"github.com/go-kratos/kratos/v2/encoding"
 	"github.com/go-kratos/kratos/v2/log"
 	"github.com/hekmon/transmissionrpc/v3"
 	col "github.com/noxiouz/golang-generics-util/collection"
@@ -23,19 +24,17 @@ var (
 	CacheNotFoundErr = store.NotFound{}
 )
 
-const (
-	PropertiesFileName = "properties.json"
-)
-
-// HistoricalStatistics 历史统计数据（写盘统计）
-type HistoricalStatistics struct {
-	TotalDownloaded int64 `json:"total_downloaded"` // 所有时间下载总量（字节）
-	TotalUploaded   int64 `json:"total_uploaded"`   // 所有时间上传总量（字节）
-}
-
 type torrentDao struct {
 	infra *Infra
 	log   *log.Helper
+
+	// propertiesMutex 属性文件读写锁
+	propertiesMutex sync.Mutex
+
+	// backendTorrentsMutex 保护 backendTorrents
+	backendTorrentsMutex sync.Mutex
+	// backendTorrents 每个后端上次成功获取的种子，后端未连接时使用
+	backendTorrents [][]transmissionrpc.Torrent
 }
 
 // NewTorrentDao .
@@ -44,12 +43,24 @@ func NewTorrentDao(infra *Infra, logger log.Logger) (domain.TorrentRepo, error)
 	return &torrentDao{
 		infra: infra,
 		log:   log.NewHelper(logger),
+
+		backendTorrents: make([][]transmissionrpc.Torrent, len(infra.Backends.List())),
 	}, nil
 }
 
 // GetResponseLine 安行获取指定URL内容
 func (d *torrentDao) GetResponseLine(_ context.Context, trackerListURL string) (lines []string, err error) {
 	lines = make([]string, 0, 128)
+	defer func() {
+		if err != nil {
+			trackerSubscriptionFetches.WithLabelValues("error").Inc()
+			return
+		}
+		trackerSubscriptionFetches.WithLabelValues("success").Inc()
+		trackerSubscriptionLastSuccess.SetToCurrentTime()
+		trackerSubscriptionLines.Set(float64(len(lines)))
+	}()
+
 	response, err := http.Get(trackerListURL)
 	if err != nil {
 		return
@@ -76,18 +87,32 @@ func (d *torrentDao) UpTracker(ctx context.Context, ids []int64, trackers []stri
 		tmpTrackers = append(tmpTrackers, tracker, "")
 	}
 	// 添加tracker
-	data := transmissionrpc.TorrentSetPayload{
-		IDs:         ids,
-		TrackerList: tmpTrackers,
-	}
-	err = d.infra.TR.TorrentSet(ctx, data)
+	err = d.infra.Backends.eachIDs(ids, func(backend *Backend, ids []int64) error {
+		data := transmissionrpc.TorrentSetPayload{
+			IDs:         ids,
+			TrackerList: tmpTrackers,
+		}
+		return backend.TR.TorrentSet(ctx, data)
+	})
 	return
 }
 
 // AddTorrent 添加种子
+// 按分类与添加策略为每个种子选择 tr 后端
 func (d *torrentDao) AddTorrent(ctx context.Context, torrents []*domain.DownloadTorrent) (ids []int64, err error) {
-	ids = make([]int64, len(torrents))
+	ids = make([]int64, 0, len(torrents))
 	for _, torrent := range torrents {
+		category := ""
+		if torrent.Category.HasValue() {
+			category = torrent.Category.Value()
+		}
+		index, err := d.infra.Backends.place(ctx, category)
+		if err != nil {
+			d.log.Errorf("选择 tr 后端时出现错误 torrent=%s err=%v", torrent.URL, err)
+			continue
+		}
+		backend := d.infra.Backends.List()[index]
+
 		trt := transmissionrpc.TorrentAddPayload{
 			Filename: &torrent.URL,
 			Paused:   &torrent.Paused,
@@ -96,68 +121,111 @@ func (d *torrentDao) AddTorrent(ctx context.Context, torrents []*domain.Download
 			path := torrent.Path.Value()
 			trt.DownloadDir = &path
 		}
+		labels := make([]string, 0, len(backend.Labels))
 		if torrent.Labels.HasValue() {
-			trt.Labels = torrent.Labels.Value()
+			labels = append(labels, torrent.Labels.Value()...)
+		}
+		labels = append(labels, backend.Labels...)
+		if len(labels) > 0 {
+			trt.Labels = labels
 		}
 		if torrent.Cookie.HasValue() {
 			cookies := torrent.Cookie.Value()
 			trt.Cookies = &cookies
 		}
 
-		t, err := d.infra.TR.TorrentAdd(ctx, trt)
+		t, err := backend.TR.TorrentAdd(ctx, trt)
 		if err != nil {
-			d.log.Errorf("添加种子时出现错误 torrent=%s err=%v", torrent.URL, err)
+			d.log.Errorf("添加种子时出现错误 backend=%s torrent=%s err=%v", backend.Name, torrent.URL, err)
+			continue
 		}
 
-		ids = append(ids, *t.ID)
+		ids = append(ids, globalID(index, *t.ID))
 	}
 
 	return
 }
 
-// GetTorrent 获取种子
+// GetTorrent 获取种子，按后端的顺序在已连接的后端中查找
+// 没有找到种子且有后端未连接或请求失败时返回错误，种子可能在这些后端中
 func (d *torrentDao) GetTorrent(ctx context.Context, hash string) (col.Option[transmissionrpc.Torrent], error) {
-	torrents, err := d.infra.TR.TorrentGetAllForHashes(ctx, []string{hash})
-	if err != nil {
-		return nil, err
+	errs := make([]error, 0)
+	for index, backend := range d.infra.Backends.List() {
+		if !backend.Connected() {
+			errs = append(errs, fmt.Errorf("%s: %w", backend.Name, ErrBackendDisconnected))
+			continue
+		}
+		torrents, err := backend.TR.TorrentGetAllForHashes(ctx, []string{hash})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", backend.Name, err))
+			continue
+		}
+		if len(torrents) == 0 {
+			continue
+		}
+		trt := torrents[0]
+		setGlobalID(&trt, index)
+		return col.Some(trt), nil
 	}
-	if len(torrents) == 0 {
-		return nil, errors.ResourceNotExist("未找到Torrent")
+	if len(errs) > 0 {
+		return nil, stderrors.Join(errs...)
 	}
-	trt := torrents[0]
-	return col.Some(trt), nil
+	return nil, errors.ResourceNotExist("未找到Torrent")
 }
 
-// GetTorrentAll 获取所有种子
-func (d *torrentDao) GetTorrentAll(ctx context.Context) (col.Option[[]transmissionrpc.Torrent], error) {
-	torrents, err := d.infra.TR.TorrentGetAll(ctx)
+// GetTorrentAll 获取每个后端的种子
+// 未连接或请求失败的后端使用上次成功获取的种子并标记为过期，所有后端都失败时返回错误
+func (d *torrentDao) GetTorrentAll(ctx context.Context) ([]domain.BackendTorrents, error) {
+	d.backendTorrentsMutex.Lock()
+	defer d.backendTorrentsMutex.Unlock()
+
+	backendTorrents := make([][]transmissionrpc.Torrent, len(d.infra.Backends.List()))
+	ok, err := d.infra.Backends.eachConnected(func(index int, backend *Backend) error {
+		torrents, err := backend.TR.TorrentGetAll(ctx)
+		if err != nil {
+			return err
+		}
+		for i := range torrents {
+			setGlobalID(&torrents[i], index)
+		}
+		backendTorrents[index] = torrents
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	if len(torrents) == 0 {
-		return col.None[[]transmissionrpc.Torrent](), nil
+	res := make([]domain.BackendTorrents, 0, len(backendTorrents))
+	for index, backend := range d.infra.Backends.List() {
+		if ok[index] {
+			d.backendTorrents[index] = backendTorrents[index]
+		}
+		res = append(res, domain.BackendTorrents{
+			Backend:  backend.Name,
+			Stale:    !ok[index],
+			Torrents: d.backendTorrents[index],
+		})
 	}
-	return col.Some(torrents), nil
+	return res, nil
 }
 
 // GetPeer 获取Peer
-func (d *torrentDao) GetPeer(ctx context.Context, key domain.PeerKey) (col.Option[*domain.Peer], error) {
-	peerInfo, err := d.infra.PeerCache.Get(ctx, key)
-	if err != nil && CacheNotFoundErr.Is(err) {
+func (d *torrentDao) GetPeer(_ context.Context, key domain.PeerKey) (col.Option[*domain.Peer], error) {
+	peerInfo, ok := d.infra.PeerStore.Get(key)
+	if !ok {
 		return col.None[*domain.Peer](), nil
 	}
-	if err != nil {
-		return col.None[*domain.Peer](), err
-	}
 	return col.Some(peerInfo), nil
 }
 
 // SetPeer 设置Peer
-func (d *torrentDao) SetPeer(ctx context.Context, key domain.PeerKey, peer *domain.Peer) error {
-	err := d.infra.PeerCache.Set(ctx, key, peer)
-	if err != nil {
-		return err
-	}
+func (d *torrentDao) SetPeer(_ context.Context, key domain.PeerKey, peer *domain.Peer) error {
+	d.infra.PeerStore.Set(key, peer)
+	return nil
+}
+
+// DeactivatePeers 将指定时间之前没有更新的Peer标记为不活跃
+func (d *torrentDao) DeactivatePeers(_ context.Context, before time.Time) error {
+	d.infra.PeerStore.Deactivate(before)
 	return nil
 }
 
@@ -165,53 +233,125 @@ func (d *torrentDao) GetStateRefreshInterval() int64 {
 	return d.infra.stateRefreshInterval
 }
 
+// GetHistoricalStatistics 获取历史统计数据
+// 文件不存在时创建，文件损坏时从备份恢复
 func (d *torrentDao) GetHistoricalStatistics() (statistics domain.HistoricalStatistics, err error) {
-	path := filepath.Join(conf.FlagConf, PropertiesFileName)
+	d.propertiesMutex.Lock()
+	defer d.propertiesMutex.Unlock()
 
-	hs := HistoricalStatistics{
-		TotalDownloaded: 0,
-		TotalUploaded:   0,
+	path := propertiesPath()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		err = saveProperties(path, HistoricalStatistics{Version: PropertiesVersion})
+		return
 	}
-	// 检查文件是否存在
-	if _, err = os.Stat(path); os.IsNotExist(err) {
-		err = d.SaveHistoricalStatistics(statistics)
+	if err != nil {
 		return
 	}
 
-	// 读取文件内容到
-	data, err := os.ReadFile(path)
+	hs, err := decodeProperties(data)
 	if err != nil {
-		return
+		hs, err = d.recoverProperties(path, err)
+		if err != nil {
+			return
+		}
+	} else {
+		// 备份最近一次成功加载的数据，用于文件损坏时恢复
+		err = writeFileAtomic(path+propertiesBackupSuffix, data, 0644)
+		if err != nil {
+			d.log.Warnf("备份属性文件失败: %v", err)
+			err = nil
+		}
+		// 迁移旧版本的文件
+		err = saveProperties(path, hs)
+		if err != nil {
+			return
+		}
 	}
 
-	err = encoding.GetCodec("json").Unmarshal(data, &hs)
-	statistics.TotalDownloaded = hs.TotalUploaded
+	statistics.TotalDownloaded = hs.TotalDownloaded
 	statistics.TotalUploaded = hs.TotalUploaded
 	return
 }
 
 // SaveHistoricalStatistics 保存历史统计
-func (d *torrentDao) SaveHistoricalStatistics(statistics domain.HistoricalStatistics) (err error) {
-	hs := HistoricalStatistics{
+func (d *torrentDao) SaveHistoricalStatistics(statistics domain.HistoricalStatistics) error {
+	d.propertiesMutex.Lock()
+	defer d.propertiesMutex.Unlock()
+
+	return saveProperties(propertiesPath(), HistoricalStatistics{
+		Version:         PropertiesVersion,
 		TotalDownloaded: statistics.TotalDownloaded,
 		TotalUploaded:   statistics.TotalUploaded,
+	})
+}
+
+// GetBackendStatus 获取每个 tr 后端的连接状态
+// 请求 tr 失败时后端被标记为未连接，由重连任务在后台重新连接，这里不再请求 tr
+func (d *torrentDao) GetBackendStatus(_ context.Context) []domain.BackendStatus {
+	statuses := make([]domain.BackendStatus, 0, len(d.infra.Backends.List()))
+	for _, backend := range d.infra.Backends.List() {
+		connected, version, err := backend.Status()
+		status := domain.BackendStatus{
+			Name:      backend.Name,
+			Reachable: connected,
+			Version:   version,
+		}
+		if err != nil {
+			status.Error = err.Error()
+		}
+		statuses = append(statuses, status)
 	}
+	return statuses
+}
 
-	path := filepath.Join(conf.FlagConf, PropertiesFileName)
-	json, err := encoding.GetCodec("json").Marshal(&hs)
+// GetSessionStats 获取每个已连接后端的会话统计，键为后端名称
+// 跳过未连接或请求失败的后端，所有后端都失败时返回错误
+func (d *torrentDao) GetSessionStats(ctx context.Context) (map[string]domain.SessionStats, error) {
+	mutex := sync.Mutex{}
+	res := make(map[string]domain.SessionStats, len(d.infra.Backends.List()))
+	_, err := d.infra.Backends.eachConnected(func(_ int, backend *Backend) error {
+		stats, err := backend.TR.SessionStats(ctx)
+		if err != nil {
+			return err
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		res[backend.Name] = domain.SessionStats{
+			DownloadSpeed:        stats.DownloadSpeed,
+			UploadSpeed:          stats.UploadSpeed,
+			CumulativeDownloaded: stats.CumulativeStats.DownloadedBytes,
+			CumulativeUploaded:   stats.CumulativeStats.UploadedBytes,
+			CurrentDownloaded:    stats.CurrentStats.DownloadedBytes,
+			CurrentUploaded:      stats.CurrentStats.UploadedBytes,
+		}
+		return nil
+	})
 	if err != nil {
-		return
+		return nil, err
 	}
-	// 打开文件以覆盖写入
-	file, err := os.Create(path)
+	return res, nil
+}
+
+// GetFreeSpace 获取指定目录所在磁盘的剩余空间（字节）
+// 有多个 tr 后端时返回已连接的后端中剩余空间最多的，后端可能共用同一个磁盘，不能相加
+func (d *torrentDao) GetFreeSpace(ctx context.Context, path string) (int64, error) {
+	mutex := sync.Mutex{}
+	var res int64
+	_, err := d.infra.Backends.eachConnected(func(_ int, backend *Backend) error {
+		freeSpace, _, err := backend.TR.FreeSpace(ctx, path)
+		if err != nil {
+			return err
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		res = max(res, domain.BitsToBytes(&freeSpace))
+		return nil
+	})
 	if err != nil {
-		return
+		return 0, err
 	}
-	defer func(file *os.File) {
-		err = file.Close()
-	}(file)
-	_, err = file.Write(json)
-	return
+	return res, nil
 }
 
 // CacheTmpTorrentFile 缓存临时种子文件
@@ -234,6 +374,71 @@ func (d *torrentDao) GetTmpTorrentFile(ctx context.Context, filename string) (co
 
 // ReannounceTrackerServer 重新通告tracker服务器
 func (d *torrentDao) ReannounceTrackerServer(ctx context.Context, ids []int64) (err error) {
-	err = d.infra.TR.TorrentReannounceIDs(ctx, ids)
+	err = d.infra.Backends.eachIDs(ids, func(backend *Backend, ids []int64) error {
+		return backend.TR.TorrentReannounceIDs(ctx, ids)
+	})
+	return
+}
+
+// QueueMoveTop 将种子移动到队列顶部
+func (d *torrentDao) QueueMoveTop(ctx context.Context, ids []int64) (err error) {
+	err = d.infra.Backends.eachIDs(ids, func(backend *Backend, ids []int64) error {
+		return backend.TR.QueueMoveTop(ctx, ids)
+	})
+	return
+}
+
+// QueueMoveUp 将种子在队列中上移
+func (d *torrentDao) QueueMoveUp(ctx context.Context, ids []int64) (err error) {
+	err = d.infra.Backends.eachIDs(ids, func(backend *Backend, ids []int64) error {
+		return backend.TR.QueueMoveUp(ctx, ids)
+	})
+	return
+}
+
+// QueueMoveDown 将种子在队列中下移
+func (d *torrentDao) QueueMoveDown(ctx context.Context, ids []int64) (err error) {
+	err = d.infra.Backends.eachIDs(ids, func(backend *Backend, ids []int64) error {
+		return backend.TR.QueueMoveDown(ctx, ids)
+	})
+	return
+}
+
+// QueueMoveBottom 将种子移动到队列底部
+func (d *torrentDao) QueueMoveBottom(ctx context.Context, ids []int64) (err error) {
+	err = d.infra.Backends.eachIDs(ids, func(backend *Backend, ids []int64) error {
+		return backend.TR.QueueMoveBottom(ctx, ids)
+	})
+	return
+}
+
+// StartTorrent 按队列启动种子
+func (d *torrentDao) StartTorrent(ctx context.Context, ids []int64) (err error) {
+	err = d.infra.Backends.eachIDs(ids, func(backend *Backend, ids []int64) error {
+		return backend.TR.TorrentStartIDs(ctx, ids)
+	})
+	return
+}
+
+// StartTorrentNow 忽略队列立即启动种子
+func (d *torrentDao) StartTorrentNow(ctx context.Context, ids []int64) (err error) {
+	err = d.infra.Backends.eachIDs(ids, func(backend *Backend, ids []int64) error {
+		return backend.TR.TorrentStartNowIDs(ctx, ids)
+	})
 	return
 }
+
+// GetPieceHashes 从种子文件中获取片段哈希
+// tr RPC 不提供片段哈希，torrentFile 是 tr 主机上的路径，需要代理与 tr 运行在同一主机，
+// 或者把 tr 的种子目录挂载到代理的相同路径
+func (d *torrentDao) GetPieceHashes(_ context.Context, torrentFile string) ([]string, error) {
+	data, err := os.ReadFile(torrentFile)
+	if err != nil && os.IsNotExist(err) {
+		return nil, errors.ResourceNotExist(
+			"种子文件 %s 不存在，获取片段哈希需要代理能够在相同路径读取 tr 的种子目录", torrentFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseTorrentPieceHashes(data)
+}
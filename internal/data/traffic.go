@@ -0,0 +1,156 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"time"
+
+	"transmission-proxy/internal/domain"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	TrafficDBFileName = "traffic.db"
+)
+
+// 流量统计存储结构:
+// <resolution> / <scope>:<key> / <统计区间开始时间, 8字节大端序 Unix 秒> -> <下载量, 上传量, 各8字节大端序>
+
+type trafficDao struct {
+	infra *Infra
+	log   *log.Helper
+}
+
+// NewTrafficDao .
+func NewTrafficDao(infra *Infra, logger log.Logger) domain.TrafficRepo {
+	return &trafficDao{
+		infra: infra,
+		log:   log.NewHelper(logger),
+	}
+}
+
+// AddTraffic 记录流量增量，累加到每种精度的统计区间中
+func (d *trafficDao) AddTraffic(_ context.Context, at time.Time, samples []domain.TrafficSample) error {
+	return d.infra.Traffic.Update(func(tx *bbolt.Tx) error {
+		for _, resolution := range domain.TrafficResolutions {
+			resolutionBucket, err := tx.CreateBucketIfNotExists([]byte(resolution))
+			if err != nil {
+				return err
+			}
+			key := trafficTimeKey(resolution.Truncate(at))
+			for _, sample := range samples {
+				seriesBucket, err := resolutionBucket.CreateBucketIfNotExists(trafficSeriesKey(sample.Scope, sample.Key))
+				if err != nil {
+					return err
+				}
+				downloaded, uploaded := decodeTrafficValue(seriesBucket.Get(key))
+				err = seriesBucket.Put(key, encodeTrafficValue(downloaded+sample.Downloaded, uploaded+sample.Uploaded))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// GetTraffic 获取 [from, to] 之间的流量时间序列
+func (d *trafficDao) GetTraffic(_ context.Context, scope domain.TrafficScope, key string,
+	resolution domain.TrafficResolution, from time.Time, to time.Time) ([]domain.TrafficPoint, error) {
+
+	points := make([]domain.TrafficPoint, 0)
+	err := d.infra.Traffic.View(func(tx *bbolt.Tx) error {
+		resolutionBucket := tx.Bucket([]byte(resolution))
+		if resolutionBucket == nil {
+			return nil
+		}
+		seriesBucket := resolutionBucket.Bucket(trafficSeriesKey(scope, key))
+		if seriesBucket == nil {
+			return nil
+		}
+
+		end := trafficTimeKey(to)
+		cursor := seriesBucket.Cursor()
+		for k, v := cursor.Seek(trafficTimeKey(from)); k != nil && bytes.Compare(k, end) <= 0; k, v = cursor.Next() {
+			downloaded, uploaded := decodeTrafficValue(v)
+			points = append(points, domain.TrafficPoint{
+				Time:       time.Unix(int64(binary.BigEndian.Uint64(k)), 0),
+				Downloaded: downloaded,
+				Uploaded:   uploaded,
+			})
+		}
+		return nil
+	})
+	return points, err
+}
+
+// PruneTraffic 删除指定精度中开始时间早于 before 的统计
+func (d *trafficDao) PruneTraffic(_ context.Context, resolution domain.TrafficResolution, before time.Time) error {
+	return d.infra.Traffic.Update(func(tx *bbolt.Tx) error {
+		resolutionBucket := tx.Bucket([]byte(resolution))
+		if resolutionBucket == nil {
+			return nil
+		}
+
+		end := trafficTimeKey(before)
+		emptySeries := make([][]byte, 0)
+		err := resolutionBucket.ForEachBucket(func(seriesKey []byte) error {
+			seriesBucket := resolutionBucket.Bucket(seriesKey)
+			// 遍历时删除会跳过元素，先收集需要删除的 key
+			expired := make([][]byte, 0)
+			cursor := seriesBucket.Cursor()
+			for k, _ := cursor.First(); k != nil && bytes.Compare(k, end) < 0; k, _ = cursor.Next() {
+				expired = append(expired, bytes.Clone(k))
+			}
+			for _, k := range expired {
+				err := seriesBucket.Delete(k)
+				if err != nil {
+					return err
+				}
+			}
+			if k, _ := seriesBucket.Cursor().First(); k == nil {
+				emptySeries = append(emptySeries, bytes.Clone(seriesKey))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// 删除已经没有数据的种子或分类
+		for _, seriesKey := range emptySeries {
+			err = resolutionBucket.DeleteBucket(seriesKey)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func trafficSeriesKey(scope domain.TrafficScope, key string) []byte {
+	return []byte(string(scope) + ":" + key)
+}
+
+func trafficTimeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(max(0, t.Unix())))
+	return key
+}
+
+func encodeTrafficValue(downloaded int64, uploaded int64) []byte {
+	value := make([]byte, 16)
+	binary.BigEndian.PutUint64(value[:8], uint64(downloaded))
+	binary.BigEndian.PutUint64(value[8:], uint64(uploaded))
+	return value
+}
+
+func decodeTrafficValue(value []byte) (downloaded int64, uploaded int64) {
+	if len(value) != 16 {
+		return 0, 0
+	}
+	return int64(binary.BigEndian.Uint64(value[:8])), int64(binary.BigEndian.Uint64(value[8:]))
+}
@@ -3,8 +3,15 @@ package domain
 import (
 	"context"
 	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	pb "transmission-proxy/api/v2"
+	"transmission-proxy/conf"
+	"transmission-proxy/internal/errors"
 
 	"github.com/go-kratos/kratos/v2/log"
 	"github.com/hekmon/transmissionrpc/v3"
@@ -16,34 +23,173 @@ type AppRepo interface {
 	// GetPreferences 获取首选项
 	GetPreferences(ctx context.Context) (transmissionrpc.SessionArguments, error)
 
-	// SetPreferences 设置首选项
-	SetPreferences(ctx context.Context, trd transmissionrpc.SessionArguments) error
+	// SetPreferences 设置首选项到所有后端，队列数量加上每个后端因慢速种子额外增加的数量
+	SetPreferences(ctx context.Context, trd transmissionrpc.SessionArguments, slowSlots map[string]QueueSlots) error
+
+	// GetBackendPreferences 获取每个已连接后端的首选项，按配置顺序排列
+	GetBackendPreferences(ctx context.Context) ([]BackendPreferences, error)
+
+	// SetBackendPreferences 设置指定后端的首选项
+	SetBackendPreferences(ctx context.Context, backend string, trd transmissionrpc.SessionArguments) error
+
+	// GetProxyPreferences 获取代理模拟实现的首选项
+	GetProxyPreferences(ctx context.Context) (ProxyPreferences, error)
+
+	// SaveProxyPreferences 保存代理模拟实现的首选项
+	SaveProxyPreferences(ctx context.Context, pre ProxyPreferences) error
+}
+
+// ProxyPreferences tr 缺少，由代理模拟实现的首选项
+type ProxyPreferences struct {
+	DontCountSlowTorrents      bool  // 是否将慢速种子排除在队列限制之外
+	SlowTorrentDlRateThreshold int32 // 认为种子下载速度“慢”的阈值（KiB/s）
+	SlowTorrentUlRateThreshold int32 // 认为种子上传速度“慢”的阈值（KiB/s）
+	SlowTorrentInactiveTimer   int32 // 种子被认为“慢”之前的无活动时间（秒）
+
+	// SlowSlots 每个后端因慢速种子而额外增加的队列数量 key: <后端名称>
+	SlowSlots map[string]QueueSlots
 }
 
+// QueueSlots 队列数量
+type QueueSlots struct {
+	Download int64 // 下载队列数量
+	Seed     int64 // 做种队列数量
+}
+
+// BackendPreferences 一个 tr 后端的首选项
+type BackendPreferences struct {
+	Backend     string // 后端名称
+	Preferences transmissionrpc.SessionArguments
+}
+
+// speedLimitUnit tr 速度限制单位(kB/s)与字节的换算
+const speedLimitUnit = 1000
+
 type Preferences struct {
 	ListenPort col.Option[int32]
 	BanList    col.Option[[]string]
+
+	StartPausedEnabled  col.Option[bool]    // 种子是否以暂停状态添加
+	IncompleteFilesExt  col.Option[bool]    // 是否为未完成的文件添加后缀
+	SavePath            col.Option[string]  // 种子的默认保存路径
+	TempPathEnabled     col.Option[bool]    // 是否启用未完成种子的临时文件夹
+	TempPath            col.Option[string]  // 未完成种子的临时文件夹路径
+	AutorunEnabled      col.Option[bool]    // 种子下载完成后是否运行外部程序
+	AutorunProgram      col.Option[string]  // 要运行的程序路径
+	QueueingEnabled     col.Option[bool]    // 是否启用种子队列
+	MaxActiveDownloads  col.Option[int32]   // 最大同时下载数
+	MaxActiveUploads    col.Option[int32]   // 最大同时上传数
+	MaxRatioEnabled     col.Option[bool]    // 是否启用分享率限制
+	MaxRatio            col.Option[float32] // 全局分享率限制
+	Upnp                col.Option[bool]    // 是否启用 UPnP/NAT-PMP
+	RandomPort          col.Option[bool]    // 是否随机选择端口
+	DlLimit             col.Option[int32]   // 全局下载速度限制（字节/秒）
+	UpLimit             col.Option[int32]   // 全局上传速度限制（字节/秒）
+	MaxConnec           col.Option[int32]   // 最大全局连接数
+	MaxConnecPerTorrent col.Option[int32]   // 每个种子的最大连接数
+
+	DontCountSlowTorrents      col.Option[bool]  // 是否将无活动的种子排除在限制之外
+	SlowTorrentDlRateThreshold col.Option[int32] // 认为种子下载速度“慢”的阈值（KiB/s）
+	SlowTorrentUlRateThreshold col.Option[int32] // 认为种子上传速度“慢”的阈值（KiB/s）
+	SlowTorrentInactiveTimer   col.Option[int32] // 种子被认为“慢”之前的无活动时间（秒）
+
+	// Unsupported tr 没有对应功能的首选项
+	Unsupported []string
+}
+
+// NewPreferences 创建空的首选项
+func NewPreferences() *Preferences {
+	return &Preferences{
+		ListenPort:          col.None[int32](),
+		BanList:             col.None[[]string](),
+		StartPausedEnabled:  col.None[bool](),
+		IncompleteFilesExt:  col.None[bool](),
+		SavePath:            col.None[string](),
+		TempPathEnabled:     col.None[bool](),
+		TempPath:            col.None[string](),
+		AutorunEnabled:      col.None[bool](),
+		AutorunProgram:      col.None[string](),
+		QueueingEnabled:     col.None[bool](),
+		MaxActiveDownloads:  col.None[int32](),
+		MaxActiveUploads:    col.None[int32](),
+		MaxRatioEnabled:     col.None[bool](),
+		MaxRatio:            col.None[float32](),
+		Upnp:                col.None[bool](),
+		RandomPort:          col.None[bool](),
+		DlLimit:             col.None[int32](),
+		UpLimit:             col.None[int32](),
+		MaxConnec:           col.None[int32](),
+		MaxConnecPerTorrent: col.None[int32](),
+
+		DontCountSlowTorrents:      col.None[bool](),
+		SlowTorrentDlRateThreshold: col.None[int32](),
+		SlowTorrentUlRateThreshold: col.None[int32](),
+		SlowTorrentInactiveTimer:   col.None[int32](),
+
+		Unsupported: make([]string, 0),
+	}
+}
+
+// dropUnsafe 删除会修改 tr 主机上的路径或让 tr 运行外部程序的首选项，返回删除的首选项
+func (pre *Preferences) dropUnsafe() []string {
+	unsafe := make([]string, 0)
+	if pre.SavePath.HasValue() {
+		pre.SavePath = col.None[string]()
+		unsafe = append(unsafe, "save_path")
+	}
+	if pre.TempPathEnabled.HasValue() {
+		pre.TempPathEnabled = col.None[bool]()
+		unsafe = append(unsafe, "temp_path_enabled")
+	}
+	if pre.TempPath.HasValue() {
+		pre.TempPath = col.None[string]()
+		unsafe = append(unsafe, "temp_path")
+	}
+	if pre.AutorunEnabled.HasValue() {
+		pre.AutorunEnabled = col.None[bool]()
+		unsafe = append(unsafe, "autorun_enabled")
+	}
+	if pre.AutorunProgram.HasValue() {
+		pre.AutorunProgram = col.None[string]()
+		unsafe = append(unsafe, "autorun_program")
+	}
+	return unsafe
 }
 
 // AppUsecase .
 type AppUsecase struct {
 	appRepo   AppRepo
 	banIPRepo BanIPRepo
+	queueLock *QueueLock
 	log       *log.Helper
+
+	// allowUnsafePreferences 是否允许通过 qb 接口修改 tr 主机上的路径与外部程序
+	allowUnsafePreferences bool
+
+	// banInfos 通过管理接口封禁的ip的附加信息，首次使用时从仓储加载，修改后写回仓储
+	// key: <ip>
+	banInfos     map[string]BanInfo
+	banInfoMutex sync.Mutex
 }
 
 // NewAppUsecase .
-func NewAppUsecase(appRepo AppRepo, banIPRepo BanIPRepo, logger log.Logger) *AppUsecase {
+func NewAppUsecase(bootstrap *conf.Bootstrap, appRepo AppRepo, banIPRepo BanIPRepo, queueLock *QueueLock,
+	logger log.Logger) *AppUsecase {
 
 	return &AppUsecase{
-		appRepo:   appRepo,
-		banIPRepo: banIPRepo,
-		log:       log.NewHelper(logger),
+		appRepo:                appRepo,
+		banIPRepo:              banIPRepo,
+		queueLock:              queueLock,
+		allowUnsafePreferences: bootstrap.GetInfra().GetTr().GetAllowUnsafePreferences(),
+		log:                    log.NewHelper(logger),
 	}
 }
 
 // BanIP 封禁IP
 func (uc *AppUsecase) BanIP(ctx context.Context, ips []string) error {
+	ctx, span := tracer.Start(ctx, "AppUsecase.BanIP")
+	defer span.End()
+
 	// 过滤错误的ip
 	readyIPV4 := make([]string, 0, len(ips))
 	readyIPV6 := make([]string, 0, len(ips))
@@ -99,6 +245,9 @@ func (uc *AppUsecase) BanIP(ctx context.Context, ips []string) error {
 
 // UnbanIP 解禁IP
 func (uc *AppUsecase) UnbanIP(ctx context.Context, ips []string) error {
+	ctx, span := tracer.Start(ctx, "AppUsecase.UnbanIP")
+	defer span.End()
+
 	// 过滤错误的ip
 	readyIPV4 := make([]string, 0, len(ips))
 	readyIPV6 := make([]string, 0, len(ips))
@@ -114,6 +263,9 @@ func (uc *AppUsecase) UnbanIP(ctx context.Context, ips []string) error {
 		}
 	}
 
+	// 附加信息与是否仍在封禁列表中无关，全部删除
+	requestedIPs := slices.Concat(readyIPV4, readyIPV6)
+
 	// 过滤没有封禁的ip
 	ipStatuses, err := uc.banIPRepo.GetBannedIPV4Status(ctx, readyIPV4)
 	if err != nil {
@@ -149,11 +301,25 @@ func (uc *AppUsecase) UnbanIP(ctx context.Context, ips []string) error {
 			return err
 		}
 	}
-	return nil
+
+	uc.banInfoMutex.Lock()
+	defer uc.banInfoMutex.Unlock()
+	return uc.updateBanInfosLocked(ctx, func(infos map[string]BanInfo) (changed bool) {
+		for _, ip := range requestedIPs {
+			if _, ok := infos[ip]; ok {
+				delete(infos, ip)
+				changed = true
+			}
+		}
+		return
+	})
 }
 
 // UpBanIPList 完全更新IP列表
 func (uc *AppUsecase) UpBanIPList(ctx context.Context, ips []string) (err error) {
+	ctx, span := tracer.Start(ctx, "AppUsecase.UpBanIPList")
+	defer span.End()
+
 	// 过滤错误的ip
 	readyIPV4 := make([]string, 0, len(ips))
 	readyIPV6 := make([]string, 0, len(ips))
@@ -174,6 +340,10 @@ func (uc *AppUsecase) UpBanIPList(ctx context.Context, ips []string) (err error)
 	if err != nil {
 		return
 	}
+	err = uc.clearBanInfos(ctx)
+	if err != nil {
+		return
+	}
 
 	// 全量ban
 	err = uc.banIPRepo.BanIPV4(ctx, readyIPV4)
@@ -187,22 +357,241 @@ func (uc *AppUsecase) UpBanIPList(ctx context.Context, ips []string) (err error)
 	return
 }
 
+// BanIPWithOptions 通过管理接口封禁IP，记录封禁原因与到期时间
+// 已经封禁的ip更新封禁原因与到期时间
+func (uc *AppUsecase) BanIPWithOptions(ctx context.Context, ips []string, options BanOptions) error {
+	ctx, span := tracer.Start(ctx, "AppUsecase.BanIPWithOptions")
+	defer span.End()
+
+	readyIPs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		ipNet := net.ParseIP(ip)
+		if ipNet == nil {
+			return errors.InvalidArgument("无效的ip: %s", ip)
+		}
+		readyIPs = append(readyIPs, ipNet.String())
+	}
+	if err := uc.BanIP(ctx, readyIPs); err != nil {
+		return err
+	}
+
+	info := BanInfo{Reason: options.Reason}
+	if options.TTL > 0 {
+		info.ExpiresAt = time.Now().Add(options.TTL)
+	}
+	uc.banInfoMutex.Lock()
+	defer uc.banInfoMutex.Unlock()
+	return uc.updateBanInfosLocked(ctx, func(infos map[string]BanInfo) bool {
+		for _, ip := range readyIPs {
+			infos[ip] = info
+		}
+		return true
+	})
+}
+
+// RestoreBans 重新封禁保存的通过管理接口封禁的ip，返回重新封禁的ip
+// 代理退出时会删除 nftables 封禁表，启动时需要恢复，已经到期的ip直接删除
+func (uc *AppUsecase) RestoreBans(ctx context.Context) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "AppUsecase.RestoreBans")
+	defer span.End()
+
+	uc.banInfoMutex.Lock()
+	defer uc.banInfoMutex.Unlock()
+
+	now := time.Now()
+	restored := make([]string, 0)
+	err := uc.updateBanInfosLocked(ctx, func(infos map[string]BanInfo) (changed bool) {
+		for ip, info := range infos {
+			if !info.ExpiresAt.IsZero() && !info.ExpiresAt.After(now) {
+				delete(infos, ip)
+				changed = true
+				continue
+			}
+			restored = append(restored, ip)
+		}
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(restored) == 0 {
+		return restored, nil
+	}
+	slices.Sort(restored)
+	if err = uc.BanIP(ctx, restored); err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+// UnbanExpired 解禁已经到期的ip，返回解禁的ip
+func (uc *AppUsecase) UnbanExpired(ctx context.Context) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "AppUsecase.UnbanExpired")
+	defer span.End()
+
+	now := time.Now()
+	expired := make([]string, 0)
+	uc.banInfoMutex.Lock()
+	if err := uc.loadBanInfosLocked(ctx); err != nil {
+		uc.banInfoMutex.Unlock()
+		return nil, err
+	}
+	for ip, info := range uc.banInfos {
+		if !info.ExpiresAt.IsZero() && !info.ExpiresAt.After(now) {
+			expired = append(expired, ip)
+		}
+	}
+	uc.banInfoMutex.Unlock()
+
+	if len(expired) == 0 {
+		return expired, nil
+	}
+	if err := uc.UnbanIP(ctx, expired); err != nil {
+		return nil, err
+	}
+	return expired, nil
+}
+
+// clearBanInfos 封禁列表被清空后删除所有附加信息
+func (uc *AppUsecase) clearBanInfos(ctx context.Context) error {
+	uc.banInfoMutex.Lock()
+	defer uc.banInfoMutex.Unlock()
+	return uc.updateBanInfosLocked(ctx, func(infos map[string]BanInfo) bool {
+		if len(infos) == 0 {
+			return false
+		}
+		clear(infos)
+		return true
+	})
+}
+
+// loadBanInfosLocked 首次使用时从仓储加载封禁附加信息，调用方需要持有 banInfoMutex
+func (uc *AppUsecase) loadBanInfosLocked(ctx context.Context) error {
+	if uc.banInfos != nil {
+		return nil
+	}
+	infos, err := uc.banIPRepo.GetBanInfos(ctx)
+	if err != nil {
+		return err
+	}
+	if infos == nil {
+		infos = make(map[string]BanInfo)
+	}
+	uc.banInfos = infos
+	return nil
+}
+
+// updateBanInfosLocked 修改封禁附加信息，update 返回 true 时写回仓储，调用方需要持有 banInfoMutex
+// 写回失败时丢弃内存中的修改，下次使用时重新从仓储加载
+func (uc *AppUsecase) updateBanInfosLocked(ctx context.Context, update func(infos map[string]BanInfo) bool) error {
+	if err := uc.loadBanInfosLocked(ctx); err != nil {
+		return err
+	}
+	if !update(uc.banInfos) {
+		return nil
+	}
+	if err := uc.banIPRepo.SaveBanInfos(ctx, uc.banInfos); err != nil {
+		uc.banInfos = nil
+		return err
+	}
+	return nil
+}
+
+// SearchBannedIPs 搜索封禁的ip，按ip排序
+// query 为 CIDR 时匹配网段内的ip，否则匹配包含 query 的ip或封禁原因，为空时返回所有封禁的ip
+func (uc *AppUsecase) SearchBannedIPs(ctx context.Context, query string) ([]BannedIP, error) {
+	bannedIPs, err := uc.GetBannedIPs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return bannedIPs, nil
+	}
+
+	match := func(bannedIP BannedIP) bool {
+		return strings.Contains(bannedIP.IP, query) ||
+			strings.Contains(strings.ToLower(bannedIP.Reason), strings.ToLower(query))
+	}
+	if prefix, err := netip.ParsePrefix(query); err == nil {
+		match = func(bannedIP BannedIP) bool {
+			addr, err := netip.ParseAddr(bannedIP.IP)
+			return err == nil && prefix.Contains(addr)
+		}
+	}
+	return slices.DeleteFunc(bannedIPs, func(bannedIP BannedIP) bool { return !match(bannedIP) }), nil
+}
+
+// GetBannedIPs 获取所有封禁的ip，按ip排序
+func (uc *AppUsecase) GetBannedIPs(ctx context.Context) ([]BannedIP, error) {
+	ctx, span := tracer.Start(ctx, "AppUsecase.GetBannedIPs")
+	defer span.End()
+
+	bannedIPs, err := uc.banIPRepo.GetBannedIPs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	uc.banInfoMutex.Lock()
+	if err = uc.loadBanInfosLocked(ctx); err != nil {
+		uc.banInfoMutex.Unlock()
+		return nil, err
+	}
+	for i := range bannedIPs {
+		bannedIPs[i].Source = BanSourceQB
+		if info, ok := uc.banInfos[bannedIPs[i].IP]; ok {
+			bannedIPs[i].Source = BanSourceAdmin
+			bannedIPs[i].Reason = info.Reason
+			bannedIPs[i].ExpiresAt = info.ExpiresAt
+		}
+	}
+	uc.banInfoMutex.Unlock()
+	slices.SortFunc(bannedIPs, func(a, b BannedIP) int {
+		addrA, _ := netip.ParseAddr(a.IP)
+		addrB, _ := netip.ParseAddr(b.IP)
+		return addrA.Compare(addrB)
+	})
+	return bannedIPs, nil
+}
+
+// ClearBanList 清空封禁列表
+func (uc *AppUsecase) ClearBanList(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "AppUsecase.ClearBanList")
+	defer span.End()
+
+	if err := uc.banIPRepo.ClearBanList(ctx); err != nil {
+		return err
+	}
+	return uc.clearBanInfos(ctx)
+}
+
 func (uc *AppUsecase) GetPreferences(ctx context.Context) (*pb.GetPreferencesResponse, error) {
-	pre, err := uc.appRepo.GetPreferences(ctx)
+	ctx, span := tracer.Start(ctx, "AppUsecase.GetPreferences")
+	defer span.End()
+
+	// 使用第一个已连接后端的首选项
+	backendPres, err := uc.appRepo.GetBackendPreferences(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pre := backendPres[0].Preferences
+	proxyPre, err := uc.appRepo.GetProxyPreferences(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	// 扣除该后端因慢速种子额外增加的队列数量
+	slowSlots := proxyPre.SlowSlots[backendPres[0].Backend]
 	maxActiveDownloads := int32(-1) // 最大同时下载数
 	if *pre.DownloadQueueEnabled && pre.DownloadQueueSize != nil {
-		maxActiveDownloads = int32(*pre.DownloadQueueSize)
+		maxActiveDownloads = int32(*pre.DownloadQueueSize - slowSlots.Download)
 	}
 	maxActiveUploads := int32(-1) // 最大同时上传数
 	if *pre.SeedQueueEnabled && pre.SeedQueueSize != nil {
-		maxActiveUploads = int32(*pre.SeedQueueSize)
+		maxActiveUploads = int32(*pre.SeedQueueSize - slowSlots.Seed)
 	}
+	queueingEnabled := *pre.DownloadQueueEnabled || *pre.SeedQueueEnabled
 	maxActiveTorrents := int32(-1) // 最大同时下载和上传数
-	if *pre.DownloadQueueEnabled || *pre.SeedQueueEnabled {
+	if queueingEnabled {
 		maxActiveTorrents = int32(0)
 	}
 	if maxActiveDownloads > 0 {
@@ -214,11 +603,11 @@ func (uc *AppUsecase) GetPreferences(ctx context.Context) (*pb.GetPreferencesRes
 
 	dlLimit := int32(-1)
 	upLimit := int32(-1)
-	if *pre.AltSpeedEnabled && pre.AltSpeedDown != nil {
-		dlLimit = int32(*pre.AltSpeedDown)
+	if *pre.SpeedLimitDownEnabled && pre.SpeedLimitDown != nil {
+		dlLimit = int32(*pre.SpeedLimitDown * speedLimitUnit)
 	}
-	if *pre.AltSpeedEnabled && pre.AltSpeedUp != nil {
-		upLimit = int32(*pre.AltSpeedUp)
+	if *pre.SpeedLimitUpEnabled && pre.SpeedLimitUp != nil {
+		upLimit = int32(*pre.SpeedLimitUp * speedLimitUnit)
 	}
 
 	qbd := &pb.GetPreferencesResponse{
@@ -252,21 +641,21 @@ func (uc *AppUsecase) GetPreferences(ctx context.Context) (*pb.GetPreferencesRes
 		AutorunEnabled: *pre.ScriptTorrentDoneEnabled,  // 种子下载完成后是否运行外部程序
 		AutorunProgram: *pre.ScriptTorrentDoneFilename, // 如果启用了 autorun_enabled，要运行的程序路径、名称和参数
 
-		QueueingEnabled:    false,              // 是否启用种子队列
+		QueueingEnabled:    queueingEnabled,    // 是否启用种子队列
 		MaxActiveDownloads: maxActiveDownloads, // 最大同时下载数
 		MaxActiveTorrents:  maxActiveTorrents,  // 最大同时下载和上传数
 		MaxActiveUploads:   maxActiveUploads,   // 最大同时上传数
 
-		DontCountSlowTorrents:      false, // 是否将无活动的种子排除在限制之外
-		SlowTorrentDlRateThreshold: 0,     // 认为种子下载速度“慢”的阈值
-		SlowTorrentUlRateThreshold: 0,     // 认为种子上传速度“慢”的阈值
-		SlowTorrentInactiveTimer:   0,     // 种子被认为“慢”之前的无活动时间
+		DontCountSlowTorrents:      proxyPre.DontCountSlowTorrents,      // 是否将无活动的种子排除在限制之外
+		SlowTorrentDlRateThreshold: proxyPre.SlowTorrentDlRateThreshold, // 认为种子下载速度“慢”的阈值
+		SlowTorrentUlRateThreshold: proxyPre.SlowTorrentUlRateThreshold, // 认为种子上传速度“慢”的阈值
+		SlowTorrentInactiveTimer:   proxyPre.SlowTorrentInactiveTimer,   // 种子被认为“慢”之前的无活动时间
 
 		MaxRatioEnabled: *pre.SeedRatioLimited,        // 是否启用分享率限制
 		MaxRatio:        float32(*pre.SeedRatioLimit), // 全局分享率限制
 		MaxRatioAct:     0,                            // 达到分享率限制后的动作 0 暂停激流; 1 删除激流
 		ListenPort:      int32(*pre.PeerPort),         // 用于传入连接的端口
-		Upnp:            false,                        // 是否启用 UPnP/NAT-PMP
+		Upnp:            *pre.PortForwardingEnabled,   // 是否启用 UPnP/NAT-PMP
 		RandomPort:      *pre.PeerPortRandomOnStart,   // 是否随机选择端口
 
 		DlLimit:              dlLimit,                         // 全局下载速度限制
@@ -280,17 +669,23 @@ func (uc *AppUsecase) GetPreferences(ctx context.Context) (*pb.GetPreferencesRes
 }
 
 func (uc *AppUsecase) SetPreferences(ctx context.Context, pre *Preferences) (err error) {
-	if pre.ListenPort.HasValue() {
-		peerPort := int64(pre.ListenPort.Value())
-		trd := transmissionrpc.SessionArguments{
-			PeerPort: &peerPort,
-		}
-		err = uc.appRepo.SetPreferences(ctx, trd)
-		if err != nil {
-			return
+	ctx, span := tracer.Start(ctx, "AppUsecase.SetPreferences")
+	defer span.End()
+
+	if len(pre.Unsupported) > 0 {
+		uc.log.Warnf("忽略 tr 不支持的首选项: %s", strings.Join(pre.Unsupported, ", "))
+	}
+	if !uc.allowUnsafePreferences {
+		if unsafe := pre.dropUnsafe(); len(unsafe) > 0 {
+			uc.log.Warnf("未启用 infra.tr.allow_unsafe_preferences，忽略首选项: %s", strings.Join(unsafe, ", "))
 		}
 	}
 
+	err = uc.setPreferences(ctx, pre)
+	if err != nil {
+		return
+	}
+
 	if pre.BanList.HasValue() {
 		err = uc.BanIP(ctx, pre.BanList.Value())
 		if err != nil {
@@ -299,3 +694,197 @@ func (uc *AppUsecase) SetPreferences(ctx context.Context, pre *Preferences) (err
 	}
 	return
 }
+
+// setPreferences 更新 tr 会话参数与代理首选项
+// 每个后端的队列数量包含该后端慢速种子占用的数量，与慢速种子任务共用 QueueLock 避免增减被覆盖
+func (uc *AppUsecase) setPreferences(ctx context.Context, pre *Preferences) error {
+	uc.queueLock.Lock()
+	defer uc.queueLock.Unlock()
+
+	proxyPre, err := uc.appRepo.GetProxyPreferences(ctx)
+	if err != nil {
+		return err
+	}
+
+	trd, changed := preferencesToSessionArguments(pre)
+	if changed {
+		err = uc.appRepo.SetPreferences(ctx, trd, proxyPre.SlowSlots)
+		if err != nil {
+			return err
+		}
+	}
+
+	proxyPre, changed = preferencesToProxyPreferences(pre, proxyPre)
+	if changed {
+		return uc.appRepo.SaveProxyPreferences(ctx, proxyPre)
+	}
+	return nil
+}
+
+// preferencesToSessionArguments 将 qb 首选项转换为 tr 会话参数
+// 队列数量不包含慢速种子占用的数量，由 AppRepo.SetPreferences 按后端增加
+func preferencesToSessionArguments(pre *Preferences) (trd transmissionrpc.SessionArguments, changed bool) {
+
+	if pre.ListenPort.HasValue() {
+		peerPort := int64(pre.ListenPort.Value())
+		trd.PeerPort = &peerPort
+		changed = true
+	}
+	if pre.RandomPort.HasValue() {
+		randomPort := pre.RandomPort.Value()
+		trd.PeerPortRandomOnStart = &randomPort
+		changed = true
+	}
+	if pre.Upnp.HasValue() {
+		upnp := pre.Upnp.Value()
+		trd.PortForwardingEnabled = &upnp
+		changed = true
+	}
+
+	if pre.StartPausedEnabled.HasValue() {
+		startAdded := !pre.StartPausedEnabled.Value()
+		trd.StartAddedTorrents = &startAdded
+		changed = true
+	}
+	if pre.IncompleteFilesExt.HasValue() {
+		renamePartial := pre.IncompleteFilesExt.Value()
+		trd.RenamePartialFiles = &renamePartial
+		changed = true
+	}
+
+	if pre.SavePath.HasValue() {
+		savePath := pre.SavePath.Value()
+		trd.DownloadDir = &savePath
+		changed = true
+	}
+	if pre.TempPathEnabled.HasValue() {
+		tempPathEnabled := pre.TempPathEnabled.Value()
+		trd.IncompleteDirEnabled = &tempPathEnabled
+		changed = true
+	}
+	if pre.TempPath.HasValue() {
+		tempPath := pre.TempPath.Value()
+		trd.IncompleteDir = &tempPath
+		changed = true
+	}
+
+	if pre.AutorunEnabled.HasValue() {
+		autorunEnabled := pre.AutorunEnabled.Value()
+		trd.ScriptTorrentDoneEnabled = &autorunEnabled
+		changed = true
+	}
+	if pre.AutorunProgram.HasValue() {
+		autorunProgram := pre.AutorunProgram.Value()
+		trd.ScriptTorrentDoneFilename = &autorunProgram
+		changed = true
+	}
+
+	// qb 使用 -1 表示不限制，tr 通过 enabled 开关控制队列
+	if pre.QueueingEnabled.HasValue() {
+		queueingEnabled := pre.QueueingEnabled.Value()
+		trd.DownloadQueueEnabled = &queueingEnabled
+		trd.SeedQueueEnabled = &queueingEnabled
+		changed = true
+	}
+	if pre.MaxActiveDownloads.HasValue() {
+		size := int64(pre.MaxActiveDownloads.Value())
+		enabled := size >= 0
+		if !pre.QueueingEnabled.HasValue() || pre.QueueingEnabled.Value() {
+			trd.DownloadQueueEnabled = &enabled
+		}
+		if enabled {
+			trd.DownloadQueueSize = &size
+		}
+		changed = true
+	}
+	if pre.MaxActiveUploads.HasValue() {
+		size := int64(pre.MaxActiveUploads.Value())
+		enabled := size >= 0
+		if !pre.QueueingEnabled.HasValue() || pre.QueueingEnabled.Value() {
+			trd.SeedQueueEnabled = &enabled
+		}
+		if enabled {
+			trd.SeedQueueSize = &size
+		}
+		changed = true
+	}
+
+	if pre.MaxRatioEnabled.HasValue() {
+		ratioLimited := pre.MaxRatioEnabled.Value()
+		trd.SeedRatioLimited = &ratioLimited
+		changed = true
+	}
+	if pre.MaxRatio.HasValue() {
+		ratio := float64(pre.MaxRatio.Value())
+		if ratio >= 0 {
+			trd.SeedRatioLimit = &ratio
+		} else {
+			ratioLimited := false
+			trd.SeedRatioLimited = &ratioLimited
+		}
+		changed = true
+	}
+
+	// qb 速度限制单位为 字节/秒，小于等于0表示不限制
+	if pre.DlLimit.HasValue() {
+		limit := speedLimitToKB(pre.DlLimit.Value())
+		enabled := limit > 0
+		trd.SpeedLimitDownEnabled = &enabled
+		if enabled {
+			trd.SpeedLimitDown = &limit
+		}
+		changed = true
+	}
+	if pre.UpLimit.HasValue() {
+		limit := speedLimitToKB(pre.UpLimit.Value())
+		enabled := limit > 0
+		trd.SpeedLimitUpEnabled = &enabled
+		if enabled {
+			trd.SpeedLimitUp = &limit
+		}
+		changed = true
+	}
+
+	if pre.MaxConnec.HasValue() && pre.MaxConnec.Value() > 0 {
+		peerLimit := int64(pre.MaxConnec.Value())
+		trd.PeerLimitGlobal = &peerLimit
+		changed = true
+	}
+	if pre.MaxConnecPerTorrent.HasValue() && pre.MaxConnecPerTorrent.Value() > 0 {
+		peerLimit := int64(pre.MaxConnecPerTorrent.Value())
+		trd.PeerLimitPerTorrent = &peerLimit
+		changed = true
+	}
+	return
+}
+
+// speedLimitToKB 将 qb 的速度限制(字节/秒)向上取整为 tr 的 kB/s，
+// 避免小于 1kB/s 的限制被截断为 0 而变成不限制
+func speedLimitToKB(limit int32) int64 {
+	if limit <= 0 {
+		return 0
+	}
+	return (int64(limit) + speedLimitUnit - 1) / speedLimitUnit
+}
+
+// preferencesToProxyPreferences 更新由代理模拟实现的首选项
+func preferencesToProxyPreferences(pre *Preferences, proxyPre ProxyPreferences) (ProxyPreferences, bool) {
+	changed := false
+	if pre.DontCountSlowTorrents.HasValue() {
+		proxyPre.DontCountSlowTorrents = pre.DontCountSlowTorrents.Value()
+		changed = true
+	}
+	if pre.SlowTorrentDlRateThreshold.HasValue() {
+		proxyPre.SlowTorrentDlRateThreshold = max(pre.SlowTorrentDlRateThreshold.Value(), 0)
+		changed = true
+	}
+	if pre.SlowTorrentUlRateThreshold.HasValue() {
+		proxyPre.SlowTorrentUlRateThreshold = max(pre.SlowTorrentUlRateThreshold.Value(), 0)
+		changed = true
+	}
+	if pre.SlowTorrentInactiveTimer.HasValue() {
+		proxyPre.SlowTorrentInactiveTimer = max(pre.SlowTorrentInactiveTimer.Value(), 0)
+		changed = true
+	}
+	return proxyPre, changed
+}
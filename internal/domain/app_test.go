@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"testing"
+
+	col "github.com/noxiouz/golang-generics-util/collection"
+)
+
+func TestSpeedLimitToKB(t *testing.T) {
+	for _, tt := range []struct {
+		limit int32
+		want  int64
+	}{
+		{-1, 0},
+		{0, 0},
+		{1, 1},
+		{999, 1},
+		{1000, 1},
+		{1001, 2},
+		{2048, 3},
+	} {
+		if got := speedLimitToKB(tt.limit); got != tt.want {
+			t.Errorf("speedLimitToKB(%d) = %d, want %d", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestPreferencesToSessionArgumentsSpeedLimit(t *testing.T) {
+	pre := NewPreferences()
+	pre.DlLimit = col.Some[int32](500)
+	pre.UpLimit = col.Some[int32](0)
+	trd, changed := preferencesToSessionArguments(pre)
+	if !changed {
+		t.Fatal("changed = false, want true")
+	}
+	if !*trd.SpeedLimitDownEnabled || *trd.SpeedLimitDown != 1 {
+		t.Errorf("download limit = %v %v, want enabled 1 kB/s", *trd.SpeedLimitDownEnabled, trd.SpeedLimitDown)
+	}
+	if *trd.SpeedLimitUpEnabled {
+		t.Error("upload limit enabled, want unlimited")
+	}
+}
@@ -0,0 +1,79 @@
+package domain_test
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"transmission-proxy/internal/domain"
+	"transmission-proxy/internal/fake"
+
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// TestRestoreBans 通过管理接口封禁的ip在重启后恢复，保留封禁原因与到期时间
+func TestRestoreBans(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewFilter(log.NewStdLogger(os.Stderr), log.FilterLevel(log.LevelError))
+
+	banIPRepo := fake.NewBanIPRepo()
+	uc := domain.NewAppUsecase(nil, nil, banIPRepo, domain.NewQueueLock(), logger)
+	if err := uc.BanIPWithOptions(ctx, []string{"203.0.113.7"}, domain.BanOptions{Reason: "吸血", TTL: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if err := uc.BanIPWithOptions(ctx, []string{"203.0.113.8"}, domain.BanOptions{TTL: time.Nanosecond}); err != nil {
+		t.Fatal(err)
+	}
+	before, err := uc.GetBannedIPs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启后 nftables 封禁表为空，只剩下保存的附加信息
+	infos, err := banIPRepo.GetBanInfos(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restartedRepo := fake.NewBanIPRepo()
+	if err = restartedRepo.SaveBanInfos(ctx, infos); err != nil {
+		t.Fatal(err)
+	}
+	restarted := domain.NewAppUsecase(nil, nil, restartedRepo, domain.NewQueueLock(), logger)
+
+	restored, err := restarted.RestoreBans(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"203.0.113.7"}; !slices.Equal(restored, want) {
+		t.Errorf("restored = %v, want %v", restored, want)
+	}
+	if banned := restartedRepo.BannedIPs(); !slices.Equal(banned, restored) {
+		t.Errorf("banned = %v, want %v", banned, restored)
+	}
+
+	after, err := restarted.GetBannedIPs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != 1 {
+		t.Fatalf("banned ips = %+v, want 1", after)
+	}
+	got, want := after[0], before[0]
+	if got.Source != domain.BanSourceAdmin || got.Reason != want.Reason || !got.ExpiresAt.Equal(want.ExpiresAt) {
+		t.Errorf("restored ban = %+v, want %+v", got, want)
+	}
+
+	// 到期的ip不再保存，解禁后同样删除
+	if err = restarted.UnbanIP(ctx, []string{"203.0.113.7"}); err != nil {
+		t.Fatal(err)
+	}
+	infos, err = restartedRepo.GetBanInfos(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 0 {
+		t.Errorf("ban infos = %+v, want empty", infos)
+	}
+}
@@ -0,0 +1,212 @@
+package domain_test
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"transmission-proxy/conf"
+	"transmission-proxy/internal/data"
+	"transmission-proxy/internal/domain"
+	"transmission-proxy/internal/fake"
+
+	"github.com/go-kratos/kratos/v2/log"
+	col "github.com/noxiouz/golang-generics-util/collection"
+)
+
+const (
+	torrentCount = 64
+	peerCount    = 16
+	readerCount  = 8
+)
+
+// concurrencyDuration 并发测试的运行时间，-short 时缩短
+func concurrencyDuration() time.Duration {
+	if testing.Short() {
+		return 200 * time.Millisecond
+	}
+	return time.Second
+}
+
+// newTestTorrentUsecase 使用内存中的仓储创建 TorrentUsecase
+func newTestTorrentUsecase(t *testing.T) *domain.TorrentUsecase {
+	t.Helper()
+	logger := log.NewFilter(log.NewStdLogger(os.Stderr), log.FilterLevel(log.LevelError))
+	uc := domain.NewTorrentUsecase(&conf.Bootstrap{}, fake.NewAppRepo(), fake.NewBanIPRepo(),
+		fake.NewGeoIPRepo(), fake.NewTorrentRepo(torrentCount, peerCount), fake.NewTrafficRepo(),
+		domain.NewQueueLock(), logger)
+	// 读取前先完成一次刷新
+	if err := uc.UpClientData(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return uc
+}
+
+// runConcurrently 在 d 时间内并发地循环执行每个函数
+func runConcurrently(d time.Duration, fns ...func(ctx context.Context, i int)) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, fn := range fns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ctx.Err() == nil; i++ {
+				fn(ctx, i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// TestConcurrentRefreshAndRead 刷新任务、配置热更新与读取并发执行，配合 -race 检查数据竞争
+func TestConcurrentRefreshAndRead(t *testing.T) {
+	uc := newTestTorrentUsecase(t)
+
+	bootstraps := []*conf.Bootstrap{{}, {
+		Infra: &conf.Infra{Tr: &conf.Infra_TR{
+			Transfer:        "http://tracker.example.com/announce",
+			SubTransfer:     "http://tracker.example.com/list.txt",
+			AddTorrentLabel: "concurrency",
+			TrackerMaxSize:  8,
+		}},
+	}}
+	fns := []func(ctx context.Context, i int){
+		// 刷新任务
+		func(ctx context.Context, _ int) {
+			if err := uc.UpClientData(ctx); err != nil && ctx.Err() == nil {
+				t.Errorf("UpClientData: %v", err)
+			}
+			if err := uc.UpSlowTorrentQueue(ctx); err != nil && ctx.Err() == nil {
+				t.Errorf("UpSlowTorrentQueue: %v", err)
+			}
+		},
+		func(ctx context.Context, _ int) {
+			if err := uc.UpTrackerList(ctx); err != nil && ctx.Err() == nil {
+				t.Errorf("UpTrackerList: %v", err)
+			}
+			if err := uc.UpTorrentALLTrackerList(ctx); err != nil && ctx.Err() == nil {
+				t.Errorf("UpTorrentALLTrackerList: %v", err)
+			}
+		},
+		func(ctx context.Context, _ int) {
+			if err := uc.SaveStatistics(); err != nil {
+				t.Errorf("SaveStatistics: %v", err)
+			}
+			if err := uc.PruneTraffic(ctx); err != nil && ctx.Err() == nil {
+				t.Errorf("PruneTraffic: %v", err)
+			}
+			time.Sleep(time.Millisecond)
+		},
+		// 配置热更新
+		func(_ context.Context, i int) {
+			uc.ApplyConfig(bootstraps[i%len(bootstraps)])
+			time.Sleep(time.Millisecond)
+		},
+		func(ctx context.Context, i int) {
+			err := uc.SetForceStart(ctx, []string{fake.Hash(i % torrentCount)}, i%2 == 0)
+			if err != nil && ctx.Err() == nil {
+				t.Errorf("SetForceStart: %v", err)
+			}
+		},
+	}
+
+	// 读取
+	for r := 0; r < readerCount; r++ {
+		lastSession := int64(0)
+		fns = append(fns, func(ctx context.Context, i int) {
+			hash := fake.Hash(i % torrentCount)
+			if _, err := uc.GetTorrentList(ctx, domain.TorrentFilter{
+				Status:   col.Some("all"),
+				Category: col.None[string](),
+				Label:    col.None[string](),
+				Hashes:   col.Some([]string{hash}),
+			}); err != nil {
+				t.Errorf("GetTorrentList: %v", err)
+			}
+			if _, err := uc.GetTorrentProperties(ctx, hash); err != nil {
+				t.Errorf("GetTorrentProperties: %v", err)
+			}
+			if _, err := uc.GetPeers(ctx, hash); err != nil {
+				t.Errorf("GetPeers: %v", err)
+			}
+			if _, err := uc.GetPieceStates(ctx, hash); err != nil {
+				t.Errorf("GetPieceStates: %v", err)
+			}
+			if _, err := uc.GetWebSeeds(ctx, hash); err != nil {
+				t.Errorf("GetWebSeeds: %v", err)
+			}
+			_ = uc.GetTorrents()
+			_ = uc.GetServerState()
+			_ = uc.GetHealth(ctx)
+
+			// 同一读取者看到的会话统计只会增加
+			statistics := uc.GetStatistics()
+			if statistics.TotalDownloadedSession < lastSession {
+				t.Errorf("会话下载量减少 %d -> %d", lastSession, statistics.TotalDownloadedSession)
+			}
+			lastSession = statistics.TotalDownloadedSession
+		})
+	}
+	runConcurrently(concurrencyDuration(), fns...)
+
+	if n := len(uc.GetTorrents()); n != torrentCount {
+		t.Errorf("种子数量 %d, 期望 %d", n, torrentCount)
+	}
+}
+
+// TestConcurrentPreferencesAndSlowQueue 更新首选项与慢速种子任务并发执行，队列数量始终等于设置值加慢速种子占用的数量
+func TestConcurrentPreferencesAndSlowQueue(t *testing.T) {
+	logger := log.NewFilter(log.NewStdLogger(os.Stderr), log.FilterLevel(log.LevelError))
+	appRepo := fake.NewAppRepo()
+	queueLock := domain.NewQueueLock()
+	uc := domain.NewTorrentUsecase(&conf.Bootstrap{}, appRepo, fake.NewBanIPRepo(), fake.NewGeoIPRepo(),
+		fake.NewTorrentRepo(torrentCount, peerCount), fake.NewTrafficRepo(), queueLock, logger)
+	appUc := domain.NewAppUsecase(&conf.Bootstrap{}, appRepo, fake.NewBanIPRepo(), queueLock, logger)
+	ctx := context.Background()
+	if err := uc.UpClientData(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	const maxActiveDownloads = 5
+	pre := domain.NewPreferences()
+	pre.QueueingEnabled = col.Some(true)
+	pre.MaxActiveDownloads = col.Some[int32](maxActiveDownloads)
+	if err := appUc.SetPreferences(ctx, pre); err != nil {
+		t.Fatal(err)
+	}
+	runConcurrently(concurrencyDuration(),
+		func(ctx context.Context, _ int) {
+			if err := uc.UpClientData(ctx); err != nil && ctx.Err() == nil {
+				t.Errorf("UpClientData: %v", err)
+			}
+			if err := uc.UpSlowTorrentQueue(ctx); err != nil && ctx.Err() == nil {
+				t.Errorf("UpSlowTorrentQueue: %v", err)
+			}
+		},
+		func(ctx context.Context, i int) {
+			// 切换是否排除慢速种子，使慢速种子占用的数量不断变化
+			pre := domain.NewPreferences()
+			pre.DontCountSlowTorrents = col.Some(i%2 == 0)
+			if err := appUc.SetPreferences(ctx, pre); err != nil && ctx.Err() == nil {
+				t.Errorf("SetPreferences: %v", err)
+			}
+		},
+	)
+
+	trd, err := appRepo.GetPreferences(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxyPre, err := appRepo.GetProxyPreferences(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slowSlots := proxyPre.SlowSlots[data.DefaultBackendName]
+	if trd.DownloadQueueSize == nil || *trd.DownloadQueueSize != maxActiveDownloads+slowSlots.Download {
+		t.Errorf("下载队列数量 %v, 期望 %d + 慢速种子 %d", trd.DownloadQueueSize, maxActiveDownloads,
+			slowSlots.Download)
+	}
+}
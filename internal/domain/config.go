@@ -0,0 +1,117 @@
+package domain
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"transmission-proxy/conf"
+
+	col "github.com/noxiouz/golang-generics-util/collection"
+)
+
+// torrentConfig 可以热更新的配置快照
+// 快照发布后不再修改，配置变化时整体替换
+type torrentConfig struct {
+	// torrentLabel 默认添加到的标签
+	torrentLabel col.Option[string]
+	// defaultTrackers 配置文件中默认添加的Tracker
+	defaultTrackers []string
+	// subTransferURL 订阅的Transfer列表URL
+	subTransferURL string
+	// trackerMaxSize 数量上限
+	trackerMaxSize int
+
+	rootURL string
+
+	// stateRefreshInterval 状态更新间隔(秒)
+	stateRefreshInterval int64
+}
+
+// newTorrentConfig 从配置文件读取可以热更新的配置
+// 配置文件中没有刷新间隔时使用 stateRefreshInterval，启动时为 tr 仓储的默认间隔，热更新时保留当前的间隔
+func newTorrentConfig(bootstrap *conf.Bootstrap, stateRefreshInterval int64) *torrentConfig {
+	config := bootstrap.GetInfra().GetTr()
+
+	defaultTrackers := strings.Split(config.GetTransfer(), "\n")
+	trackers := make(map[string]struct{}, len(defaultTrackers))
+	for _, tracker := range defaultTrackers {
+		// 检查url
+		urlStr := strings.TrimSpace(tracker)
+		if urlStr != "" {
+			trackerURL, err := url.ParseRequestURI(urlStr)
+			if err == nil {
+				trackers[trackerURL.String()] = struct{}{}
+			}
+		}
+	}
+	defaultTrackers = make([]string, 0, len(defaultTrackers))
+	for urlStr := range trackers {
+		defaultTrackers = append(defaultTrackers, urlStr)
+	}
+	// 排序后可以比较两次配置的 Tracker 是否相同
+	slices.Sort(defaultTrackers)
+
+	c := &torrentConfig{
+		torrentLabel:         col.None[string](),
+		defaultTrackers:      defaultTrackers,
+		subTransferURL:       config.GetSubTransfer(),
+		trackerMaxSize:       int(config.GetTrackerMaxSize()),
+		rootURL:              bootstrap.GetTrigger().GetHttp().GetRootUrl(),
+		stateRefreshInterval: stateRefreshInterval,
+	}
+	if torrentLabel := config.GetAddTorrentLabel(); torrentLabel != "" {
+		c.torrentLabel = col.Some(torrentLabel)
+	}
+	if config.GetRequestInterval() != nil {
+		c.stateRefreshInterval = int64(config.GetRequestInterval().AsDuration().Seconds())
+	}
+	return c
+}
+
+// loadConfig 获取当前的配置快照
+func (uc *TorrentUsecase) loadConfig() *torrentConfig {
+	return uc.config.Load()
+}
+
+// ApplyConfig 热更新配置，返回是否需要重新更新 Tracker 列表
+func (uc *TorrentUsecase) ApplyConfig(bootstrap *conf.Bootstrap) (trackersChanged bool) {
+	previous := uc.loadConfig()
+	current := newTorrentConfig(bootstrap, previous.stateRefreshInterval)
+
+	changed := func(key string, from any, to any) {
+		uc.log.Infof("配置已更新: %s %v -> %v", key, from, to)
+	}
+	if !slices.Equal(previous.defaultTrackers, current.defaultTrackers) {
+		changed("infra.tr.transfer", len(previous.defaultTrackers), len(current.defaultTrackers))
+		trackersChanged = true
+	}
+	if previous.subTransferURL != current.subTransferURL {
+		changed("infra.tr.sub_transfer", previous.subTransferURL, current.subTransferURL)
+		trackersChanged = true
+	}
+	if previous.trackerMaxSize != current.trackerMaxSize {
+		changed("infra.tr.tracker_max_size", previous.trackerMaxSize, current.trackerMaxSize)
+		trackersChanged = true
+	}
+	label := func(torrentLabel col.Option[string]) string {
+		if torrentLabel.HasValue() {
+			return torrentLabel.Value()
+		}
+		return ""
+	}
+	if label(previous.torrentLabel) != label(current.torrentLabel) {
+		changed("infra.tr.add_torrent_label", label(previous.torrentLabel), label(current.torrentLabel))
+	}
+	if previous.rootURL != current.rootURL {
+		changed("trigger.http.root_url", previous.rootURL, current.rootURL)
+	}
+	if previous.stateRefreshInterval != current.stateRefreshInterval {
+		changed("infra.tr.request_interval", time.Duration(previous.stateRefreshInterval)*time.Second,
+			time.Duration(current.stateRefreshInterval)*time.Second)
+	}
+
+	uc.config.Store(current)
+	return
+}
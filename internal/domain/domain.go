@@ -5,6 +5,8 @@ import (
 	"context"
 	"github.com/google/wire"
 	col "github.com/noxiouz/golang-generics-util/collection"
+	"go.opentelemetry.io/otel"
+	"sync"
 	"time"
 )
 
@@ -13,8 +15,22 @@ var (
 // ErrUserNotFound = errors.NotFound(v1.ErrorReason_USER_NOT_FOUND.String(), "user not found")
 )
 
+// tracer 用例层的 Tracer
+var tracer = otel.Tracer("transmission-proxy/internal/domain")
+
 // ProviderSet is biz providers.
-var ProviderSet = wire.NewSet(NewAppUsecase, NewTorrentUsecase)
+var ProviderSet = wire.NewSet(NewQueueLock, NewAppUsecase, NewTorrentUsecase)
+
+// QueueLock 串行化对 tr 队列数量与慢速队列数量的读改写
+// 更新首选项与慢速种子任务都会在 tr 队列数量上增减慢速种子占用的数量，需要使用同一个锁
+type QueueLock struct {
+	sync.Mutex
+}
+
+// NewQueueLock .
+func NewQueueLock() *QueueLock {
+	return &QueueLock{}
+}
 
 // BanIPRepo .
 type BanIPRepo interface {
@@ -44,4 +60,60 @@ type BanIPRepo interface {
 
 	// ClearBanList 清空Ban列表
 	ClearBanList(ctx context.Context) error
+
+	// GetBannedIPs 获取所有封禁的ip
+	GetBannedIPs(ctx context.Context) ([]BannedIP, error)
+
+	// CheckTables 检查 nftables 中的封禁表是否存在
+	CheckTables(ctx context.Context) error
+
+	// GetBanInfos 获取通过管理接口封禁的ip的附加信息
+	GetBanInfos(ctx context.Context) (map[string]BanInfo, error)
+
+	// SaveBanInfos 保存通过管理接口封禁的ip的附加信息
+	SaveBanInfos(ctx context.Context, infos map[string]BanInfo) error
+}
+
+// BanSource 封禁来源
+type BanSource string
+
+const (
+	BanSourceQB    BanSource = "qb"    // 通过 qb 接口封禁，例如 PeerBanHelper
+	BanSourceAdmin BanSource = "admin" // 通过代理自身的管理接口封禁
+)
+
+// BannedIP 封禁的ip
+type BannedIP struct {
+	IP        string
+	BannedAt  time.Time // 封禁时间，不是由本进程封禁时为零值
+	Source    BanSource // 封禁来源
+	Reason    string    // 封禁原因，只有通过管理接口封禁时有
+	ExpiresAt time.Time // 到期时间，永久封禁时为零值
+}
+
+// BanInfo 通过管理接口封禁的ip的附加信息（写盘）
+type BanInfo struct {
+	Reason    string    // 封禁原因
+	ExpiresAt time.Time // 到期时间，永久封禁时为零值
+}
+
+// BanOptions 通过管理接口封禁时的附加信息
+type BanOptions struct {
+	Reason string        // 封禁原因
+	TTL    time.Duration // 封禁时长，为 0 时永久封禁
+}
+
+// Country IP所属国家
+type Country struct {
+	Name string // 国家名称
+	Code string // ISO 3166-1 国家代码
+}
+
+// GeoIPRepo .
+type GeoIPRepo interface {
+	// IsEnabled 是否配置了 GeoIP 数据库
+	IsEnabled(ctx context.Context) bool
+
+	// LookupCountry 查询IP所属国家，未配置数据库或没有记录时返回 None
+	LookupCountry(ctx context.Context, ip string) (col.Option[*Country], error)
 }
@@ -0,0 +1,94 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BackendStatus tr 后端状态
+type BackendStatus struct {
+	Name      string // 后端名称
+	Reachable bool   // tr RPC 是否可以访问
+	Version   int64  // tr RPC 版本
+	Error     string // 访问 tr RPC 的错误
+}
+
+// Health 服务健康状态
+type Health struct {
+	TRReachable bool            // 所有 tr 后端是否都可以访问
+	TRVersion   int64           // tr 后端中最低的 RPC 版本
+	TRError     string          // 访问 tr RPC 的错误
+	Backends    []BackendStatus // 每个 tr 后端的状态
+
+	LastClientDataTime  time.Time // 上次成功刷新 tr 客户端数据的时间
+	LastTrackerListTime time.Time // 上次成功更新 Tracker 订阅列表的时间
+
+	NFTablesReady bool   // nftables 封禁表是否存在
+	NFTablesError string // 检查 nftables 的错误
+
+	SaveStatisticsError string // 上次保存统计数据的错误
+}
+
+// Ready 是否可以提供服务
+// 首次刷新 tr 客户端数据完成前，种子与 Peer 数据都是空的
+// 部分 tr 后端无法访问时使用其余后端的数据，仍然可以提供服务
+func (h *Health) Ready() bool {
+	return h.anyBackendReachable() && h.NFTablesReady && !h.LastClientDataTime.IsZero()
+}
+
+// Degraded 可以提供服务但部分 tr 后端无法访问
+func (h *Health) Degraded() bool {
+	return h.Ready() && !h.TRReachable
+}
+
+// anyBackendReachable 是否至少有一个 tr 后端可以访问
+func (h *Health) anyBackendReachable() bool {
+	for _, backend := range h.Backends {
+		if backend.Reachable {
+			return true
+		}
+	}
+	return false
+}
+
+// GetHealth 获取服务健康状态
+func (uc *TorrentUsecase) GetHealth(ctx context.Context) *Health {
+	ctx, span := tracer.Start(ctx, "TorrentUsecase.GetHealth")
+	defer span.End()
+
+	health := &Health{
+		LastClientDataTime:  uc.loadState().updateTime,
+		LastTrackerListTime: uc.trackerState.Load().updateTime,
+	}
+
+	health.Backends = uc.torrentRepo.GetBackendStatus(ctx)
+	health.TRReachable = len(health.Backends) > 0
+	errs := make([]string, 0)
+	for _, backend := range health.Backends {
+		if !backend.Reachable {
+			health.TRReachable = false
+			errs = append(errs, fmt.Sprintf("%s: %s", backend.Name, backend.Error))
+			continue
+		}
+		if health.TRVersion == 0 || backend.Version < health.TRVersion {
+			health.TRVersion = backend.Version
+		}
+	}
+	health.TRError = strings.Join(errs, "; ")
+
+	err := uc.banIPRepo.CheckTables(ctx)
+	if err != nil {
+		health.NFTablesError = err.Error()
+	} else {
+		health.NFTablesReady = true
+	}
+
+	uc.saveStatisticsMutex.Lock()
+	if uc.lastSaveStatisticsErr != nil {
+		health.SaveStatisticsError = uc.lastSaveStatisticsErr.Error()
+	}
+	uc.saveStatisticsMutex.Unlock()
+	return health
+}
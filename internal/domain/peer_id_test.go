@@ -0,0 +1,24 @@
+package domain
+
+import "testing"
+
+func TestFingerprintClientName(t *testing.T) {
+	for _, tt := range []struct {
+		clientName string
+		want       string
+	}{
+		{"qBittorrent 4.5.2", "-qB4520-"},
+		{"Transmission 4.0.6", "-TR4060-"},
+		{"µTorrent Mac 1.8.7", "-UM1870-"},
+		{"µTorrent 3.5.5", "-UT3550-"},
+		{"libtorrent (Rasterbar) 2.0.10", "-LT20A0-"},
+		{"aria2", "-A20000-"},
+		{"-XY1234-", "-XY1234-"},
+		{"Unknown Client 1.0", ""},
+		{"", ""},
+	} {
+		if got := fingerprintClientName(tt.clientName); got != tt.want {
+			t.Errorf("fingerprintClientName(%q) = %q, want %q", tt.clientName, got, tt.want)
+		}
+	}
+}
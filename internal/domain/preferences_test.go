@@ -0,0 +1,46 @@
+package domain_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"transmission-proxy/conf"
+	"transmission-proxy/internal/domain"
+	"transmission-proxy/internal/fake"
+
+	"github.com/go-kratos/kratos/v2/log"
+	col "github.com/noxiouz/golang-generics-util/collection"
+)
+
+// TestSetUnsafePreferences 未启用 allow_unsafe_preferences 时忽略修改 tr 主机路径与外部程序的首选项
+func TestSetUnsafePreferences(t *testing.T) {
+	logger := log.NewFilter(log.NewStdLogger(os.Stderr), log.FilterLevel(log.LevelError))
+	for _, allow := range []bool{false, true} {
+		appRepo := fake.NewAppRepo()
+		bootstrap := &conf.Bootstrap{Infra: &conf.Infra{Tr: &conf.Infra_TR{AllowUnsafePreferences: allow}}}
+		uc := domain.NewAppUsecase(bootstrap, appRepo, fake.NewBanIPRepo(), domain.NewQueueLock(), logger)
+
+		pre := domain.NewPreferences()
+		pre.SavePath = col.Some("/etc")
+		pre.AutorunProgram = col.Some("/bin/sh -c id")
+		pre.MaxActiveDownloads = col.Some[int32](5)
+		if err := uc.SetPreferences(context.Background(), pre); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := appRepo.GetPreferences(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.DownloadQueueSize == nil || *got.DownloadQueueSize != 5 {
+			t.Errorf("allow=%v: download queue size = %v, want 5", allow, got.DownloadQueueSize)
+		}
+		if changed := *got.DownloadDir == "/etc"; changed != allow {
+			t.Errorf("allow=%v: download dir = %s", allow, *got.DownloadDir)
+		}
+		if changed := got.ScriptTorrentDoneFilename != nil; changed != allow {
+			t.Errorf("allow=%v: script = %v", allow, got.ScriptTorrentDoneFilename)
+		}
+	}
+}
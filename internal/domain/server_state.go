@@ -0,0 +1,120 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// 与 qb 一致的连接状态
+const (
+	ConnectionStatusConnected    = "connected"
+	ConnectionStatusFirewalled   = "firewalled"
+	ConnectionStatusDisconnected = "disconnected"
+)
+
+// freeSpaceRefreshInterval 剩余磁盘空间刷新间隔
+const freeSpaceRefreshInterval = 30 * time.Second
+
+// SessionStats tr 的会话统计
+type SessionStats struct {
+	DownloadSpeed        int64 // 下载速度（字节/秒）
+	UploadSpeed          int64 // 上传速度（字节/秒）
+	CumulativeDownloaded int64 // tr 所有时间下载总量（字节）
+	CumulativeUploaded   int64 // tr 所有时间上传总量（字节）
+	CurrentDownloaded    int64 // tr 本次启动后下载总量（字节）
+	CurrentUploaded      int64 // tr 本次启动后上传总量（字节）
+}
+
+// ServerState 服务器状态
+type ServerState struct {
+	FreeSpaceOnDisk      int64  // 默认保存目录所在磁盘的剩余空间（字节）
+	TotalPeerConnections int64  // 所有种子的 Peer 连接数
+	DHTNodes             int64  // tr 不提供 DHT 节点数，使用通过 DHT 发现的已连接 Peer 数代替
+	ConnectionStatus     string // 连接状态
+}
+
+// GetServerState 获取服务器状态
+func (uc *TorrentUsecase) GetServerState() ServerState {
+	return uc.loadState().serverState
+}
+
+// setDisconnected 无法访问 tr 时将连接状态改为未连接
+func (uc *TorrentUsecase) setDisconnected() {
+	uc.updateState(func(state *clientState) {
+		state.serverState.ConnectionStatus = ConnectionStatusDisconnected
+	})
+}
+
+// upSessionStats 根据 tr 的会话统计更新统计数据
+// tr 的累计统计在 tr 重启后保留，本次统计在 tr 重启后清零，代理按两次采样的差值累加，不受 tr 重启影响
+// 每个后端分别计算差值，未连接的后端保留上次的采样，重新连接后累加期间的差值
+func (uc *TorrentUsecase) upSessionStats(ctx context.Context) error {
+	backendStats, err := uc.torrentRepo.GetSessionStats(ctx)
+	if err != nil {
+		return err
+	}
+
+	uc.statistics.DownloadSpeed = 0
+	uc.statistics.UploadSpeed = 0
+	for name, stats := range backendStats {
+		if last, ok := uc.lastSessionStats[name]; ok {
+			downloaded := stats.CumulativeDownloaded - last.CumulativeDownloaded
+			uploaded := stats.CumulativeUploaded - last.CumulativeUploaded
+			// 累计统计变小说明 tr 的统计文件被重置，只能使用 tr 本次启动后的统计
+			if downloaded < 0 || uploaded < 0 {
+				downloaded = stats.CurrentDownloaded
+				uploaded = stats.CurrentUploaded
+			}
+			uc.statistics.TotalDownloadedSession = uc.statistics.TotalDownloadedSession + downloaded
+			uc.statistics.TotalUploadedSession = uc.statistics.TotalUploadedSession + uploaded
+		}
+		uc.lastSessionStats[name] = stats
+		uc.statistics.DownloadSpeed = uc.statistics.DownloadSpeed + stats.DownloadSpeed
+		uc.statistics.UploadSpeed = uc.statistics.UploadSpeed + stats.UploadSpeed
+	}
+	return nil
+}
+
+// upServerState 根据种子数据计算服务器状态
+func (uc *TorrentUsecase) upServerState(ctx context.Context, nowTime time.Time, previous ServerState,
+	torrents map[string]*Torrent) ServerState {
+
+	state := ServerState{
+		FreeSpaceOnDisk:  previous.FreeSpaceOnDisk,
+		ConnectionStatus: ConnectionStatusFirewalled,
+	}
+	for _, torrent := range torrents {
+		state.TotalPeerConnections = state.TotalPeerConnections + torrent.PeerCount
+		state.DHTNodes = state.DHTNodes + torrent.PeerFromDHTCount
+		if torrent.PeerFromIncomingCount > 0 {
+			uc.hasIncomingConnections = true
+		}
+	}
+	// 与 qb 一致，收到过入站连接即认为端口可以连通
+	if uc.hasIncomingConnections {
+		state.ConnectionStatus = ConnectionStatusConnected
+	}
+
+	if nowTime.Sub(uc.lastFreeSpaceTime) >= freeSpaceRefreshInterval {
+		freeSpace, err := uc.getFreeSpace(ctx)
+		if err != nil {
+			uc.log.Warnf("获取剩余磁盘空间失败: %v", err)
+		} else {
+			state.FreeSpaceOnDisk = freeSpace
+			uc.lastFreeSpaceTime = nowTime
+		}
+	}
+	return state
+}
+
+// getFreeSpace 获取默认保存目录所在磁盘的剩余空间
+func (uc *TorrentUsecase) getFreeSpace(ctx context.Context) (int64, error) {
+	pre, err := uc.appRepo.GetPreferences(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if pre.DownloadDir == nil {
+		return 0, nil
+	}
+	return uc.torrentRepo.GetFreeSpace(ctx, *pre.DownloadDir)
+}
@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"context"
+	"testing"
+)
+
+// sessionStatsRepo 按顺序返回每次采样的会话统计
+type sessionStatsRepo struct {
+	TorrentRepo
+	samples []map[string]SessionStats
+}
+
+func (r *sessionStatsRepo) GetSessionStats(_ context.Context) (map[string]SessionStats, error) {
+	stats := r.samples[0]
+	r.samples = r.samples[1:]
+	return stats, nil
+}
+
+// TestUpSessionStatsBackends 后端断开与重新连接时累计统计不会重复计算
+func TestUpSessionStatsBackends(t *testing.T) {
+	repo := &sessionStatsRepo{samples: []map[string]SessionStats{
+		{"main": {CumulativeDownloaded: 100, DownloadSpeed: 1}},
+		// anime 启动时未连接，第一次采样只作为基准
+		{"main": {CumulativeDownloaded: 150, DownloadSpeed: 1}, "anime": {CumulativeDownloaded: 1000, DownloadSpeed: 2}},
+		// anime 断开
+		{"main": {CumulativeDownloaded: 160, DownloadSpeed: 1}},
+		// anime 重新连接，累加断开期间的差值
+		{"main": {CumulativeDownloaded: 170, DownloadSpeed: 1}, "anime": {CumulativeDownloaded: 1100, DownloadSpeed: 2}},
+	}}
+	uc := &TorrentUsecase{torrentRepo: repo, lastSessionStats: make(map[string]SessionStats)}
+
+	for i, want := range []struct{ total, speed int64 }{{0, 1}, {50, 3}, {60, 1}, {170, 3}} {
+		if err := uc.upSessionStats(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if uc.statistics.TotalDownloadedSession != want.total || uc.statistics.DownloadSpeed != want.speed {
+			t.Errorf("第 %d 次采样后下载总量 %d 速度 %d, 期望 %d %d", i+1,
+				uc.statistics.TotalDownloadedSession, uc.statistics.DownloadSpeed, want.total, want.speed)
+		}
+	}
+}
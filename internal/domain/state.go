@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"time"
+)
+
+// clientState tr 客户端数据快照
+// 快照发布后不再修改，读取时无需加锁；更新时复制后整体替换
+type clientState struct {
+	// torrents key: <Hash>
+	torrents    map[string]*Torrent
+	statistics  Statistics
+	serverState ServerState
+	// updateTime 刷新 tr 客户端数据的时间
+	updateTime time.Time
+}
+
+// trackerState Tracker 列表快照
+type trackerState struct {
+	// trackers 所有需要使用的Transfer列表
+	trackers []string
+	// updateTime 成功更新 Tracker 订阅列表的时间
+	updateTime time.Time
+	// subscription 订阅列表中的 Tracker，不包含配置文件中已有的
+	subscription []string
+	// checkTime 上次请求订阅列表的时间
+	checkTime time.Time
+	// err 上次请求订阅列表的错误
+	err error
+}
+
+// loadState 获取当前的客户端数据快照
+func (uc *TorrentUsecase) loadState() *clientState {
+	return uc.state.Load()
+}
+
+// updateState 基于当前快照生成新快照并发布
+// fn 只能替换快照中的字段，不能修改当前快照引用的数据
+func (uc *TorrentUsecase) updateState(fn func(state *clientState)) {
+	uc.stateMutex.Lock()
+	defer uc.stateMutex.Unlock()
+
+	state := *uc.state.Load()
+	fn(&state)
+	uc.state.Store(&state)
+}
+
+// loadTrackers 获取当前的 Tracker 列表
+func (uc *TorrentUsecase) loadTrackers() []string {
+	return uc.trackerState.Load().trackers
+}
@@ -2,9 +2,16 @@ package domain
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"maps"
+	"math"
+	"math/bits"
 	"net/url"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	pb "transmission-proxy/api/v2"
@@ -16,12 +23,16 @@ import (
 	"github.com/hekmon/cunits/v2"
 	"github.com/hekmon/transmissionrpc/v3"
 	col "github.com/noxiouz/golang-generics-util/collection"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 const (
 	categoryPrefix    = "category:"
 	torrentFileSuffix = ".torrent"
 	skipIPsDuration   = 60 * time.Second
+
+	// peerMissedPolls 两次采样间隔超过多少个刷新间隔时认为错过了轮询
+	peerMissedPolls = 3
 )
 
 type PeerKey struct {
@@ -39,7 +50,8 @@ type Peer struct {
 	IP            string  // IP 地址
 	Port          uint16  // 端口号
 	Connection    string  // 连接类型
-	PeerIdClient  string  // 客户端的 Peer ID
+	PeerID        string  // 原始 Peer ID，tr 不提供时为空
+	PeerIdClient  string  // 客户端的 Peer ID 前缀（-XX1234-）
 	ClientName    string  // 客户端名称
 	Progress      float32 // 进度（0-100%）
 	DownloadSpeed int64   // 下载速度（字节/秒）
@@ -47,13 +59,32 @@ type Peer struct {
 	UploadSpeed   int64   // 上传速度（字节/秒）
 	Uploaded      int64   // 已上传数据量（字节） 代理计算
 	Flags         string  // 标志信息
-	//Country     string  // 国家
-	//CountryCode string  // 国家代码
+	Country       string  // 国家
+	CountryCode   string  // 国家代码
 
 	// 活跃
 	IsActive bool
+	// Relevance 相关性，Peer 拥有我们缺少的片段所占的比例（0-1）
+	Relevance float32
+	// Files 可以从该 Peer 下载的文件
+	Files []string
+
+	// LastSeen 最近一次从 tr 获取到该 Peer 的时间
+	LastSeen time.Time
+	// Estimated 最近一次累加到 Downloaded/Uploaded 的流量为估算值（Peer 刚连接或错过了轮询）
+	// 连续两次轮询都获取到 Peer 后清除
+	Estimated bool
 }
 
+// PieceState 种子片段状态
+type PieceState int32
+
+const (
+	PieceStateNotDownloaded PieceState = 0 // 未下载
+	PieceStateDownloading   PieceState = 1 // 正在下载
+	PieceStateDownloaded    PieceState = 2 // 已下载
+)
+
 type DownloadTorrent struct {
 	URL      string               // 种子url
 	Path     col.Option[string]   // 种子保存路径
@@ -65,6 +96,7 @@ type DownloadTorrent struct {
 
 // Torrent 种子
 type Torrent struct {
+	ID                     int64                  // tr 中的种子ID
 	Hash                   string                 // 种子的哈希值
 	Name                   string                 // 种子名称
 	URL                    string                 // 种子url
@@ -87,7 +119,13 @@ type Torrent struct {
 	TotalUploaded          int64                  // 种子上传的总数据量（字节）
 	TotalUploadedSession   int64                  // 种子上传的总数据量（字节） TR:noFunc
 
-	FileCount int32 // 拥有文件数 TR:noFunc
+	FileCount  int32    // 拥有文件数 TR:noFunc
+	PieceCount int32    // 种子片段的数量
+	Pieces     []byte   // 已拥有片段的位图
+	WebSeeds   []string // Web 种子 URL
+	Files      []TorrentFile
+
+	TrackerCount int64 // Tracker 数量
 
 	RatioLimit    col.Option[float32] // 设置的分享比限制
 	SeedTimeLimit col.Option[int64]   // 种子达到的最大做种时间限制（秒）
@@ -97,6 +135,9 @@ type Torrent struct {
 	MaxPeerCount  int64 // 种子连接数限制
 	PeerSendCount int64 // 连接到的种子数量
 
+	PeerFromDHTCount      int64 // 通过 DHT 发现的已连接 Peer 数量
+	PeerFromIncomingCount int64 // 入站连接的 Peer 数量
+
 	Progress          float32           // 种子的下载进度
 	LastActivity      *time.Time        // 最近一次上传或下载的时间
 	Ratio             float32           // 种子的分享比。最大值为 9999
@@ -114,10 +155,154 @@ type Torrent struct {
 	UploadRatio       float32           // 种子的分享比
 	Priority          int32             // 种子的优先级 若队列已禁用或处于做种模式，则返回 -1
 	SeedingTime       time.Duration     // 种子完成后的做种时间（秒）
+	ForceStart        bool              // 是否被强制启动 代理记录
 
 	Status     transmissionrpc.TorrentStatus // 种子状态
 	IsFinished bool                          // 已经完成
 	IsStalled  bool                          // 停滞
+	HasError   bool                          // tr 报告了错误
+
+	Backend string // 种子所在的 tr 后端名称
+	// Stale 后端未连接或请求失败，种子是上次成功获取的数据，速度与 Peer 不再更新
+	Stale bool
+}
+
+// BackendTorrents 一个 tr 后端的种子
+type BackendTorrents struct {
+	Backend string // 后端名称
+	// Stale 后端未连接或请求失败，Torrents 是上次成功获取的种子
+	Stale    bool
+	Torrents []transmissionrpc.Torrent
+}
+
+// TorrentFile 种子中的文件
+type TorrentFile struct {
+	Name           string // 文件名称（包含种子内的相对路径）
+	Length         int64  // 文件大小（字节）
+	BytesCompleted int64  // 已完成的数据量（字节）
+	Wanted         bool   // 是否需要下载
+}
+
+// Category qb 的分类，没有分类时返回空字符串
+func (t *Torrent) Category() string {
+	if !t.Labels.HasValue() {
+		return ""
+	}
+	for _, label := range t.Labels.Value() {
+		if strings.HasPrefix(label, categoryPrefix) {
+			return strings.TrimPrefix(label, categoryPrefix)
+		}
+	}
+	return ""
+}
+
+// qb 4.6 的种子状态
+const (
+	TorrentStateError              = "error"
+	TorrentStateUploading          = "uploading"
+	TorrentStatePausedUP           = "pausedUP"
+	TorrentStateQueuedUP           = "queuedUP"
+	TorrentStateStalledUP          = "stalledUP"
+	TorrentStateCheckingUP         = "checkingUP"
+	TorrentStateForcedUP           = "forcedUP"
+	TorrentStateDownloading        = "downloading"
+	TorrentStatePausedDL           = "pausedDL"
+	TorrentStateQueuedDL           = "queuedDL"
+	TorrentStateStalledDL          = "stalledDL"
+	TorrentStateCheckingDL         = "checkingDL"
+	TorrentStateForcedDL           = "forcedDL"
+	TorrentStateCheckingResumeData = "checkingResumeData"
+	TorrentStateUnknown            = "unknown"
+)
+
+// State 根据 tr 的种子状态生成 qb 的种子状态
+func (t *Torrent) State() string {
+	if t.HasError {
+		return TorrentStateError
+	}
+	completed := t.LeftUntilDone == 0
+	switch t.Status {
+	case transmissionrpc.TorrentStatusStopped:
+		if completed {
+			return TorrentStatePausedUP
+		}
+		return TorrentStatePausedDL
+	case transmissionrpc.TorrentStatusCheckWait:
+		return TorrentStateCheckingResumeData
+	case transmissionrpc.TorrentStatusCheck:
+		if completed {
+			return TorrentStateCheckingUP
+		}
+		return TorrentStateCheckingDL
+	case transmissionrpc.TorrentStatusDownloadWait:
+		return TorrentStateQueuedDL
+	case transmissionrpc.TorrentStatusDownload:
+		if t.ForceStart {
+			return TorrentStateForcedDL
+		}
+		if t.IsStalled || t.DownloadSpeed <= 0 {
+			return TorrentStateStalledDL
+		}
+		return TorrentStateDownloading
+	case transmissionrpc.TorrentStatusSeedWait:
+		return TorrentStateQueuedUP
+	case transmissionrpc.TorrentStatusSeed:
+		if t.ForceStart {
+			return TorrentStateForcedUP
+		}
+		if t.IsStalled || t.UploadSpeed <= 0 {
+			return TorrentStateStalledUP
+		}
+		return TorrentStateUploading
+	}
+	return TorrentStateUnknown
+}
+
+// HasPiece 是否拥有指定片段
+func (t *Torrent) HasPiece(index int) bool {
+	if index < 0 || index/8 >= len(t.Pieces) {
+		return false
+	}
+	return t.Pieces[index/8]&(0x80>>(index%8)) != 0
+}
+
+// PiecesHave 已拥有的片段数量
+func (t *Torrent) PiecesHave() int32 {
+	count := 0
+	for _, b := range t.Pieces {
+		count = count + bits.OnesCount8(b)
+	}
+	return int32(count)
+}
+
+// PeerRelevance 根据 Peer 的进度估算其相关性
+// tr 不提供 Peer 的片段位图，假设 Peer 拥有的片段均匀分布，并用已拥有片段数限制估算范围
+func (t *Torrent) PeerRelevance(peerProgress float32) float32 {
+	if t.PieceCount <= 0 {
+		return 0
+	}
+	have := int64(t.PiecesHave())
+	missing := int64(t.PieceCount) - have
+	if missing <= 0 {
+		return 0
+	}
+	peerHave := int64(math.Round(float64(peerProgress) * float64(t.PieceCount)))
+
+	// Peer 至少拥有 peerHave-have 个我们缺少的片段，最多拥有 min(missing, peerHave) 个
+	lower := float64(max(0, peerHave-have)) / float64(missing)
+	upper := float64(min(missing, peerHave)) / float64(missing)
+	return float32(min(max(float64(peerProgress), lower), upper))
+}
+
+// WantedIncompleteFiles 需要下载但未完成的文件名称
+func (t *Torrent) WantedIncompleteFiles() []string {
+	files := make([]string, 0)
+	for _, file := range t.Files {
+		if file.Wanted && file.BytesCompleted < file.Length {
+			files = append(files, file.Name)
+		}
+	}
+	return files
 }
 
 type TorrentFilter struct {
@@ -136,6 +321,19 @@ type Statistics struct {
 	UploadSpeed            int64 // 本次会话上传的速度（字节/秒）
 }
 
+// TrackerList 添加到种子的 Tracker 列表
+type TrackerList struct {
+	Trackers   []string  // 配置文件与订阅列表中的 Tracker
+	UpdateTime time.Time // 上次成功更新订阅列表的时间
+
+	ConfigTrackers       []string  // 配置文件中的 Tracker
+	SubscriptionTrackers []string  // 订阅列表中的 Tracker，不包含配置文件中已有的
+	SubscriptionURL      string    // 订阅列表URL，没有配置时为空
+	CheckTime            time.Time // 上次请求订阅列表的时间
+	Err                  error     // 上次请求订阅列表的错误
+	MaxSize              int       // Tracker 数量上限
+}
+
 // HistoricalStatistics 历史统计数据（写盘统计）
 type HistoricalStatistics struct {
 	TotalDownloaded int64 // 所有时间下载总量（字节）
@@ -157,8 +355,8 @@ type TorrentRepo interface {
 	// GetTorrent 获取种子
 	GetTorrent(ctx context.Context, hash string) (col.Option[transmissionrpc.Torrent], error)
 
-	// GetTorrentAll 获取所有种子
-	GetTorrentAll(ctx context.Context) (col.Option[[]transmissionrpc.Torrent], error)
+	// GetTorrentAll 获取每个 tr 后端的种子
+	GetTorrentAll(ctx context.Context) ([]BackendTorrents, error)
 
 	// GetPeer 获取Peer
 	GetPeer(ctx context.Context, key PeerKey) (col.Option[*Peer], error)
@@ -166,6 +364,9 @@ type TorrentRepo interface {
 	// SetPeer 设置Peer
 	SetPeer(ctx context.Context, key PeerKey, peer *Peer) error
 
+	// DeactivatePeers 将指定时间之前没有更新的Peer标记为不活跃
+	DeactivatePeers(ctx context.Context, before time.Time) error
+
 	// GetStateRefreshInterval 获取状态更新间隔(秒)
 	GetStateRefreshInterval() int64
 
@@ -175,6 +376,15 @@ type TorrentRepo interface {
 	// SaveHistoricalStatistics 保存历史统计
 	SaveHistoricalStatistics(statistics HistoricalStatistics) error
 
+	// GetBackendStatus 获取每个 tr 后端的状态
+	GetBackendStatus(ctx context.Context) []BackendStatus
+
+	// GetSessionStats 获取每个已连接 tr 后端的会话统计，键为后端名称
+	GetSessionStats(ctx context.Context) (map[string]SessionStats, error)
+
+	// GetFreeSpace 获取指定目录所在磁盘的剩余空间（字节）
+	GetFreeSpace(ctx context.Context, path string) (int64, error)
+
 	// CacheTmpTorrentFile 缓存临时种子文件
 	CacheTmpTorrentFile(ctx context.Context, filename string, data []byte) error
 
@@ -183,69 +393,101 @@ type TorrentRepo interface {
 
 	// ReannounceTrackerServer 重新通告tracker服务器
 	ReannounceTrackerServer(ctx context.Context, ids []int64) (err error)
+
+	// QueueMoveTop 将种子移动到队列顶部
+	QueueMoveTop(ctx context.Context, ids []int64) (err error)
+
+	// QueueMoveUp 将种子在队列中上移
+	QueueMoveUp(ctx context.Context, ids []int64) (err error)
+
+	// QueueMoveDown 将种子在队列中下移
+	QueueMoveDown(ctx context.Context, ids []int64) (err error)
+
+	// QueueMoveBottom 将种子移动到队列底部
+	QueueMoveBottom(ctx context.Context, ids []int64) (err error)
+
+	// StartTorrent 按队列启动种子
+	StartTorrent(ctx context.Context, ids []int64) (err error)
+
+	// StartTorrentNow 忽略队列立即启动种子
+	StartTorrentNow(ctx context.Context, ids []int64) (err error)
+
+	// GetPieceHashes 从种子文件中获取片段哈希，种子文件不存在时返回 ResourceNotExist
+	GetPieceHashes(ctx context.Context, torrentFile string) ([]string, error)
 }
 
 // TorrentUsecase .
 type TorrentUsecase struct {
+	appRepo     AppRepo
 	torrentRepo TorrentRepo
 	banIPRepo   BanIPRepo
+	geoIPRepo   GeoIPRepo
+	trafficRepo TrafficRepo
 	log         *log.Helper
 
+	// state tr 客户端数据快照
+	state atomic.Pointer[clientState]
+	// trackerState Tracker 列表快照
+	trackerState atomic.Pointer[trackerState]
+	// stateMutex 发布快照与修改强制启动状态时使用
+	stateMutex sync.Mutex
+	// forceStartTorrents 被强制启动的种子 key: <Hash>，由 stateMutex 保护
+	forceStartTorrents map[string]struct{}
+
+	// refreshMutex 保证同一时间只有一次客户端数据刷新，保护刷新过程中使用的以下状态
+	refreshMutex sync.Mutex
+	// statistics 累计中的统计数据
 	statistics Statistics
-
-	// torrentLabel 默认添加到的标签
-	torrentLabel col.Option[string]
-	// trackers 所有需要使用的Transfer列表
-	trackers []string
-	// defaultTrackers 配置文件中默认添加的Tracker
-	defaultTrackers []string
-	// subTransferURL 订阅的Transfer列表URL
-	subTransferURL string
-
-	rootURL string
-
-	// torrents key: <Hash>
-	torrents map[string]*Torrent
-
-	// trackerMaxSize 数量上限
-	trackerMaxSize int
+	// lastSessionStats 每个 tr 后端上次获取的会话统计，键为后端名称
+	lastSessionStats map[string]SessionStats
+	// hasIncomingConnections 是否收到过入站连接
+	hasIncomingConnections bool
+	// lastFreeSpaceTime 上次获取剩余磁盘空间的时间
+	lastFreeSpaceTime time.Time
+
+	// config 可以热更新的配置
+	config atomic.Pointer[torrentConfig]
+
+	// queueLock 与更新首选项共用，保护慢速种子的状态与队列数量
+	queueLock *QueueLock
+	// slowTorrentActiveTime 种子速度最近一次超过慢速阈值的时间 key: <Hash>
+	slowTorrentActiveTime map[string]time.Time
+	// slowTorrents 当前被认为是慢速的种子 key: <Hash>
+	slowTorrents map[string]struct{}
+
+	// saveStatisticsMutex 保护 lastSaveStatisticsErr
+	saveStatisticsMutex sync.Mutex
+	// lastSaveStatisticsErr 上次保存统计数据的错误
+	lastSaveStatisticsErr error
+
+	// trafficRetention 流量统计的保留时长，0 为永久保留
+	trafficRetention map[TrafficResolution]time.Duration
 }
 
 // NewTorrentUsecase .
 func NewTorrentUsecase(
 	bootstrap *conf.Bootstrap,
+	appRepo AppRepo,
 	banIPRepo BanIPRepo,
+	geoIPRepo GeoIPRepo,
 	torrentRepo TorrentRepo,
+	trafficRepo TrafficRepo,
+	queueLock *QueueLock,
 	logger log.Logger,
 ) *TorrentUsecase {
-	// 初始化Transfer列表
-	config := bootstrap.GetInfra().GetTr()
-	subTransferURL := config.GetSubTransfer()
-	defaultTrackers := strings.Split(config.GetTransfer(), "\n")
-	trackers := make(map[string]struct{}, len(defaultTrackers))
-	for _, tracker := range defaultTrackers {
-		// 检查url
-		urlStr := strings.TrimSpace(tracker)
-		if urlStr != "" {
-			trackerURL, err := url.ParseRequestURI(urlStr)
-			if err == nil {
-				trackers[trackerURL.String()] = struct{}{}
-			}
-		}
-	}
-	defaultTrackers = make([]string, 0, len(defaultTrackers))
-	for urlStr := range trackers {
-		defaultTrackers = append(defaultTrackers, urlStr)
-	}
-
+	// 无法读取历史统计数据时从零开始统计，不影响代理的其他功能
 	statistics, err := torrentRepo.GetHistoricalStatistics()
 	if err != nil {
-		panic(err)
+		log.NewHelper(logger).Errorf("获取历史统计数据失败: %v", err)
 	}
 
 	uc := &TorrentUsecase{
+		appRepo:     appRepo,
 		torrentRepo: torrentRepo,
 		banIPRepo:   banIPRepo,
+		geoIPRepo:   geoIPRepo,
+		trafficRepo: trafficRepo,
+		queueLock:   queueLock,
 		log:         log.NewHelper(logger),
 
 		statistics: Statistics{
@@ -256,80 +498,135 @@ func NewTorrentUsecase(
 			TotalUploadedSession:   0,
 			UploadSpeed:            0,
 		},
-		torrentLabel:    col.None[string](),
-		defaultTrackers: defaultTrackers,
-		subTransferURL:  subTransferURL,
-		rootURL:         bootstrap.GetTrigger().GetHttp().GetRootRul(),
+		lastSessionStats: make(map[string]SessionStats),
+
+		slowTorrentActiveTime: make(map[string]time.Time, 128),
+		slowTorrents:          make(map[string]struct{}, 16),
+		forceStartTorrents:    make(map[string]struct{}, 16),
 
-		torrents: make(map[string]*Torrent, 128),
+		trafficRetention: make(map[TrafficResolution]time.Duration, len(TrafficResolutions)),
 
-		trackerMaxSize: int(config.GetTrackerMaxSize()),
+		lastSaveStatisticsErr: err,
 	}
 
-	torrentLabel := bootstrap.GetInfra().GetTr().GetAddTorrentLabel()
-	if torrentLabel != "" {
-		uc.torrentLabel = col.Some(torrentLabel)
+	uc.state.Store(&clientState{
+		torrents:   make(map[string]*Torrent),
+		statistics: uc.statistics,
+		serverState: ServerState{
+			ConnectionStatus: ConnectionStatusDisconnected,
+		},
+	})
+	uc.trackerState.Store(&trackerState{
+		trackers: make([]string, 0),
+	})
+
+	trafficConfig := bootstrap.GetInfra().GetTraffic()
+	retentions := map[TrafficResolution]*durationpb.Duration{
+		TrafficResolutionHour:  trafficConfig.GetHourRetention(),
+		TrafficResolutionDay:   trafficConfig.GetDayRetention(),
+		TrafficResolutionMonth: trafficConfig.GetMonthRetention(),
+	}
+	for resolution, retention := range retentions {
+		uc.trafficRetention[resolution] = defaultTrafficRetention[resolution]
+		if retention != nil {
+			uc.trafficRetention[resolution] = retention.AsDuration()
+		}
 	}
 
+	// 初始化Transfer列表
+	uc.config.Store(newTorrentConfig(bootstrap, torrentRepo.GetStateRefreshInterval()))
+
 	return uc
 }
 
 // UpTrackerList 更新Tracker列表
 func (uc *TorrentUsecase) UpTrackerList(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "TorrentUsecase.UpTrackerList")
+	defer span.End()
+
 	// 完整的更新一次tracker列表
 	i := 0
+	config := uc.loadConfig()
 
-	trackers := make(map[string]struct{}, len(uc.trackers))
-	for _, tracker := range uc.defaultTrackers {
+	trackers := make(map[string]struct{}, len(uc.loadTrackers()))
+	for _, tracker := range config.defaultTrackers {
 		trackers[tracker] = struct{}{}
 		i = i + 1
 	}
 
-	lines, err := uc.torrentRepo.GetResponseLine(ctx, uc.subTransferURL)
-	if err != nil {
-		return
+	// 没有配置订阅列表时只使用配置文件中的 Tracker，请求空的 URL 总是失败
+	lines := make([]string, 0)
+	checkTime := time.Now()
+	if config.subTransferURL != "" {
+		lines, err = uc.torrentRepo.GetResponseLine(ctx, config.subTransferURL)
+		if err != nil {
+			// 保留上次的 Tracker 列表，只记录错误
+			state := *uc.trackerState.Load()
+			state.checkTime = checkTime
+			state.err = err
+			uc.trackerState.Store(&state)
+			return
+		}
 	}
 
+	subscription := make([]string, 0)
 	for _, line := range lines {
 		// 检查url
 		urlStr := strings.TrimSpace(line)
 		if urlStr != "" {
 			trackerURL, err := url.ParseRequestURI(urlStr)
 			if err == nil {
+				if _, exist := trackers[trackerURL.String()]; !exist {
+					subscription = append(subscription, trackerURL.String())
+				}
 				trackers[trackerURL.String()] = struct{}{}
 				i = i + 1
 			}
 		}
-		if i >= uc.trackerMaxSize {
+		if i >= config.trackerMaxSize {
 			break
 		}
 	}
 
 	// 缓存下来，当添加种子时使用
-	uc.trackers = make([]string, 0, len(trackers))
+	state := &trackerState{
+		trackers:     make([]string, 0, len(trackers)),
+		updateTime:   time.Now(),
+		subscription: subscription,
+		checkTime:    checkTime,
+	}
 	for tracker := range trackers {
-		uc.trackers = append(uc.trackers, tracker)
+		state.trackers = append(state.trackers, tracker)
 	}
+	uc.trackerState.Store(state)
 	return
 }
 
 // UpTorrentALLTrackerList 更新所有种子的Tracker
 func (uc *TorrentUsecase) UpTorrentALLTrackerList(ctx context.Context) (err error) {
-	torrentsOption, err := uc.torrentRepo.GetTorrentAll(ctx)
+	ctx, span := tracer.Start(ctx, "TorrentUsecase.UpTorrentALLTrackerList")
+	defer span.End()
+
+	backendTorrents, err := uc.torrentRepo.GetTorrentAll(ctx)
 	if err != nil {
 		return
 	}
-	if !torrentsOption.HasValue() {
-		return
-	}
-	torrents := torrentsOption.Value()
 
-	ids := make([]int64, 0, len(torrents))
-	for _, trt := range torrents {
-		ids = append(ids, *trt.ID)
+	// 未连接的后端无法更新
+	ids := make([]int64, 0)
+	for _, backend := range backendTorrents {
+		if backend.Stale {
+			continue
+		}
+		for _, trt := range backend.Torrents {
+			ids = append(ids, *trt.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
 	}
 
-	err = uc.torrentRepo.UpTracker(ctx, ids, uc.trackers)
+	err = uc.torrentRepo.UpTracker(ctx, ids, uc.loadTrackers())
 	if err != nil {
 		return
 	}
@@ -337,9 +634,13 @@ func (uc *TorrentUsecase) UpTorrentALLTrackerList(ctx context.Context) (err erro
 	return
 }
 
-// Add 添加种子
-func (uc *TorrentUsecase) Add(ctx context.Context, torrents []*DownloadTorrent) (err error) {
-	if uc.torrentLabel.HasValue() {
+// Add 添加种子，返回成功添加的种子数量
+func (uc *TorrentUsecase) Add(ctx context.Context, torrents []*DownloadTorrent) (added int, err error) {
+	ctx, span := tracer.Start(ctx, "TorrentUsecase.Add")
+	defer span.End()
+
+	torrentLabel := uc.loadConfig().torrentLabel
+	if torrentLabel.HasValue() {
 		for _, torrent := range torrents {
 			var labels []string
 			if torrent.Labels.HasValue() {
@@ -351,7 +652,7 @@ func (uc *TorrentUsecase) Add(ctx context.Context, torrents []*DownloadTorrent)
 				// 模拟 qb 分类
 				labels = append(labels, fmt.Sprintf("%s%s", categoryPrefix, torrent.Category.Value()))
 			}
-			labels = append(labels, uc.torrentLabel.Value())
+			labels = append(labels, torrentLabel.Value())
 			torrent.Labels = col.Some(labels)
 		}
 	}
@@ -359,9 +660,10 @@ func (uc *TorrentUsecase) Add(ctx context.Context, torrents []*DownloadTorrent)
 	if err != nil {
 		return
 	}
+	added = len(ids)
 	// 添加tracker
 	if len(ids) > 0 {
-		err := uc.torrentRepo.UpTracker(ctx, ids, uc.trackers)
+		err := uc.torrentRepo.UpTracker(ctx, ids, uc.loadTrackers())
 		if err != nil {
 			uc.log.Errorf("更新种子Tracker时出现错误 err=%v", err)
 		}
@@ -376,13 +678,16 @@ func (uc *TorrentUsecase) Add(ctx context.Context, torrents []*DownloadTorrent)
 }
 
 // GetTorrentList 获取种子列表
-func (uc *TorrentUsecase) GetTorrentList(_ context.Context, filter TorrentFilter) (
+func (uc *TorrentUsecase) GetTorrentList(ctx context.Context, filter TorrentFilter) (
 	res col.Option[[]*pb.TorrentInfo], err error) {
+	_, span := tracer.Start(ctx, "TorrentUsecase.GetTorrentList")
+	defer span.End()
 
 	res = col.None[[]*pb.TorrentInfo]()
 
-	torrents := make([]*Torrent, 0, len(uc.torrents))
-	for _, torrent := range uc.torrents {
+	state := uc.loadState()
+	torrents := make([]*Torrent, 0, len(state.torrents))
+	for _, torrent := range state.torrents {
 		torrents = append(torrents, torrent)
 	}
 
@@ -399,18 +704,20 @@ func (uc *TorrentUsecase) GetTorrentList(_ context.Context, filter TorrentFilter
 }
 
 // GetTorrentProperties 获取种子属性
-func (uc *TorrentUsecase) GetTorrentProperties(_ context.Context, hash string) (
+func (uc *TorrentUsecase) GetTorrentProperties(ctx context.Context, hash string) (
 	res col.Option[*pb.GetPropertiesResponse], err error) {
+	_, span := tracer.Start(ctx, "TorrentUsecase.GetTorrentProperties")
+	defer span.End()
 
 	res = col.None[*pb.GetPropertiesResponse]()
 
-	torrent, ok := uc.torrents[hash]
+	torrent, ok := uc.loadState().torrents[hash]
 	if !ok {
 		return
 	}
 
 	qbt := &pb.GetPropertiesResponse{
-		SavePath:               torrent.TorrentPath,            // 种子数据存储的路径
+		SavePath:               torrent.Path,                   // 种子数据存储的路径
 		CreationDate:           torrent.CreationDate.Unix(),    // 种子创建日期（Unix 时间戳）
 		AdditionDate:           torrent.AddedDate.Unix(),       // 添加此 torrent 的时间（Unix 时间戳）
 		Comment:                torrent.Comment,                // 种子评论
@@ -436,8 +743,8 @@ func (uc *TorrentUsecase) GetTorrentProperties(_ context.Context, hash string) (
 		NbConnectionsLimit: torrent.MaxPeerCount,  // 种子连接数限制
 		Peers:              torrent.PeerCount,     // 连接到的对等点数量
 		PeersTotal:         torrent.PeerCount,     // 群体中的同伴数量
-		PiecesHave:         torrent.FileCount,     // 拥有件数 TR:noFunc
-		PiecesNum:          torrent.FileCount,     // 种子文件的数量
+		PiecesHave:         torrent.PiecesHave(),  // 拥有件数
+		PiecesNum:          torrent.PieceCount,    // 种子片段的数量
 		Reannounce:         300,                   // 距离下一次广播的秒数 TR:noFunc
 		Seeds:              torrent.PeerSendCount, // 连接到的种子数量
 		SeedsTotal:         torrent.PeerCount,     // 群体中的种子数量 TR:noFunc
@@ -473,10 +780,69 @@ func (uc *TorrentUsecase) GetTorrentProperties(_ context.Context, hash string) (
 	return
 }
 
+// GetWebSeeds 获取种子 Web 种子
+func (uc *TorrentUsecase) GetWebSeeds(_ context.Context, hash string) (res col.Option[[]string], err error) {
+	res = col.None[[]string]()
+	torrent, ok := uc.loadState().torrents[hash]
+	if !ok {
+		return
+	}
+	webSeeds := make([]string, 0, len(torrent.WebSeeds))
+	webSeeds = append(webSeeds, torrent.WebSeeds...)
+	res = col.Some(webSeeds)
+	return
+}
+
+// GetPieceStates 获取种子片段状态
+// tr 不提供正在下载的片段，只返回未下载与已下载状态
+func (uc *TorrentUsecase) GetPieceStates(_ context.Context, hash string) (res col.Option[[]PieceState], err error) {
+	res = col.None[[]PieceState]()
+	torrent, ok := uc.loadState().torrents[hash]
+	if !ok {
+		return
+	}
+	states := make([]PieceState, torrent.PieceCount)
+	for i := range states {
+		if torrent.HasPiece(i) {
+			states[i] = PieceStateDownloaded
+		} else {
+			states[i] = PieceStateNotDownloaded
+		}
+	}
+	res = col.Some(states)
+	return
+}
+
+// GetPieceHashes 获取种子片段哈希值
+func (uc *TorrentUsecase) GetPieceHashes(ctx context.Context, hash string) (res col.Option[[]string], err error) {
+	ctx, span := tracer.Start(ctx, "TorrentUsecase.GetPieceHashes")
+	defer span.End()
+
+	res = col.None[[]string]()
+	torrent, ok := uc.loadState().torrents[hash]
+	if !ok {
+		return
+	}
+	hashes, err := uc.torrentRepo.GetPieceHashes(ctx, torrent.TorrentPath)
+	if err != nil {
+		return
+	}
+	res = col.Some(hashes)
+	return
+}
+
+// CanResolvePeerCountries 是否可以解析 Peer 所属国家
+func (uc *TorrentUsecase) CanResolvePeerCountries(ctx context.Context) bool {
+	return uc.geoIPRepo.IsEnabled(ctx)
+}
+
 // GetPeers 获取种子 peer 数据
 func (uc *TorrentUsecase) GetPeers(ctx context.Context, hash string) (res col.Option[map[PeerKey]*Peer], err error) {
+	ctx, span := tracer.Start(ctx, "TorrentUsecase.GetPeers")
+	defer span.End()
+
 	res = col.None[map[PeerKey]*Peer]()
-	torrent, ok := uc.torrents[hash]
+	torrent, ok := uc.loadState().torrents[hash]
 	if !ok {
 		return
 	}
@@ -536,7 +902,16 @@ func (uc *TorrentUsecase) GetPeers(ctx context.Context, hash string) (res col.Op
 		if !peer.IsActive {
 			continue
 		}
-		peers[key] = peer
+
+		// 相关性与文件依赖当前种子状态，不写回存储
+		peerInfo := *peer
+		peerInfo.Relevance = torrent.PeerRelevance(peer.Progress)
+		peerInfo.Files = make([]string, 0)
+		// Peer 是完整的种子或正在从 Peer 下载时，可以从该 Peer 获取所有未完成的文件
+		if peer.Progress >= 1 || strings.ContainsRune(peer.Flags, 'D') {
+			peerInfo.Files = torrent.WantedIncompleteFiles()
+		}
+		peers[key] = &peerInfo
 	}
 	res = col.Some(peers)
 	return
@@ -544,113 +919,510 @@ func (uc *TorrentUsecase) GetPeers(ctx context.Context, hash string) (res col.Op
 
 // UpClientData 更新tr客户端数据
 func (uc *TorrentUsecase) UpClientData(ctx context.Context) (err error) {
-	torrentsOption, err := uc.torrentRepo.GetTorrentAll(ctx)
+	ctx, span := tracer.Start(ctx, "TorrentUsecase.UpClientData")
+	defer span.End()
+
+	uc.refreshMutex.Lock()
+	defer uc.refreshMutex.Unlock()
+
+	// 无法访问 tr 时保留上次的数据，连接状态改为未连接
+	err = uc.upSessionStats(ctx)
 	if err != nil {
+		uc.setDisconnected()
 		return
 	}
-	if !torrentsOption.HasValue() {
+
+	backendTorrents, err := uc.torrentRepo.GetTorrentAll(ctx)
+	if err != nil {
+		uc.setDisconnected()
 		return
 	}
-	trTorrents := torrentsOption.Value()
 
-	totalDownloadedIncrement := int64(0) // 本次数据刷新下载的总数据（字节）
-	totalUploadedIncrement := int64(0)   // 本次数据刷新上传的总数据量（字节）
+	previousState := uc.loadState()
+	nowTime := time.Now()
+	refreshInterval := time.Duration(uc.loadConfig().stateRefreshInterval) * time.Second
+	// 上次刷新后经过的实际时间
+	elapsed := refreshInterval
+	if !previousState.updateTime.IsZero() {
+		elapsed = nowTime.Sub(previousState.updateTime)
+	}
+
+	tmpTorrents := make(map[string]*Torrent)
+	for _, backend := range backendTorrents {
+		for _, trt := range backend.Torrents {
+			// 同一个种子存在于多个后端时使用靠前的后端中的种子
+			if _, exist := tmpTorrents[*trt.HashString]; exist {
+				continue
+			}
+			torrent := trTorrentToTorrent(trt)
+			torrent.Backend = backend.Backend
+			torrent.Stale = backend.Stale
+			tmpTorrents[torrent.Hash] = torrent
+
+			// 未连接的后端的 Peer 速度是旧的，不能累加流量，存储中的 Peer 随后被标记为不活跃
+			if backend.Stale {
+				torrent.Peers = make(map[PeerKey]struct{})
+				continue
+			}
+			err = uc.upPeers(ctx, torrent, trt, nowTime, elapsed, refreshInterval)
+			if err != nil {
+				return
+			}
+		}
+	}
 
-	downloadSpeed := int64(0)
-	uploadSpeed := int64(0)
+	// 本次没有出现的 Peer 已经断开连接
+	err = uc.torrentRepo.DeactivatePeers(ctx, nowTime)
+	if err != nil {
+		return
+	}
 
-	tmpTorrents := make(map[string]*Torrent, len(torrentsOption.Value()))
-	for _, trt := range trTorrents {
-		torrent := trTorrentToTorrent(trt)
-		torrent.Peers = make(map[PeerKey]struct{}, len(trt.Peers))
+	// 更新服务器状态
+	serverState := uc.upServerState(ctx, nowTime, previousState.serverState, tmpTorrents)
 
-		for _, trPeer := range trt.Peers {
-			key := PeerKey{*trt.HashString, trPeer.Address, int32(trPeer.Port)}
-			peerInfoOption, err := uc.torrentRepo.GetPeer(ctx, key)
-			if err != nil {
-				return err
+	// 记录流量时间序列
+	err = uc.recordTraffic(ctx, nowTime, previousState.torrents, tmpTorrents)
+	if err != nil {
+		uc.log.Warnf("记录流量统计失败: %v", err)
+		err = nil
+	}
+
+	// 发布新的快照
+	uc.updateState(func(state *clientState) {
+		// 种子停止后强制启动失效
+		forceStartTorrents := make(map[string]struct{}, len(uc.forceStartTorrents))
+		for hash := range uc.forceStartTorrents {
+			torrent, ok := tmpTorrents[hash]
+			if ok && torrent.Status != transmissionrpc.TorrentStatusStopped {
+				forceStartTorrents[hash] = struct{}{}
+				torrent.ForceStart = true
 			}
+		}
+		uc.forceStartTorrents = forceStartTorrents
 
-			intervalDownloaded := uc.torrentRepo.GetStateRefreshInterval() * trPeer.RateToClient
-			intervalUploaded := uc.torrentRepo.GetStateRefreshInterval() * trPeer.RateToPeer
-			totalDownloadedIncrement = totalDownloadedIncrement + intervalDownloaded
-			totalUploadedIncrement = totalUploadedIncrement + intervalUploaded
-			downloadSpeed = downloadSpeed + trPeer.RateToClient
-			uploadSpeed = uploadSpeed + trPeer.RateToPeer
+		state.torrents = tmpTorrents
+		state.statistics = uc.statistics
+		state.serverState = serverState
+		state.updateTime = nowTime
+	})
+	return
+}
+
+// upPeers 更新种子的 Peer，按两次采样之间的速度累加 Peer 的流量
+// elapsed 为上次刷新后经过的实际时间
+func (uc *TorrentUsecase) upPeers(ctx context.Context, torrent *Torrent, trt transmissionrpc.Torrent,
+	nowTime time.Time, elapsed time.Duration, refreshInterval time.Duration) error {
+
+	torrent.Peers = make(map[PeerKey]struct{}, len(trt.Peers))
+	for _, trPeer := range trt.Peers {
+		key := PeerKey{*trt.HashString, trPeer.Address, int32(trPeer.Port)}
+		peerInfoOption, err := uc.torrentRepo.GetPeer(ctx, key)
+		if err != nil {
+			return err
+		}
 
-			var peerInfo *Peer
+		// 存储中的 Peer 可能正在被读取，修改副本后再写回
+		var peerInfo *Peer
+		newPeer := false
+		if peerInfoOption.HasValue() && peerInfoOption.Value().IsActive {
+			peer := *peerInfoOption.Value()
+			peerInfo = &peer
+		} else {
+			connection := "BT"
+			if trPeer.IsUTP {
+				connection = "μTP"
+			}
+			peerInfo = &Peer{
+				IP:            trPeer.Address,
+				Port:          uint16(trPeer.Port),
+				Connection:    connection,
+				PeerIdClient:  fingerprintClientName(trPeer.ClientName),
+				ClientName:    trPeer.ClientName,
+				Progress:      0,
+				DownloadSpeed: 0, // B/s
+				Downloaded:    0,
+				UploadSpeed:   0, // B/s
+				Uploaded:      0,
+				Flags:         "",
+				IsActive:      true,
+				LastSeen:      nowTime.Add(-min(elapsed, refreshInterval)),
+			}
+			// 无法得知 Peer 在第一次采样前传输的数据量
+			newPeer = true
 			if peerInfoOption.HasValue() {
-				peerInfo = peerInfoOption.Value()
-			} else {
-				connection := "BT"
-				if trPeer.IsUTP {
-					connection = "μTP"
-				}
-				peerInfo = &Peer{
-					IP:            trPeer.Address,
-					Port:          uint16(trPeer.Port),
-					Connection:    connection,
-					PeerIdClient:  trPeer.ClientName,
-					ClientName:    trPeer.ClientName,
-					Progress:      0,
-					DownloadSpeed: 0, // B/s
-					Downloaded:    0,
-					UploadSpeed:   0, // B/s
-					Uploaded:      0,
-					Flags:         "",
-					IsActive:      true,
-				}
+				// 重新连接的 Peer 延续之前的统计量
+				peerInfo.Downloaded = peerInfoOption.Value().Downloaded
+				peerInfo.Uploaded = peerInfoOption.Value().Uploaded
 			}
-			peerInfo.Progress = float32(trPeer.Progress)
-			peerInfo.DownloadSpeed = trPeer.RateToClient
-			peerInfo.UploadSpeed = trPeer.RateToPeer
-			peerInfo.Downloaded = peerInfo.Downloaded + intervalDownloaded
-			peerInfo.Uploaded = peerInfo.Uploaded + intervalUploaded
-			peerInfo.Flags = trPeer.FlagStr
-
-			err = uc.torrentRepo.SetPeer(ctx, key, peerInfo)
+			countryOption, err := uc.geoIPRepo.LookupCountry(ctx, trPeer.Address)
 			if err != nil {
-				return err
+				uc.log.Warnf("查询 Peer %s 所属国家失败: %v", trPeer.Address, err)
+			}
+			if countryOption.HasValue() {
+				peerInfo.Country = countryOption.Value().Name
+				peerInfo.CountryCode = countryOption.Value().Code
 			}
-			torrent.Peers[key] = struct{}{}
 		}
-		tmpTorrents[torrent.Hash] = torrent
+
+		// 按实际经过的时间对两次采样的速度做梯形积分
+		peerElapsed := nowTime.Sub(peerInfo.LastSeen)
+		peerInfo.Estimated = newPeer || peerElapsed > refreshInterval*peerMissedPolls
+		intervalDownloaded := integrateRate(peerInfo.DownloadSpeed, trPeer.RateToClient, peerElapsed)
+		intervalUploaded := integrateRate(peerInfo.UploadSpeed, trPeer.RateToPeer, peerElapsed)
+
+		peerInfo.Progress = float32(trPeer.Progress)
+		peerInfo.DownloadSpeed = trPeer.RateToClient
+		peerInfo.UploadSpeed = trPeer.RateToPeer
+		peerInfo.Downloaded = peerInfo.Downloaded + intervalDownloaded
+		peerInfo.Uploaded = peerInfo.Uploaded + intervalUploaded
+		peerInfo.Flags = trPeer.FlagStr
+		peerInfo.IsActive = true
+		peerInfo.LastSeen = nowTime
+
+		err = uc.torrentRepo.SetPeer(ctx, key, peerInfo)
+		if err != nil {
+			return err
+		}
+		torrent.Peers[key] = struct{}{}
+	}
+	return nil
+}
+
+// integrateRate 对两次速度采样（字节/秒）在经过的时间内积分，得到传输的数据量（字节）
+func integrateRate(previousRate int64, currentRate int64, elapsed time.Duration) int64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return int64(float64(previousRate+currentRate) / 2 * elapsed.Seconds())
+}
+
+// IncreasePriority 提高种子队列优先级
+func (uc *TorrentUsecase) IncreasePriority(ctx context.Context, hashes []string) (err error) {
+	ctx, span := tracer.Start(ctx, "TorrentUsecase.IncreasePriority")
+	defer span.End()
+
+	ids := uc.hashesToIDs(hashes)
+	if len(ids) == 0 {
+		return
+	}
+	err = uc.torrentRepo.QueueMoveUp(ctx, ids)
+	return
+}
+
+// DecreasePriority 降低种子队列优先级
+func (uc *TorrentUsecase) DecreasePriority(ctx context.Context, hashes []string) (err error) {
+	ctx, span := tracer.Start(ctx, "TorrentUsecase.DecreasePriority")
+	defer span.End()
+
+	ids := uc.hashesToIDs(hashes)
+	if len(ids) == 0 {
+		return
+	}
+	err = uc.torrentRepo.QueueMoveDown(ctx, ids)
+	return
+}
+
+// TopPriority 种子队列优先级设为最高
+func (uc *TorrentUsecase) TopPriority(ctx context.Context, hashes []string) (err error) {
+	ctx, span := tracer.Start(ctx, "TorrentUsecase.TopPriority")
+	defer span.End()
+
+	ids := uc.hashesToIDs(hashes)
+	if len(ids) == 0 {
+		return
+	}
+	err = uc.torrentRepo.QueueMoveTop(ctx, ids)
+	return
+}
+
+// BottomPriority 种子队列优先级设为最低
+func (uc *TorrentUsecase) BottomPriority(ctx context.Context, hashes []string) (err error) {
+	ctx, span := tracer.Start(ctx, "TorrentUsecase.BottomPriority")
+	defer span.End()
+
+	ids := uc.hashesToIDs(hashes)
+	if len(ids) == 0 {
+		return
 	}
+	err = uc.torrentRepo.QueueMoveBottom(ctx, ids)
+	return
+}
 
-	// 更新统计量
-	uc.statistics.TotalDownloadedSession = uc.statistics.TotalDownloadedSession + totalDownloadedIncrement
-	uc.statistics.TotalUploadedSession = uc.statistics.TotalUploadedSession + totalUploadedIncrement
-	uc.statistics.DownloadSpeed = downloadSpeed
-	uc.statistics.UploadSpeed = uploadSpeed
+// SetForceStart 设置强制启动
+// tr 使用 torrent-start-now 忽略队列启动种子，由代理记录强制启动状态
+func (uc *TorrentUsecase) SetForceStart(ctx context.Context, hashes []string, value bool) (err error) {
+	ctx, span := tracer.Start(ctx, "TorrentUsecase.SetForceStart")
+	defer span.End()
 
-	// 更新种子表
-	uc.torrents = tmpTorrents
+	ids := uc.hashesToIDs(hashes)
+	if len(ids) == 0 {
+		return
+	}
+	if value {
+		err = uc.torrentRepo.StartTorrentNow(ctx, ids)
+	} else {
+		err = uc.torrentRepo.StartTorrent(ctx, ids)
+	}
+	if err != nil {
+		return
+	}
 
+	idSet := make(map[int64]struct{}, len(ids))
+	for _, id := range ids {
+		idSet[id] = struct{}{}
+	}
+	uc.updateState(func(state *clientState) {
+		torrents := make(map[string]*Torrent, len(state.torrents))
+		for hash, torrent := range state.torrents {
+			if _, ok := idSet[torrent.ID]; ok {
+				if value {
+					uc.forceStartTorrents[hash] = struct{}{}
+				} else {
+					delete(uc.forceStartTorrents, hash)
+				}
+				// 快照中的种子不能修改，使用副本
+				forceStartTorrent := *torrent
+				forceStartTorrent.ForceStart = value
+				torrent = &forceStartTorrent
+			}
+			torrents[hash] = torrent
+		}
+		state.torrents = torrents
+	})
 	return
 }
 
+// hashesToIDs 将种子哈希转换为 tr 种子ID, `all` 表示所有种子
+func (uc *TorrentUsecase) hashesToIDs(hashes []string) []int64 {
+	torrents := uc.loadState().torrents
+	ids := make([]int64, 0, len(hashes))
+	if len(hashes) == 1 && hashes[0] == "all" {
+		for _, torrent := range torrents {
+			ids = append(ids, torrent.ID)
+		}
+		return ids
+	}
+	for _, hash := range hashes {
+		torrent, ok := torrents[strings.ToLower(hash)]
+		if !ok {
+			continue
+		}
+		ids = append(ids, torrent.ID)
+	}
+	return ids
+}
+
+// UpSlowTorrentQueue 模拟 qb 的慢速种子不计入队列限制
+// tr 没有对应功能，通过扩大队列数量并将慢速种子移动到队列底部实现
+func (uc *TorrentUsecase) UpSlowTorrentQueue(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "TorrentUsecase.UpSlowTorrentQueue")
+	defer span.End()
+
+	uc.queueLock.Lock()
+	defer uc.queueLock.Unlock()
+
+	proxyPre, err := uc.appRepo.GetProxyPreferences(ctx)
+	if err != nil {
+		return
+	}
+
+	torrents := uc.loadState().torrents
+	nowTime := time.Now()
+	dlThreshold := int64(proxyPre.SlowTorrentDlRateThreshold) * 1024
+	ulThreshold := int64(proxyPre.SlowTorrentUlRateThreshold) * 1024
+	inactiveTimer := time.Duration(proxyPre.SlowTorrentInactiveTimer) * time.Second
+
+	slowSlots := make(map[string]QueueSlots)
+	newSlowIDs := make([]int64, 0)
+	activeTime := make(map[string]time.Time, len(torrents))
+	slowTorrents := make(map[string]struct{}, len(uc.slowTorrents))
+	for hash, torrent := range torrents {
+		if torrent.Status != transmissionrpc.TorrentStatusDownload &&
+			torrent.Status != transmissionrpc.TorrentStatusSeed {
+			continue
+		}
+
+		// 后端未连接时速度不再更新，保留上次的状态，不计入队列数量
+		if torrent.Stale {
+			if lastActive, ok := uc.slowTorrentActiveTime[hash]; ok {
+				activeTime[hash] = lastActive
+			}
+			if _, exist := uc.slowTorrents[hash]; exist {
+				slowTorrents[hash] = struct{}{}
+			}
+			continue
+		}
+
+		// 上传或下载任意一项超过阈值即不是慢速种子
+		lastActive, ok := uc.slowTorrentActiveTime[hash]
+		if !ok || torrent.DownloadSpeed >= dlThreshold || torrent.UploadSpeed >= ulThreshold {
+			lastActive = nowTime
+		}
+		activeTime[hash] = lastActive
+		if !proxyPre.DontCountSlowTorrents || nowTime.Sub(lastActive) < inactiveTimer {
+			continue
+		}
+
+		slowTorrents[hash] = struct{}{}
+		if _, exist := uc.slowTorrents[hash]; !exist {
+			newSlowIDs = append(newSlowIDs, torrent.ID)
+		}
+		slots := slowSlots[torrent.Backend]
+		if torrent.Status == transmissionrpc.TorrentStatusDownload {
+			slots.Download = slots.Download + 1
+		} else {
+			slots.Seed = slots.Seed + 1
+		}
+		slowSlots[torrent.Backend] = slots
+	}
+	uc.slowTorrentActiveTime = activeTime
+	uc.slowTorrents = slowTorrents
+
+	// 新的慢速种子移动到队列底部，恢复速度后优先让出队列位置
+	if len(newSlowIDs) > 0 {
+		uc.log.Debugf("慢速种子移动到队列底部 ids=%v", newSlowIDs)
+		err = uc.torrentRepo.QueueMoveBottom(ctx, newSlowIDs)
+		if err != nil {
+			return
+		}
+	}
+
+	if maps.Equal(slowSlots, proxyPre.SlowSlots) {
+		return
+	}
+
+	// 慢速种子不占用队列数量，每个后端只增减该后端的慢速种子数量
+	// 未连接的后端保留原来的数量，重新连接后再调整
+	backendPres, err := uc.appRepo.GetBackendPreferences(ctx)
+	if err != nil {
+		return
+	}
+	proxyPre.SlowSlots = maps.Clone(proxyPre.SlowSlots)
+	if proxyPre.SlowSlots == nil {
+		proxyPre.SlowSlots = make(map[string]QueueSlots, len(slowSlots))
+	}
+	for _, backendPre := range backendPres {
+		oldSlots := proxyPre.SlowSlots[backendPre.Backend]
+		newSlots := slowSlots[backendPre.Backend]
+		if oldSlots == newSlots {
+			continue
+		}
+
+		pre := backendPre.Preferences
+		trd := transmissionrpc.SessionArguments{}
+		if pre.DownloadQueueSize != nil {
+			size := max(*pre.DownloadQueueSize-oldSlots.Download+newSlots.Download, 0)
+			trd.DownloadQueueSize = &size
+		}
+		if pre.SeedQueueSize != nil {
+			size := max(*pre.SeedQueueSize-oldSlots.Seed+newSlots.Seed, 0)
+			trd.SeedQueueSize = &size
+		}
+		setErr := uc.appRepo.SetBackendPreferences(ctx, backendPre.Backend, trd)
+		if setErr != nil {
+			uc.log.Warnf("更新 tr 后端 %s 的队列数量失败: %v", backendPre.Backend, setErr)
+			continue
+		}
+
+		// 每个后端设置成功后立即保存，其他后端失败时不会重复增加
+		if newSlots == (QueueSlots{}) {
+			delete(proxyPre.SlowSlots, backendPre.Backend)
+		} else {
+			proxyPre.SlowSlots[backendPre.Backend] = newSlots
+		}
+		err = uc.appRepo.SaveProxyPreferences(ctx, proxyPre)
+		if err != nil {
+			return
+		}
+	}
+	return nil
+}
+
 // GetStateRefreshInterval 获取状态更新间隔
 func (uc *TorrentUsecase) GetStateRefreshInterval() int64 {
-	return uc.torrentRepo.GetStateRefreshInterval()
+	return uc.loadConfig().stateRefreshInterval
+}
+
+// GetTorrents 获取所有种子
+func (uc *TorrentUsecase) GetTorrents() []*Torrent {
+	state := uc.loadState()
+	torrents := make([]*Torrent, 0, len(state.torrents))
+	for _, torrent := range state.torrents {
+		torrents = append(torrents, torrent)
+	}
+	return torrents
+}
+
+// HasTorrent 种子是否存在
+func (uc *TorrentUsecase) HasTorrent(hash string) bool {
+	_, ok := uc.loadState().torrents[hash]
+	return ok
 }
 
 // GetStatistics 获取统计数据
 func (uc *TorrentUsecase) GetStatistics() Statistics {
-	return uc.statistics
+	return uc.loadState().statistics
+}
+
+// ResetStatistics 清零累计的上传下载总量并保存
+func (uc *TorrentUsecase) ResetStatistics() error {
+	uc.refreshMutex.Lock()
+	uc.statistics.TotalDownloaded = 0
+	uc.statistics.TotalUploaded = 0
+	uc.statistics.TotalDownloadedSession = 0
+	uc.statistics.TotalUploadedSession = 0
+	uc.updateState(func(state *clientState) {
+		state.statistics = uc.statistics
+	})
+	uc.refreshMutex.Unlock()
+
+	return uc.SaveStatistics()
+}
+
+// GetTrackerList 获取当前添加到种子的 Tracker 列表
+func (uc *TorrentUsecase) GetTrackerList() TrackerList {
+	state := uc.trackerState.Load()
+	config := uc.loadConfig()
+	return TrackerList{
+		Trackers:             slices.Clone(state.trackers),
+		UpdateTime:           state.updateTime,
+		ConfigTrackers:       slices.Clone(config.defaultTrackers),
+		SubscriptionTrackers: slices.Clone(state.subscription),
+		SubscriptionURL:      config.subTransferURL,
+		CheckTime:            state.checkTime,
+		Err:                  state.err,
+		MaxSize:              config.trackerMaxSize,
+	}
+}
+
+// RefreshTrackers 立即更新 Tracker 列表并添加到所有种子
+func (uc *TorrentUsecase) RefreshTrackers(ctx context.Context) error {
+	if err := uc.UpTrackerList(ctx); err != nil {
+		return err
+	}
+	return uc.UpTorrentALLTrackerList(ctx)
 }
 
 // SaveStatistics 保存统计数据
 func (uc *TorrentUsecase) SaveStatistics() (err error) {
+	uc.saveStatisticsMutex.Lock()
+	defer uc.saveStatisticsMutex.Unlock()
+
+	current := uc.loadState().statistics
 	statistics := HistoricalStatistics{
-		TotalDownloaded: uc.statistics.TotalDownloaded + uc.statistics.TotalDownloadedSession,
-		TotalUploaded:   uc.statistics.TotalUploaded + uc.statistics.TotalUploadedSession,
+		TotalDownloaded: current.TotalDownloaded + current.TotalDownloadedSession,
+		TotalUploaded:   current.TotalUploaded + current.TotalUploadedSession,
 	}
 	err = uc.torrentRepo.SaveHistoricalStatistics(statistics)
+	uc.lastSaveStatisticsErr = err
 	return
 }
 
 // CacheTmpTorrentFile 缓存临时种子文件
 func (uc *TorrentUsecase) CacheTmpTorrentFile(ctx context.Context, data []byte) (fileURL string, err error) {
+	ctx, span := tracer.Start(ctx, "TorrentUsecase.CacheTmpTorrentFile")
+	defer span.End()
+
 	if len(data) == 0 {
 		return "", errors.ResourceNotExist("空的种子文件数据")
 	}
@@ -662,12 +1434,15 @@ func (uc *TorrentUsecase) CacheTmpTorrentFile(ctx context.Context, data []byte)
 		return
 	}
 
-	fileURL, err = url.JoinPath(uc.rootURL, "download", filename)
+	fileURL, err = url.JoinPath(uc.loadConfig().rootURL, "download", filename)
 	return
 }
 
 // GetTmpTorrentFile 获取缓存的临时种子文件
 func (uc *TorrentUsecase) GetTmpTorrentFile(ctx context.Context, filename string) (data []byte, err error) {
+	ctx, span := tracer.Start(ctx, "TorrentUsecase.GetTmpTorrentFile")
+	defer span.End()
+
 	dataOption, err := uc.torrentRepo.GetTmpTorrentFile(ctx, filename)
 	if err != nil {
 		return
@@ -686,9 +1461,13 @@ func (uc *TorrentUsecase) filterTorrent(torrents []*Torrent, filter TorrentFilte
 
 	// 根据种子哈希值过滤
 	if filter.Hashes.HasValue() {
+		hashes := make(map[string]struct{}, len(filter.Hashes.Value()))
+		for _, hash := range filter.Hashes.Value() {
+			hashes[strings.ToLower(hash)] = struct{}{}
+		}
 		tmpTorrents := make([]*Torrent, 0, len(torrents))
 		for _, torrent := range torrents {
-			if _, ok := uc.torrents[torrent.Hash]; ok {
+			if _, ok := hashes[torrent.Hash]; ok {
 				tmpTorrents = append(tmpTorrents, torrent)
 			}
 		}
@@ -851,7 +1630,7 @@ func torrentToQBTorrent(torrent *Torrent) (qbt *pb.TorrentInfo) {
 		ContentPath: torrent.Path,         // 种子内容的绝对路径（多文件种子为根目录路径，单文件种子为文件路径）
 		MagnetUri:   torrent.URL,          // 种子的磁力链接
 		IsPrivate:   torrent.IsPrivate,    // 如果种子来自私有 Tracker，则为 true
-		SavePath:    torrent.TorrentPath,  // 种子数据存储的路径
+		SavePath:    torrent.Path,         // 种子数据存储的路径
 		Size:        torrent.SizeWhenDone, // 已选文件的总大小（字节数）
 		TotalSize:   torrent.TotalSize,    // 种子的总大小（包括未选择的文件，单位：字节）
 
@@ -875,20 +1654,25 @@ func torrentToQBTorrent(torrent *Torrent) (qbt *pb.TorrentInfo) {
 		// 种子的总活跃时间（秒） TR:下载时间+做种时间
 		TimeActive: int64(torrent.TimeDownloading.Seconds()) + int64(torrent.TimeUploading.Seconds()),
 
-		Eta:           0,     // 种子的预计完成时间（秒）
-		FLPiecePrio:   false, // 如果首尾片段已优先下载，则为 true TR:noFunc
-		ForceStart:    false, // 如果启用了强制启动，则为 true TR:noFunc
-		AutoTmm:       false, // 是否由自动种子管理管理
-		Availability:  0,     // 当前可用的文件片段百分比
-		Category:      "",    // 种子的类别 TR:noFunc
-		NumComplete:   0,     // 种群中的做种者数量
-		NumIncomplete: 0,     // 种群中的下载者数量
-		NumLeechs:     0,     // 已连接的下载者数量
-		NumSeeds:      0,     // 已连接的做种者数量
-		SeqDl:         false, // 如果启用了顺序下载，则为 true TR:noFunc
-		State:         "",    // 种子的状态 TODO
-		SuperSeeding:  false, // 如果启用了超级做种模式，则为 true TR:noFunc
-		Tracker:       "",    // 第一个处于工作状态的 Tracker。如果没有工作中的 Tracker，则返回空字符串
+		Eta:           0,                  // 种子的预计完成时间（秒）
+		FLPiecePrio:   false,              // 如果首尾片段已优先下载，则为 true TR:noFunc
+		ForceStart:    torrent.ForceStart, // 如果启用了强制启动，则为 true 代理记录
+		AutoTmm:       false,              // 是否由自动种子管理管理
+		Availability:  0,                  // 当前可用的文件片段百分比
+		Category:      torrent.Category(), // 种子的类别 模拟 qb 分类
+		NumComplete:   0,                  // 种群中的做种者数量
+		NumIncomplete: 0,                  // 种群中的下载者数量
+		NumLeechs:     0,                  // 已连接的下载者数量
+		NumSeeds:      0,                  // 已连接的做种者数量
+		SeqDl:         false,              // 如果启用了顺序下载，则为 true TR:noFunc
+		State:         torrent.State(),    // 种子的状态
+		SuperSeeding:  false,              // 如果启用了超级做种模式，则为 true TR:noFunc
+		Tracker:       "",                 // 第一个处于工作状态的 Tracker。如果没有工作中的 Tracker，则返回空字符串
+
+		InfohashV1:    torrent.Hash,         // 种子的 v1 信息哈希
+		InfohashV2:    "",                   // 种子的 v2 信息哈希 TR:noFunc
+		DownloadPath:  "",                   // 未完成种子的保存路径 TR:noFunc
+		TrackersCount: torrent.TrackerCount, // Tracker 数量
 	}
 
 	tags := "" // 种子的标签列表，以逗号分隔
@@ -897,6 +1681,9 @@ func torrentToQBTorrent(torrent *Torrent) (qbt *pb.TorrentInfo) {
 	}
 	qbt.Tags = tags
 
+	// 与 qb 一致，没有限制时为 -1
+	qbt.DlLimit = -1
+	qbt.UpLimit = -1
 	if torrent.DownloadLimit.HasValue() {
 		qbt.DlLimit = torrent.DownloadLimit.Value() // 种子的下载速度限制
 	}
@@ -917,15 +1704,31 @@ func torrentToQBTorrent(torrent *Torrent) (qbt *pb.TorrentInfo) {
 		// 种子达到的最大做种时间限制（秒）。如果自动管理启用，则为 -2；未设置时默认为 -1
 		qbt.SeedingTimeLimit = torrent.SeedTimeLimit.Value()
 		qbt.MaxSeedingTime = torrent.SeedTimeLimit.Value() // 达到最大做种时间（秒）后停止做种
+		// tr 的做种时间限制为无活动时间限制
+		qbt.InactiveSeedingTimeLimit = torrent.SeedTimeLimit.Value() / 60
+		qbt.MaxInactiveSeedingTime = torrent.SeedTimeLimit.Value() / 60
 	} else {
 		qbt.SeedingTimeLimit = -1
+		qbt.InactiveSeedingTimeLimit = -2
+		qbt.MaxInactiveSeedingTime = -1
 	}
 
 	return qbt
 }
 
+// estimatePieceSize 片段大小为 2 的幂，且 (片段数量-1) * 片段大小 < 总大小 <= 片段数量 * 片段大小
+func estimatePieceSize(totalSize int64, pieceCount int64) int64 {
+	minSize := (totalSize + pieceCount - 1) / pieceCount
+	pieceSize := int64(1)
+	for pieceSize < minSize {
+		pieceSize = pieceSize << 1
+	}
+	return pieceSize
+}
+
 func trTorrentToTorrent(trt transmissionrpc.Torrent) *Torrent {
 	torrent := &Torrent{
+		ID:                     *trt.ID,
 		Hash:                   *trt.HashString,
 		Name:                   *trt.Name,
 		URL:                    *trt.MagnetLink,
@@ -948,6 +1751,9 @@ func trTorrentToTorrent(trt transmissionrpc.Torrent) *Torrent {
 		TotalUploaded:          *trt.UploadedEver,
 		TotalUploadedSession:   0,
 		FileCount:              int32(len(trt.Files)),
+		PieceCount:             0,
+		Pieces:                 make([]byte, 0),
+		WebSeeds:               trt.WebSeeds,
 		RatioLimit:             col.Some(float32(*trt.SeedRatioLimit)),
 		SeedTimeLimit:          col.Some(int64(trt.SeedIdleLimit.Seconds())),
 		Peers:                  make(map[PeerKey]struct{}),
@@ -969,7 +1775,7 @@ func trTorrentToTorrent(trt transmissionrpc.Torrent) *Torrent {
 		UploadedSession:        0,
 		TimeUploading:          *trt.TimeSeeding,
 		UploadRatio:            float32(*trt.UploadRatio),
-		Priority:               int32(*trt.BandwidthPriority),
+		Priority:               -1,
 		SeedingTime:            *trt.TimeSeeding,
 		Status:                 *trt.Status,
 		IsFinished:             *trt.IsFinished,
@@ -982,15 +1788,67 @@ func trTorrentToTorrent(trt transmissionrpc.Torrent) *Torrent {
 		torrent.Labels = col.Some(trt.Labels)
 	}
 
+	// tr 的速度限制单位为 kB/s
 	if trt.DownloadLimited != nil && *trt.DownloadLimited {
-		torrent.DownloadLimit = col.Some(*trt.DownloadLimit)
+		torrent.DownloadLimit = col.Some(*trt.DownloadLimit * speedLimitUnit)
 	}
 	if trt.UploadLimited != nil && *trt.UploadLimited {
-		torrent.UploadLimit = col.Some(*trt.UploadLimit)
+		torrent.UploadLimit = col.Some(*trt.UploadLimit * speedLimitUnit)
+	}
+
+	if trt.TrackerList != nil {
+		for _, tracker := range strings.Split(*trt.TrackerList, "\n") {
+			if strings.TrimSpace(tracker) != "" {
+				torrent.TrackerCount = torrent.TrackerCount + 1
+			}
+		}
+	}
+
+	if trt.Error != nil && *trt.Error != 0 {
+		torrent.HasError = true
+	}
+
+	if trt.PieceCount != nil {
+		torrent.PieceCount = int32(*trt.PieceCount)
 	}
 
 	if trt.PieceSize != nil {
 		torrent.PieceSize = col.Some(BitsToBytes(trt.PieceSize))
+	} else if torrent.PieceCount > 0 {
+		// transmissionrpc 请求的字段名为 PieceSize，tr 不会返回片段大小，使用片段数量推算
+		torrent.PieceSize = col.Some(estimatePieceSize(torrent.TotalSize, int64(torrent.PieceCount)))
+	}
+
+	if trt.PeersFrom != nil {
+		torrent.PeerFromDHTCount = trt.PeersFrom.FromDHT
+		torrent.PeerFromIncomingCount = trt.PeersFrom.FromIncoming
+	}
+	// tr 返回 base64 编码的片段位图
+	if trt.Pieces != nil {
+		pieces, err := base64.StdEncoding.DecodeString(*trt.Pieces)
+		if err == nil {
+			torrent.Pieces = pieces
+		}
+	}
+
+	torrent.Files = make([]TorrentFile, 0, len(trt.Files))
+	for i, file := range trt.Files {
+		wanted := true
+		if i < len(trt.Wanted) {
+			wanted = trt.Wanted[i]
+		}
+		torrent.Files = append(torrent.Files, TorrentFile{
+			Name:           file.Name,
+			Length:         file.Length,
+			BytesCompleted: file.BytesCompleted,
+			Wanted:         wanted,
+		})
+	}
+
+	// qb 的优先级为从1开始的队列位置，做种时返回 -1
+	if trt.QueuePosition != nil && torrent.Status != transmissionrpc.TorrentStatusSeed &&
+		torrent.Status != transmissionrpc.TorrentStatusSeedWait {
+		torrent.Priority = int32(*trt.QueuePosition) + 1
 	}
 
 	return torrent
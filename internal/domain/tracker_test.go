@@ -0,0 +1,45 @@
+package domain_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+
+	"transmission-proxy/conf"
+	"transmission-proxy/internal/domain"
+	"transmission-proxy/internal/fake"
+
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// urlTorrentRepo 与真实实现一样，请求空的 URL 时失败
+type urlTorrentRepo struct {
+	*fake.TorrentRepo
+}
+
+func (r urlTorrentRepo) GetResponseLine(ctx context.Context, url string) ([]string, error) {
+	if url == "" {
+		return nil, fmt.Errorf("Get %q: unsupported protocol scheme", url)
+	}
+	return r.TorrentRepo.GetResponseLine(ctx, url)
+}
+
+// TestUpTrackerListWithoutSubscription 没有配置订阅列表时只使用配置文件中的 Tracker
+func TestUpTrackerListWithoutSubscription(t *testing.T) {
+	logger := log.NewFilter(log.NewStdLogger(os.Stderr), log.FilterLevel(log.LevelError))
+	bootstrap := &conf.Bootstrap{Infra: &conf.Infra{Tr: &conf.Infra_TR{
+		Transfer: "udp://b.example.com:6969/announce\nudp://a.example.com:6969/announce",
+	}}}
+	uc := domain.NewTorrentUsecase(bootstrap, fake.NewAppRepo(), fake.NewBanIPRepo(), fake.NewGeoIPRepo(),
+		urlTorrentRepo{fake.NewTorrentRepo(1, 1)}, fake.NewTrafficRepo(), domain.NewQueueLock(), logger)
+
+	if err := uc.UpTrackerList(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"udp://a.example.com:6969/announce", "udp://b.example.com:6969/announce"}
+	if trackers := uc.GetTrackerList().Trackers; !slices.Equal(trackers, want) {
+		t.Errorf("trackers = %v, want %v", trackers, want)
+	}
+}
@@ -0,0 +1,194 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"transmission-proxy/internal/errors"
+)
+
+// TrafficScope 流量统计范围
+type TrafficScope string
+
+const (
+	TrafficScopeGlobal   TrafficScope = "global"   // 全局
+	TrafficScopeTorrent  TrafficScope = "torrent"  // 单个种子，key 为种子哈希
+	TrafficScopeCategory TrafficScope = "category" // 分类，key 为分类名称
+)
+
+// TrafficResolution 流量统计精度
+type TrafficResolution string
+
+const (
+	TrafficResolutionHour  TrafficResolution = "hour"
+	TrafficResolutionDay   TrafficResolution = "day"
+	TrafficResolutionMonth TrafficResolution = "month"
+)
+
+// TrafficResolutions 所有流量统计精度
+var TrafficResolutions = []TrafficResolution{
+	TrafficResolutionHour,
+	TrafficResolutionDay,
+	TrafficResolutionMonth,
+}
+
+// 默认保留时长，0 为永久保留
+var defaultTrafficRetention = map[TrafficResolution]time.Duration{
+	TrafficResolutionHour:  7 * 24 * time.Hour,
+	TrafficResolutionDay:   365 * 24 * time.Hour,
+	TrafficResolutionMonth: 0,
+}
+
+// Truncate 获取时间所在统计区间的开始时间
+// 天与月按本地时区划分
+func (r TrafficResolution) Truncate(t time.Time) time.Time {
+	switch r {
+	case TrafficResolutionDay:
+		t = t.Local()
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	case TrafficResolutionMonth:
+		t = t.Local()
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	default:
+		return t.Truncate(time.Hour)
+	}
+}
+
+// IsValid 是否为支持的统计精度
+func (r TrafficResolution) IsValid() bool {
+	for _, resolution := range TrafficResolutions {
+		if r == resolution {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValid 是否为支持的统计范围
+func (s TrafficScope) IsValid() bool {
+	return s == TrafficScopeGlobal || s == TrafficScopeTorrent || s == TrafficScopeCategory
+}
+
+// TrafficSample 一个统计区间内的流量增量
+type TrafficSample struct {
+	Scope      TrafficScope
+	Key        string
+	Downloaded int64 // 下载的数据量（字节）
+	Uploaded   int64 // 上传的数据量（字节）
+}
+
+// TrafficPoint 流量时间序列中的一个点
+type TrafficPoint struct {
+	Time       time.Time // 统计区间的开始时间
+	Downloaded int64     // 下载的数据量（字节）
+	Uploaded   int64     // 上传的数据量（字节）
+}
+
+// TrafficRepo .
+type TrafficRepo interface {
+	// AddTraffic 记录流量增量，累加到每种精度的统计区间中
+	AddTraffic(ctx context.Context, at time.Time, samples []TrafficSample) error
+
+	// GetTraffic 获取 [from, to] 之间的流量时间序列
+	GetTraffic(ctx context.Context, scope TrafficScope, key string, resolution TrafficResolution,
+		from time.Time, to time.Time) ([]TrafficPoint, error)
+
+	// PruneTraffic 删除指定精度中开始时间早于 before 的统计
+	PruneTraffic(ctx context.Context, resolution TrafficResolution, before time.Time) error
+}
+
+// recordTraffic 根据两次刷新之间种子累计流量的变化记录流量时间序列
+func (uc *TorrentUsecase) recordTraffic(ctx context.Context, at time.Time, previous map[string]*Torrent,
+	current map[string]*Torrent) error {
+
+	global := TrafficSample{Scope: TrafficScopeGlobal}
+	categories := make(map[string]*TrafficSample)
+	samples := make([]TrafficSample, 0, len(current)+1)
+	for hash, torrent := range current {
+		previousTorrent, ok := previous[hash]
+		if !ok {
+			continue
+		}
+		// tr 重新校验或重新添加种子时累计值可能变小
+		downloaded := max(0, torrent.TotalDownloaded-previousTorrent.TotalDownloaded)
+		uploaded := max(0, torrent.TotalUploaded-previousTorrent.TotalUploaded)
+		if downloaded == 0 && uploaded == 0 {
+			continue
+		}
+
+		samples = append(samples, TrafficSample{
+			Scope:      TrafficScopeTorrent,
+			Key:        hash,
+			Downloaded: downloaded,
+			Uploaded:   uploaded,
+		})
+		global.Downloaded = global.Downloaded + downloaded
+		global.Uploaded = global.Uploaded + uploaded
+
+		category := torrent.Category()
+		if category == "" {
+			continue
+		}
+		sample, ok := categories[category]
+		if !ok {
+			sample = &TrafficSample{Scope: TrafficScopeCategory, Key: category}
+			categories[category] = sample
+		}
+		sample.Downloaded = sample.Downloaded + downloaded
+		sample.Uploaded = sample.Uploaded + uploaded
+	}
+	if global.Downloaded == 0 && global.Uploaded == 0 {
+		return nil
+	}
+
+	samples = append(samples, global)
+	for _, sample := range categories {
+		samples = append(samples, *sample)
+	}
+	return uc.trafficRepo.AddTraffic(ctx, at, samples)
+}
+
+// GetTraffic 获取流量时间序列
+func (uc *TorrentUsecase) GetTraffic(ctx context.Context, scope TrafficScope, key string,
+	resolution TrafficResolution, from time.Time, to time.Time) ([]TrafficPoint, error) {
+
+	ctx, span := tracer.Start(ctx, "TorrentUsecase.GetTraffic")
+	defer span.End()
+
+	if !scope.IsValid() {
+		return nil, errors.InvalidArgument("不支持的统计范围: %s", scope)
+	}
+	if !resolution.IsValid() {
+		return nil, errors.InvalidArgument("不支持的统计精度: %s", resolution)
+	}
+	if scope != TrafficScopeGlobal && key == "" {
+		return nil, errors.InvalidArgument("统计范围 %s 需要指定 key", scope)
+	}
+	if from.After(to) {
+		return nil, errors.InvalidArgument("开始时间晚于结束时间")
+	}
+
+	if scope == TrafficScopeGlobal {
+		key = ""
+	}
+	return uc.trafficRepo.GetTraffic(ctx, scope, key, resolution, resolution.Truncate(from), to)
+}
+
+// PruneTraffic 按保留时长清理流量统计
+func (uc *TorrentUsecase) PruneTraffic(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "TorrentUsecase.PruneTraffic")
+	defer span.End()
+
+	nowTime := time.Now()
+	for _, resolution := range TrafficResolutions {
+		retention := uc.trafficRetention[resolution]
+		if retention <= 0 {
+			continue
+		}
+		err = uc.trafficRepo.PruneTraffic(ctx, resolution, nowTime.Add(-retention))
+		if err != nil {
+			return
+		}
+	}
+	return
+}
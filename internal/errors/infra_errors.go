@@ -9,6 +9,15 @@ import (
 const (
 	ErrReasonResourceNotExist string = "ERR_RESOURCE_NOT_EXIST"
 	ErrCodeResourceNotExist   int32  = 404
+
+	ErrReasonInvalidArgument string = "ERR_INVALID_ARGUMENT"
+	ErrCodeInvalidArgument   int32  = 400
+
+	ErrReasonUnauthorized string = "ERR_UNAUTHORIZED"
+	ErrCodeUnauthorized   int32  = 401
+
+	ErrReasonForbidden string = "ERR_FORBIDDEN"
+	ErrCodeForbidden   int32  = 403
 )
 
 func IsResourceNotExist(err error) bool {
@@ -26,3 +35,51 @@ func ResourceNotExist(format string, args ...interface{}) *errors.Error {
 		fmt.Sprintf(format, args...),
 	)
 }
+
+func IsInvalidArgument(err error) bool {
+	if err == nil {
+		return false
+	}
+	e := errors.FromError(err)
+	return e.Reason == ErrReasonInvalidArgument && e.Code == ErrCodeInvalidArgument
+}
+
+func InvalidArgument(format string, args ...interface{}) *errors.Error {
+	return errors.New(
+		int(ErrCodeInvalidArgument),
+		ErrReasonInvalidArgument,
+		fmt.Sprintf(format, args...),
+	)
+}
+
+func IsUnauthorized(err error) bool {
+	if err == nil {
+		return false
+	}
+	e := errors.FromError(err)
+	return e.Reason == ErrReasonUnauthorized && e.Code == ErrCodeUnauthorized
+}
+
+func Unauthorized(format string, args ...interface{}) *errors.Error {
+	return errors.New(
+		int(ErrCodeUnauthorized),
+		ErrReasonUnauthorized,
+		fmt.Sprintf(format, args...),
+	)
+}
+
+func IsForbidden(err error) bool {
+	if err == nil {
+		return false
+	}
+	e := errors.FromError(err)
+	return e.Reason == ErrReasonForbidden && e.Code == ErrCodeForbidden
+}
+
+func Forbidden(format string, args ...interface{}) *errors.Error {
+	return errors.New(
+		int(ErrCodeForbidden),
+		ErrReasonForbidden,
+		fmt.Sprintf(format, args...),
+	)
+}
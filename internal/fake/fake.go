@@ -0,0 +1,15 @@
+// Package fake 提供内存中的仓储实现与模拟的 tr RPC 服务器，用于在没有 tr 与 nftables 的环境中测试用例
+// 只由 _test.go 文件导入，不会编译到代理中
+package fake
+
+import (
+	"transmission-proxy/internal/domain"
+)
+
+var (
+	_ domain.AppRepo     = (*AppRepo)(nil)
+	_ domain.TorrentRepo = (*TorrentRepo)(nil)
+	_ domain.BanIPRepo   = (*BanIPRepo)(nil)
+	_ domain.GeoIPRepo   = (*GeoIPRepo)(nil)
+	_ domain.TrafficRepo = (*TrafficRepo)(nil)
+)
@@ -0,0 +1,378 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"transmission-proxy/internal/data"
+	"transmission-proxy/internal/domain"
+
+	"github.com/hekmon/transmissionrpc/v3"
+	col "github.com/noxiouz/golang-generics-util/collection"
+)
+
+// AppRepo 内存中的 AppRepo
+type AppRepo struct {
+	mutex            sync.Mutex
+	preferences      transmissionrpc.SessionArguments
+	proxyPreferences domain.ProxyPreferences
+}
+
+// NewAppRepo 创建启用慢速种子模拟的 AppRepo
+func NewAppRepo() *AppRepo {
+	downloadDir := "/downloads"
+	return &AppRepo{
+		preferences: transmissionrpc.SessionArguments{
+			DownloadDir: &downloadDir,
+		},
+		proxyPreferences: domain.ProxyPreferences{
+			DontCountSlowTorrents:      true,
+			SlowTorrentDlRateThreshold: 2,
+			SlowTorrentUlRateThreshold: 2,
+			SlowTorrentInactiveTimer:   0,
+		},
+	}
+}
+
+// GetPreferences 获取首选项
+func (r *AppRepo) GetPreferences(_ context.Context) (transmissionrpc.SessionArguments, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.preferences, nil
+}
+
+// SetPreferences 设置首选项，队列数量加上默认后端因慢速种子额外增加的数量
+func (r *AppRepo) SetPreferences(_ context.Context, pre transmissionrpc.SessionArguments,
+	slowSlots map[string]domain.QueueSlots) error {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	slots := slowSlots[data.DefaultBackendName]
+	if pre.DownloadQueueSize != nil {
+		size := *pre.DownloadQueueSize + slots.Download
+		pre.DownloadQueueSize = &size
+	}
+	if pre.SeedQueueSize != nil {
+		size := *pre.SeedQueueSize + slots.Seed
+		pre.SeedQueueSize = &size
+	}
+	r.setPreferences(pre)
+	return nil
+}
+
+// GetBackendPreferences 获取默认后端的首选项
+func (r *AppRepo) GetBackendPreferences(_ context.Context) ([]domain.BackendPreferences, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return []domain.BackendPreferences{{Backend: data.DefaultBackendName, Preferences: r.preferences}}, nil
+}
+
+// SetBackendPreferences 设置默认后端的首选项
+func (r *AppRepo) SetBackendPreferences(_ context.Context, backend string,
+	pre transmissionrpc.SessionArguments) error {
+
+	if backend != data.DefaultBackendName {
+		return fmt.Errorf("tr 后端 %s 不存在", backend)
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.setPreferences(pre)
+	return nil
+}
+
+// setPreferences 更新已设置的首选项
+func (r *AppRepo) setPreferences(pre transmissionrpc.SessionArguments) {
+	if pre.DownloadDir != nil {
+		r.preferences.DownloadDir = pre.DownloadDir
+	}
+	if pre.ScriptTorrentDoneFilename != nil {
+		r.preferences.ScriptTorrentDoneFilename = pre.ScriptTorrentDoneFilename
+	}
+	if pre.DownloadQueueEnabled != nil {
+		r.preferences.DownloadQueueEnabled = pre.DownloadQueueEnabled
+	}
+	if pre.DownloadQueueSize != nil {
+		r.preferences.DownloadQueueSize = pre.DownloadQueueSize
+	}
+	if pre.SeedQueueEnabled != nil {
+		r.preferences.SeedQueueEnabled = pre.SeedQueueEnabled
+	}
+	if pre.SeedQueueSize != nil {
+		r.preferences.SeedQueueSize = pre.SeedQueueSize
+	}
+}
+
+// GetProxyPreferences 获取代理模拟实现的首选项
+func (r *AppRepo) GetProxyPreferences(_ context.Context) (domain.ProxyPreferences, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	pre := r.proxyPreferences
+	pre.SlowSlots = maps.Clone(pre.SlowSlots)
+	return pre, nil
+}
+
+// SaveProxyPreferences 保存代理模拟实现的首选项
+func (r *AppRepo) SaveProxyPreferences(_ context.Context, pre domain.ProxyPreferences) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	pre.SlowSlots = maps.Clone(pre.SlowSlots)
+	r.proxyPreferences = pre
+	return nil
+}
+
+// BanIPRepo 内存中的 BanIPRepo
+type BanIPRepo struct {
+	mutex sync.RWMutex
+	// banlist key: <ip>
+	banlist map[string]time.Time
+	// banInfos 保存的封禁附加信息 key: <ip>
+	banInfos map[string]domain.BanInfo
+}
+
+// NewBanIPRepo .
+func NewBanIPRepo() *BanIPRepo {
+	return &BanIPRepo{
+		banlist:  make(map[string]time.Time),
+		banInfos: make(map[string]domain.BanInfo),
+	}
+}
+
+// GetBannedIPV4Status 获取封禁ipv4状态
+func (r *BanIPRepo) GetBannedIPV4Status(_ context.Context, ips []string) (map[string]col.Option[*time.Time], error) {
+	return r.status(ips), nil
+}
+
+// GetBannedIPV6Status 获取封禁ipv6状态
+func (r *BanIPRepo) GetBannedIPV6Status(_ context.Context, ips []string) (map[string]col.Option[*time.Time], error) {
+	return r.status(ips), nil
+}
+
+// BanIPV4 封禁ipv4
+func (r *BanIPRepo) BanIPV4(_ context.Context, ips []string) error {
+	r.ban(ips)
+	return nil
+}
+
+// BanIPV6 封禁ipv6
+func (r *BanIPRepo) BanIPV6(_ context.Context, ips []string) error {
+	r.ban(ips)
+	return nil
+}
+
+// UnbanIPV4 解禁ipv4
+func (r *BanIPRepo) UnbanIPV4(_ context.Context, ips []string) error {
+	r.unban(ips)
+	return nil
+}
+
+// UnbanIPV6 解禁ipv6
+func (r *BanIPRepo) UnbanIPV6(_ context.Context, ips []string) error {
+	r.unban(ips)
+	return nil
+}
+
+// UpBanIPV4List 更新ipv4封禁列表
+func (r *BanIPRepo) UpBanIPV4List(_ context.Context, ips []string) error {
+	r.replace(ips)
+	return nil
+}
+
+// UpBanIPV6List 更新ipv6封禁列表
+func (r *BanIPRepo) UpBanIPV6List(_ context.Context, ips []string) error {
+	r.replace(ips)
+	return nil
+}
+
+// ClearBanList 清空Ban列表
+func (r *BanIPRepo) ClearBanList(_ context.Context) error {
+	r.replace(nil)
+	return nil
+}
+
+// CheckTables 内存中的封禁列表总是可用
+func (r *BanIPRepo) CheckTables(_ context.Context) error {
+	return nil
+}
+
+// GetBannedIPs 获取所有封禁的ip
+func (r *BanIPRepo) GetBannedIPs(_ context.Context) ([]domain.BannedIP, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	bannedIPs := make([]domain.BannedIP, 0, len(r.banlist))
+	for ip, banTime := range r.banlist {
+		bannedIPs = append(bannedIPs, domain.BannedIP{IP: ip, BannedAt: banTime})
+	}
+	return bannedIPs, nil
+}
+
+// GetBanInfos 获取保存的封禁附加信息
+func (r *BanIPRepo) GetBanInfos(_ context.Context) (map[string]domain.BanInfo, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return maps.Clone(r.banInfos), nil
+}
+
+// SaveBanInfos 保存封禁附加信息
+func (r *BanIPRepo) SaveBanInfos(_ context.Context, infos map[string]domain.BanInfo) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.banInfos = maps.Clone(infos)
+	return nil
+}
+
+// BannedIPs 当前封禁的IP
+func (r *BanIPRepo) BannedIPs() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	ips := make([]string, 0, len(r.banlist))
+	for ip := range r.banlist {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+func (r *BanIPRepo) status(ips []string) map[string]col.Option[*time.Time] {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	statuses := make(map[string]col.Option[*time.Time], len(ips))
+	for _, ip := range ips {
+		banTime, ok := r.banlist[ip]
+		if ok {
+			statuses[ip] = col.Some(&banTime)
+		} else {
+			statuses[ip] = col.None[*time.Time]()
+		}
+	}
+	return statuses
+}
+
+func (r *BanIPRepo) ban(ips []string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	nowTime := time.Now()
+	for _, ip := range ips {
+		r.banlist[ip] = nowTime
+	}
+}
+
+func (r *BanIPRepo) unban(ips []string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, ip := range ips {
+		delete(r.banlist, ip)
+	}
+}
+
+func (r *BanIPRepo) replace(ips []string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	nowTime := time.Now()
+	banlist := make(map[string]time.Time, len(ips))
+	for _, ip := range ips {
+		banTime, ok := r.banlist[ip]
+		if !ok {
+			banTime = nowTime
+		}
+		banlist[ip] = banTime
+	}
+	r.banlist = banlist
+}
+
+// GeoIPRepo 所有IP都属于同一个国家的 GeoIPRepo
+type GeoIPRepo struct {
+	Country domain.Country
+}
+
+// NewGeoIPRepo .
+func NewGeoIPRepo() *GeoIPRepo {
+	return &GeoIPRepo{
+		Country: domain.Country{Name: "Japan", Code: "JP"},
+	}
+}
+
+// IsEnabled 是否配置了 GeoIP 数据库
+func (r *GeoIPRepo) IsEnabled(_ context.Context) bool {
+	return true
+}
+
+// LookupCountry 查询IP所属国家
+func (r *GeoIPRepo) LookupCountry(_ context.Context, _ string) (col.Option[*domain.Country], error) {
+	country := r.Country
+	return col.Some(&country), nil
+}
+
+// trafficKey 流量时间序列的一个统计区间
+type trafficKey struct {
+	resolution domain.TrafficResolution
+	scope      domain.TrafficScope
+	key        string
+	time       int64
+}
+
+// TrafficRepo 内存中的 TrafficRepo
+type TrafficRepo struct {
+	mutex  sync.Mutex
+	points map[trafficKey]domain.TrafficPoint
+}
+
+// NewTrafficRepo .
+func NewTrafficRepo() *TrafficRepo {
+	return &TrafficRepo{
+		points: make(map[trafficKey]domain.TrafficPoint),
+	}
+}
+
+// AddTraffic 记录流量增量，累加到每种精度的统计区间中
+func (r *TrafficRepo) AddTraffic(_ context.Context, at time.Time, samples []domain.TrafficSample) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, resolution := range domain.TrafficResolutions {
+		start := resolution.Truncate(at)
+		for _, sample := range samples {
+			key := trafficKey{resolution, sample.Scope, sample.Key, start.Unix()}
+			point := r.points[key]
+			point.Time = start
+			point.Downloaded = point.Downloaded + sample.Downloaded
+			point.Uploaded = point.Uploaded + sample.Uploaded
+			r.points[key] = point
+		}
+	}
+	return nil
+}
+
+// GetTraffic 获取 [from, to] 之间的流量时间序列
+func (r *TrafficRepo) GetTraffic(_ context.Context, scope domain.TrafficScope, key string,
+	resolution domain.TrafficResolution, from time.Time, to time.Time) ([]domain.TrafficPoint, error) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	points := make([]domain.TrafficPoint, 0)
+	for k, point := range r.points {
+		if k.resolution != resolution || k.scope != scope || k.key != key ||
+			k.time < from.Unix() || k.time > to.Unix() {
+			continue
+		}
+		points = append(points, point)
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].Time.Before(points[j].Time)
+	})
+	return points, nil
+}
+
+// PruneTraffic 删除指定精度中开始时间早于 before 的统计
+func (r *TrafficRepo) PruneTraffic(_ context.Context, resolution domain.TrafficResolution, before time.Time) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for k := range r.points {
+		if k.resolution == resolution && k.time < before.Unix() {
+			delete(r.points, k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"transmission-proxy/internal/data"
+	"transmission-proxy/internal/domain"
+	"transmission-proxy/internal/errors"
+
+	"github.com/hekmon/cunits/v2"
+	"github.com/hekmon/transmissionrpc/v3"
+	col "github.com/noxiouz/golang-generics-util/collection"
+)
+
+// TorrentRepo 内存中的 TorrentRepo
+// 每次获取所有种子时推进一轮模拟，种子的累计流量增加、Peer 按轮次连接与断开
+type TorrentRepo struct {
+	mutex sync.Mutex
+
+	torrentCount int
+	peerCount    int
+	// round 模拟的轮次
+	round int64
+
+	peers      *data.PeerStore
+	statistics domain.HistoricalStatistics
+	trackers   []string
+	// files key: <filename>
+	files map[string][]byte
+}
+
+// NewTorrentRepo 创建模拟指定数量种子与每个种子 Peer 数量的 TorrentRepo
+func NewTorrentRepo(torrentCount int, peerCount int) *TorrentRepo {
+	return &TorrentRepo{
+		torrentCount: torrentCount,
+		peerCount:    peerCount,
+		peers:        data.NewPeerStore(torrentCount * peerCount * 2),
+		trackers:     make([]string, 0),
+		files:        make(map[string][]byte),
+	}
+}
+
+// Hash 第 i 个种子的哈希
+func Hash(i int) string {
+	return fmt.Sprintf("%040x", i+1)
+}
+
+// GetResponseLine 返回模拟的 Tracker 订阅列表
+func (r *TorrentRepo) GetResponseLine(_ context.Context, _ string) ([]string, error) {
+	r.mutex.Lock()
+	round := r.round
+	r.mutex.Unlock()
+
+	lines := make([]string, 0, 8)
+	for i := int64(0); i < 8; i++ {
+		lines = append(lines, fmt.Sprintf("udp://tracker%d.example.com:%d/announce", i, 6969+round%3))
+	}
+	return lines, nil
+}
+
+// AddTorrent 添加种子，只返回种子ID
+func (r *TorrentRepo) AddTorrent(_ context.Context, torrents []*domain.DownloadTorrent) ([]int64, error) {
+	ids := make([]int64, 0, len(torrents))
+	for i := range torrents {
+		ids = append(ids, int64(r.torrentCount+i+1))
+	}
+	return ids, nil
+}
+
+// UpTracker 记录最近一次更新的 Tracker
+func (r *TorrentRepo) UpTracker(_ context.Context, _ []int64, trackers []string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.trackers = append(make([]string, 0, len(trackers)), trackers...)
+	return nil
+}
+
+// GetTorrent 获取当前轮次的种子
+func (r *TorrentRepo) GetTorrent(_ context.Context, hash string) (col.Option[transmissionrpc.Torrent], error) {
+	r.mutex.Lock()
+	round := r.round
+	r.mutex.Unlock()
+
+	for i := 0; i < r.torrentCount; i++ {
+		if Hash(i) == strings.ToLower(hash) {
+			return col.Some(r.torrent(i, round)), nil
+		}
+	}
+	return col.None[transmissionrpc.Torrent](), nil
+}
+
+// GetTorrentAll 推进一轮模拟并返回所有种子
+func (r *TorrentRepo) GetTorrentAll(_ context.Context) ([]domain.BackendTorrents, error) {
+	r.mutex.Lock()
+	r.round = r.round + 1
+	round := r.round
+	r.mutex.Unlock()
+
+	torrents := make([]transmissionrpc.Torrent, 0, r.torrentCount)
+	for i := 0; i < r.torrentCount; i++ {
+		torrents = append(torrents, r.torrent(i, round))
+	}
+	return []domain.BackendTorrents{{Backend: data.DefaultBackendName, Torrents: torrents}}, nil
+}
+
+// GetPeer 获取Peer
+func (r *TorrentRepo) GetPeer(_ context.Context, key domain.PeerKey) (col.Option[*domain.Peer], error) {
+	peer, ok := r.peers.Get(key)
+	if !ok {
+		return col.None[*domain.Peer](), nil
+	}
+	return col.Some(peer), nil
+}
+
+// SetPeer 设置Peer
+func (r *TorrentRepo) SetPeer(_ context.Context, key domain.PeerKey, peer *domain.Peer) error {
+	r.peers.Set(key, peer)
+	return nil
+}
+
+// DeactivatePeers 将指定时间之前没有更新的Peer标记为不活跃
+func (r *TorrentRepo) DeactivatePeers(_ context.Context, before time.Time) error {
+	r.peers.Deactivate(before)
+	return nil
+}
+
+// GetStateRefreshInterval 获取状态更新间隔(秒)
+func (r *TorrentRepo) GetStateRefreshInterval() int64 {
+	return 1
+}
+
+// GetHistoricalStatistics 获取历史统计数据
+func (r *TorrentRepo) GetHistoricalStatistics() (domain.HistoricalStatistics, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.statistics, nil
+}
+
+// SaveHistoricalStatistics 保存历史统计
+func (r *TorrentRepo) SaveHistoricalStatistics(statistics domain.HistoricalStatistics) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.statistics = statistics
+	return nil
+}
+
+// GetBackendStatus 返回一个可以访问的后端
+func (r *TorrentRepo) GetBackendStatus(_ context.Context) []domain.BackendStatus {
+	return []domain.BackendStatus{{Name: "fake", Reachable: true, Version: 17}}
+}
+
+// GetSessionStats 返回随轮次增长的会话统计
+func (r *TorrentRepo) GetSessionStats(_ context.Context) (map[string]domain.SessionStats, error) {
+	r.mutex.Lock()
+	round := r.round
+	r.mutex.Unlock()
+
+	return map[string]domain.SessionStats{"fake": {
+		DownloadSpeed:        int64(r.torrentCount) * 1024,
+		UploadSpeed:          int64(r.torrentCount) * 512,
+		CumulativeDownloaded: round * int64(r.torrentCount) * 1024,
+		CumulativeUploaded:   round * int64(r.torrentCount) * 512,
+		CurrentDownloaded:    round * int64(r.torrentCount) * 1024,
+		CurrentUploaded:      round * int64(r.torrentCount) * 512,
+	}}, nil
+}
+
+// GetFreeSpace 获取指定目录所在磁盘的剩余空间（字节）
+func (r *TorrentRepo) GetFreeSpace(_ context.Context, _ string) (int64, error) {
+	return 1 << 40, nil
+}
+
+// CacheTmpTorrentFile 缓存临时种子文件
+func (r *TorrentRepo) CacheTmpTorrentFile(_ context.Context, filename string, data []byte) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.files[filename] = data
+	return nil
+}
+
+// GetTmpTorrentFile 获取缓存的临时种子文件
+func (r *TorrentRepo) GetTmpTorrentFile(_ context.Context, filename string) (col.Option[[]byte], error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	data, ok := r.files[filename]
+	if !ok {
+		return col.None[[]byte](), nil
+	}
+	return col.Some(data), nil
+}
+
+// ReannounceTrackerServer 重新通告tracker服务器
+func (r *TorrentRepo) ReannounceTrackerServer(_ context.Context, _ []int64) error {
+	return nil
+}
+
+// QueueMoveTop 将种子移动到队列顶部
+func (r *TorrentRepo) QueueMoveTop(_ context.Context, _ []int64) error {
+	return nil
+}
+
+// QueueMoveUp 将种子在队列中上移
+func (r *TorrentRepo) QueueMoveUp(_ context.Context, _ []int64) error {
+	return nil
+}
+
+// QueueMoveDown 将种子在队列中下移
+func (r *TorrentRepo) QueueMoveDown(_ context.Context, _ []int64) error {
+	return nil
+}
+
+// QueueMoveBottom 将种子移动到队列底部
+func (r *TorrentRepo) QueueMoveBottom(_ context.Context, _ []int64) error {
+	return nil
+}
+
+// StartTorrent 按队列启动种子
+func (r *TorrentRepo) StartTorrent(_ context.Context, _ []int64) error {
+	return nil
+}
+
+// StartTorrentNow 忽略队列立即启动种子
+func (r *TorrentRepo) StartTorrentNow(_ context.Context, _ []int64) error {
+	return nil
+}
+
+// GetPieceHashes 模拟无法访问种子文件
+func (r *TorrentRepo) GetPieceHashes(_ context.Context, torrentFile string) ([]string, error) {
+	return nil, errors.ResourceNotExist("种子文件 %s 不存在", torrentFile)
+}
+
+// torrent 生成第 i 个种子在指定轮次的状态
+func (r *TorrentRepo) torrent(i int, round int64) transmissionrpc.Torrent {
+	id := int64(i + 1)
+	hash := Hash(i)
+	name := fmt.Sprintf("torrent-%d", i)
+	magnet := "magnet:?xt=urn:btih:" + hash
+	downloadDir := "/downloads"
+	torrentFile := "/config/torrents/" + hash + ".torrent"
+	comment := ""
+	isPrivate := i%2 == 0
+	totalSize := cunits.Bits(int64(1<<30) * 8)
+	pieceSize := cunits.Bits(int64(1<<20) * 8)
+	pieceCount := int64(1 << 10)
+	downloaded := round * 1024 * id
+	uploaded := round * 512 * id
+	leftUntilDone := max(0, int64(1<<30)-downloaded)
+	haveValid := int64(1<<30) - leftUntilDone
+	corrupt := int64(0)
+	seedRatioLimit := float64(2)
+	seedIdleLimit := 30 * time.Minute
+	maxConnectedPeers := int64(50)
+	rateDownload := 1024 * id * (round % 3)
+	rateUpload := 512 * id * (round % 2)
+	uploadRatio := float64(uploaded) / float64(max(downloaded, 1))
+	timeDownloading := time.Duration(round) * time.Second
+	timeSeeding := time.Duration(round) * time.Second
+	queuePosition := int64(i)
+	falseValue := false
+	stalled := round%7 == 0
+	nowTime := time.Now()
+
+	status := transmissionrpc.TorrentStatusDownload
+	switch i % 4 {
+	case 1:
+		status = transmissionrpc.TorrentStatusSeed
+	case 3:
+		status = transmissionrpc.TorrentStatusStopped
+	}
+
+	peers := make([]transmissionrpc.Peer, 0, r.peerCount)
+	for j := 0; j < r.peerCount; j++ {
+		// 每轮有部分 Peer 断开，之后重新连接
+		if (round+int64(j))%5 == 0 {
+			continue
+		}
+		peers = append(peers, transmissionrpc.Peer{
+			Address:      fmt.Sprintf("10.%d.%d.%d", i/256, i%256, j+1),
+			ClientName:   "qBittorrent 4.6.2",
+			FlagStr:      "DEI",
+			IsIncoming:   j%3 == 0,
+			IsUTP:        j%2 == 0,
+			Port:         int64(50000 + j),
+			Progress:     float64(j) / float64(r.peerCount),
+			RateToClient: 100 * int64(j) * (round % 3),
+			RateToPeer:   50 * int64(j) * (round % 2),
+		})
+	}
+	peersConnected := int64(len(peers))
+	peersSending := peersConnected / 2
+
+	return transmissionrpc.Torrent{
+		ID:                &id,
+		HashString:        &hash,
+		Name:              &name,
+		MagnetLink:        &magnet,
+		DownloadDir:       &downloadDir,
+		TorrentFile:       &torrentFile,
+		Labels:            []string{"category:fake"},
+		DateCreated:       &nowTime,
+		AddedDate:         &nowTime,
+		DoneDate:          &nowTime,
+		StartDate:         &nowTime,
+		Comment:           &comment,
+		IsPrivate:         &isPrivate,
+		SizeWhenDone:      &totalSize,
+		TotalSize:         &totalSize,
+		HaveValid:         &haveValid,
+		PieceSize:         &pieceSize,
+		PieceCount:        &pieceCount,
+		CorruptEver:       &corrupt,
+		DownloadedEver:    &downloaded,
+		UploadedEver:      &uploaded,
+		Files:             []transmissionrpc.TorrentFile{{Name: name, Length: 1 << 30, BytesCompleted: haveValid}},
+		Wanted:            []bool{true},
+		SeedRatioLimit:    &seedRatioLimit,
+		SeedIdleLimit:     &seedIdleLimit,
+		PeersConnected:    &peersConnected,
+		PeersSendingToUs:  &peersSending,
+		PeersFrom:         &transmissionrpc.TorrentPeersFrom{FromDHT: peersConnected / 2, FromIncoming: 1},
+		MaxConnectedPeers: &maxConnectedPeers,
+		UploadRatio:       &uploadRatio,
+		LeftUntilDone:     &leftUntilDone,
+		RateDownload:      &rateDownload,
+		RateUpload:        &rateUpload,
+		DownloadLimited:   &falseValue,
+		UploadLimited:     &falseValue,
+		TimeDownloading:   &timeDownloading,
+		TimeSeeding:       &timeSeeding,
+		QueuePosition:     &queuePosition,
+		Status:            &status,
+		IsFinished:        &falseValue,
+		IsStalled:         &stalled,
+		Peers:             peers,
+	}
+}
@@ -0,0 +1,770 @@
+package fake
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hekmon/transmissionrpc/v3"
+)
+
+const (
+	// TRRPCVersion 模拟的 tr RPC 版本
+	TRRPCVersion = 17
+	// TRVersion 模拟的 tr 版本
+	TRVersion = "4.0.6 (38c164933e)"
+
+	trSessionIDHeader = "X-Transmission-Session-Id"
+	trRPCPath         = "/transmission/rpc"
+)
+
+// trRequest tr RPC 请求
+type trRequest struct {
+	Method    string          `json:"method"`
+	Arguments json.RawMessage `json:"arguments"`
+	Tag       int             `json:"tag"`
+}
+
+// trResponse tr RPC 响应
+type trResponse struct {
+	Arguments any    `json:"arguments"`
+	Result    string `json:"result"`
+	Tag       int    `json:"tag"`
+}
+
+// trTorrent 种子，字段使用 tr RPC 的原始格式
+type trTorrent map[string]any
+
+// TRServer 进程内的 tr RPC 模拟服务器
+// 种子与会话以 tr RPC 的原始 JSON 字段保存，torrent-get 与 session-get 按请求的字段返回
+type TRServer struct {
+	server *httptest.Server
+
+	mutex     sync.Mutex
+	sessionID string
+	session   map[string]any
+	stats     map[string]any
+	// torrents 按 id 排序
+	torrents []trTorrent
+	nextID   int64
+	// calls key: <method>
+	calls map[string]int
+	// unavailable 模拟 tr 无法访问，所有请求返回 503
+	unavailable bool
+	// failures 执行请求后返回 500 的次数，模拟响应丢失 key: <method>
+	failures map[string]int
+}
+
+// NewTRServer 启动模拟服务器，使用完毕后调用 Close 关闭
+func NewTRServer() *TRServer {
+	s := &TRServer{
+		sessionID: "fake-session-id",
+		session: map[string]any{
+			"rpc-version":                  TRRPCVersion,
+			"rpc-version-minimum":          14,
+			"rpc-version-semver":           "5.3.0",
+			"version":                      TRVersion,
+			"download-dir":                 "/downloads",
+			"incomplete-dir":               "/downloads/incomplete",
+			"incomplete-dir-enabled":       false,
+			"start-added-torrents":         true,
+			"rename-partial-files":         true,
+			"download-queue-enabled":       true,
+			"download-queue-size":          5,
+			"seed-queue-enabled":           false,
+			"seed-queue-size":              10,
+			"seedRatioLimited":             false,
+			"seedRatioLimit":               2.0,
+			"peer-port":                    51413,
+			"peer-port-random-on-start":    false,
+			"port-forwarding-enabled":      true,
+			"script-torrent-done-enabled":  false,
+			"script-torrent-done-filename": "",
+			"peer-limit-global":            200,
+			"peer-limit-per-torrent":       50,
+			"speed-limit-down":             100,
+			"speed-limit-down-enabled":     false,
+			"speed-limit-up":               100,
+			"speed-limit-up-enabled":       false,
+			"alt-speed-down":               50,
+			"alt-speed-up":                 50,
+			"alt-speed-enabled":            false,
+		},
+		stats:    newTRSessionStats(),
+		nextID:   1,
+		calls:    make(map[string]int),
+		failures: make(map[string]int),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Close 关闭模拟服务器
+func (s *TRServer) Close() {
+	s.server.Close()
+}
+
+// RPCURL tr RPC 地址，可直接用作 infra.tr.rpc_url
+func (s *TRServer) RPCURL() string {
+	return s.server.URL + trRPCPath
+}
+
+// Calls 指定方法被调用的次数
+func (s *TRServer) Calls(method string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.calls[method]
+}
+
+// AddTorrent 添加一个已下载完成的种子，返回种子 id
+func (s *TRServer) AddTorrent(hash string, name string) int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.addTorrent(hash, name, s.session["download-dir"].(string), nil, false)
+}
+
+// SetTorrentFields 使用 tr RPC 的原始字段覆盖种子数据
+func (s *TRServer) SetTorrentFields(hash string, fields map[string]any) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	torrent := s.findTorrent(hash)
+	if torrent == nil {
+		return
+	}
+	for key, value := range fields {
+		torrent[key] = value
+	}
+}
+
+// SetPeers 设置种子的 Peer 列表，同时更新 Peer 统计
+func (s *TRServer) SetPeers(hash string, peers []transmissionrpc.Peer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	torrent := s.findTorrent(hash)
+	if torrent == nil {
+		return
+	}
+	setTRPeers(torrent, peers)
+}
+
+// setTRPeers 设置种子的 Peer 列表与 Peer 统计
+func setTRPeers(torrent trTorrent, peers []transmissionrpc.Peer) {
+	peersFrom := transmissionrpc.TorrentPeersFrom{}
+	sendingToUs := 0
+	gettingFromUs := 0
+	for _, peer := range peers {
+		if peer.IsIncoming {
+			peersFrom.FromIncoming = peersFrom.FromIncoming + 1
+		} else {
+			peersFrom.FromTracker = peersFrom.FromTracker + 1
+		}
+		if peer.RateToClient > 0 {
+			sendingToUs = sendingToUs + 1
+		}
+		if peer.RateToPeer > 0 {
+			gettingFromUs = gettingFromUs + 1
+		}
+	}
+	torrent["peers"] = peers
+	torrent["peersConnected"] = len(peers)
+	torrent["peersFrom"] = peersFrom
+	torrent["peersSendingToUs"] = sendingToUs
+	torrent["peersGettingFromUs"] = gettingFromUs
+}
+
+// AddSessionTraffic 增加会话的上传与下载量
+func (s *TRServer) AddSessionTraffic(downloaded int64, uploaded int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, key := range []string{"cumulative-stats", "current-stats"} {
+		details := s.stats[key].(map[string]int64)
+		details["downloadedBytes"] = details["downloadedBytes"] + downloaded
+		details["uploadedBytes"] = details["uploadedBytes"] + uploaded
+	}
+}
+
+// Torrent 获取种子的原始字段
+func (s *TRServer) Torrent(hash string) (map[string]any, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	torrent := s.findTorrent(hash)
+	if torrent == nil {
+		return nil, false
+	}
+	fields := make(map[string]any, len(torrent))
+	for key, value := range torrent {
+		fields[key] = value
+	}
+	return fields, true
+}
+
+// SetUnavailable 设置 tr 是否无法访问
+func (s *TRServer) SetUnavailable(unavailable bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.unavailable = unavailable
+}
+
+// FailAfterCall 之后 n 次 method 请求在执行后返回 500，模拟 tr 已经执行但响应丢失
+func (s *TRServer) FailAfterCall(method string, n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures[method] = n
+}
+
+func (s *TRServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	unavailable := s.unavailable
+	s.mutex.Unlock()
+	if unavailable {
+		http.Error(w, "transmission is unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != http.MethodPost || r.URL.Path != trRPCPath {
+		http.NotFound(w, r)
+		return
+	}
+	// 与 tr 一致，会话 id 不匹配时返回 409 与新的会话 id
+	if r.Header.Get(trSessionIDHeader) != s.sessionID {
+		w.Header().Set(trSessionIDHeader, s.sessionID)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	var req trRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	arguments, err := s.call(req.Method, req.Arguments)
+	s.mutex.Lock()
+	failed := s.failures[req.Method] > 0
+	if failed {
+		s.failures[req.Method]--
+	}
+	s.mutex.Unlock()
+	if failed {
+		http.Error(w, "response lost", http.StatusInternalServerError)
+		return
+	}
+	res := trResponse{
+		Arguments: arguments,
+		Result:    "success",
+		Tag:       req.Tag,
+	}
+	if err != nil {
+		res.Arguments = map[string]any{}
+		res.Result = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// trIDsArguments 指定种子的请求参数
+type trIDsArguments struct {
+	IDs json.RawMessage `json:"ids"`
+}
+
+func (s *TRServer) call(method string, raw json.RawMessage) (any, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.calls[method] = s.calls[method] + 1
+
+	switch method {
+	case "session-get":
+		var args struct {
+			Fields []string `json:"fields"`
+		}
+		if err := unmarshalArguments(raw, &args); err != nil {
+			return nil, err
+		}
+		return selectFields(s.session, args.Fields), nil
+	case "session-set":
+		var args map[string]any
+		if err := unmarshalArguments(raw, &args); err != nil {
+			return nil, err
+		}
+		for key, value := range args {
+			s.session[key] = value
+		}
+		return map[string]any{}, nil
+	case "session-stats":
+		return s.sessionStats(), nil
+	case "free-space":
+		var args struct {
+			Path string `json:"path"`
+		}
+		if err := unmarshalArguments(raw, &args); err != nil {
+			return nil, err
+		}
+		return map[string]any{"path": args.Path, "size-bytes": int64(512 << 30), "total_size": int64(1 << 40)}, nil
+	case "port-test":
+		return map[string]any{"port-is-open": true}, nil
+	case "torrent-get":
+		return s.torrentGet(raw)
+	case "torrent-add":
+		return s.torrentAdd(raw)
+	case "torrent-set":
+		return s.torrentSet(raw)
+	case "torrent-remove":
+		torrents, err := s.selectTorrents(raw)
+		if err != nil {
+			return nil, err
+		}
+		for _, torrent := range torrents {
+			s.removeTorrent(torrent.int64("id"))
+		}
+		return map[string]any{}, nil
+	case "torrent-start", "torrent-start-now":
+		torrents, err := s.selectTorrents(raw)
+		if err != nil {
+			return nil, err
+		}
+		for _, torrent := range torrents {
+			torrent["status"] = transmissionrpc.TorrentStatusSeed
+			if torrent.int64("leftUntilDone") > 0 {
+				torrent["status"] = transmissionrpc.TorrentStatusDownload
+			}
+			torrent["startDate"] = time.Now().Unix()
+		}
+		return map[string]any{}, nil
+	case "torrent-stop":
+		torrents, err := s.selectTorrents(raw)
+		if err != nil {
+			return nil, err
+		}
+		for _, torrent := range torrents {
+			torrent["status"] = transmissionrpc.TorrentStatusStopped
+		}
+		return map[string]any{}, nil
+	case "torrent-verify", "torrent-reannounce":
+		_, err := s.selectTorrents(raw)
+		return map[string]any{}, err
+	case "queue-move-top", "queue-move-up", "queue-move-down", "queue-move-bottom":
+		torrents, err := s.selectTorrents(raw)
+		if err != nil {
+			return nil, err
+		}
+		s.queueMove(method, torrents)
+		return map[string]any{}, nil
+	default:
+		// 与 tr 一致，未知方法返回失败结果
+		return nil, fmt.Errorf("method name not recognized")
+	}
+}
+
+// torrentGet 按 fields 返回种子字段，tr 会忽略不认识的字段
+func (s *TRServer) torrentGet(raw json.RawMessage) (any, error) {
+	var args struct {
+		Fields []string `json:"fields"`
+	}
+	if err := unmarshalArguments(raw, &args); err != nil {
+		return nil, err
+	}
+	torrents, err := s.selectTorrents(raw)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]map[string]any, 0, len(torrents))
+	for _, torrent := range torrents {
+		res = append(res, selectFields(torrent, args.Fields))
+	}
+	return map[string]any{"torrents": res}, nil
+}
+
+// torrentAdd 添加种子，磁力链接使用 btih 作为 hash，其余使用内容的 sha1
+func (s *TRServer) torrentAdd(raw json.RawMessage) (any, error) {
+	var args struct {
+		Filename    string   `json:"filename"`
+		MetaInfo    string   `json:"metainfo"`
+		DownloadDir string   `json:"download-dir"`
+		Labels      []string `json:"labels"`
+		Paused      bool     `json:"paused"`
+	}
+	if err := unmarshalArguments(raw, &args); err != nil {
+		return nil, err
+	}
+	if args.Filename == "" && args.MetaInfo == "" {
+		return nil, fmt.Errorf("no filename or metainfo specified")
+	}
+	// 模拟服务器不读取本地文件，只接受磁力链接与 URL
+	if args.MetaInfo == "" && !strings.HasPrefix(args.Filename, "magnet:") &&
+		!strings.HasPrefix(args.Filename, "http://") && !strings.HasPrefix(args.Filename, "https://") {
+		return nil, fmt.Errorf("invalid or corrupt torrent file")
+	}
+
+	hash, name := parseTRAddSource(args.Filename, args.MetaInfo)
+	if torrent := s.findTorrent(hash); torrent != nil {
+		return map[string]any{"torrent-duplicate": selectFields(torrent, []string{"id", "name", "hashString"})}, nil
+	}
+	if args.DownloadDir == "" {
+		args.DownloadDir = s.session["download-dir"].(string)
+	}
+	id := s.addTorrent(hash, name, args.DownloadDir, args.Labels, args.Paused)
+	torrent := s.findTorrent(hash)
+	// 新添加的种子还未下载
+	torrent["leftUntilDone"] = torrent["sizeWhenDone"]
+	torrent["haveValid"] = int64(0)
+	torrent["downloadedEver"] = int64(0)
+	torrent["isFinished"] = false
+	torrent["doneDate"] = int64(0)
+	torrent["uploadRatio"] = 0.0
+	torrent["percentDone"] = 0.0
+	torrent["pieces"] = ""
+	if !args.Paused {
+		torrent["status"] = transmissionrpc.TorrentStatusDownload
+	}
+	return map[string]any{"torrent-added": map[string]any{"id": id, "name": name, "hashString": hash}}, nil
+}
+
+// torrentSet 使用请求的参数覆盖种子字段
+func (s *TRServer) torrentSet(raw json.RawMessage) (any, error) {
+	torrents, err := s.selectTorrents(raw)
+	if err != nil {
+		return nil, err
+	}
+	var args map[string]any
+	if err := unmarshalArguments(raw, &args); err != nil {
+		return nil, err
+	}
+	delete(args, "ids")
+	for _, torrent := range torrents {
+		for key, value := range args {
+			switch key {
+			case "trackerList":
+				// tr 使用空行分隔 Tracker 分组，返回时去掉多余的空行
+				lines := make([]string, 0)
+				for _, line := range strings.Split(value.(string), "\n") {
+					if line != "" {
+						lines = append(lines, line)
+					}
+				}
+				torrent[key] = strings.Join(lines, "\n\n")
+			case "location":
+				torrent["downloadDir"] = value
+			default:
+				torrent[key] = value
+			}
+		}
+	}
+	return map[string]any{}, nil
+}
+
+// selectTorrents 获取请求参数 ids 指定的种子
+// ids 可以为空（所有种子）、id 或 hash 的数组，或 "recently-active"
+func (s *TRServer) selectTorrents(raw json.RawMessage) ([]trTorrent, error) {
+	var args trIDsArguments
+	if err := unmarshalArguments(raw, &args); err != nil {
+		return nil, err
+	}
+	if len(args.IDs) == 0 || string(args.IDs) == `"recently-active"` {
+		return s.torrents, nil
+	}
+	var ids []any
+	if err := json.Unmarshal(args.IDs, &ids); err != nil {
+		return nil, fmt.Errorf("invalid ids: %w", err)
+	}
+	torrents := make([]trTorrent, 0, len(ids))
+	for _, id := range ids {
+		var torrent trTorrent
+		switch value := id.(type) {
+		case float64:
+			torrent = s.findTorrentByID(int64(value))
+		case string:
+			torrent = s.findTorrent(value)
+		}
+		if torrent != nil {
+			torrents = append(torrents, torrent)
+		}
+	}
+	return torrents, nil
+}
+
+// queueMove 调整种子的队列位置
+func (s *TRServer) queueMove(method string, torrents []trTorrent) {
+	queue := make([]trTorrent, len(s.torrents))
+	copy(queue, s.torrents)
+	sort.SliceStable(queue, func(i, j int) bool {
+		return queue[i].int64("queuePosition") < queue[j].int64("queuePosition")
+	})
+	moved := make(map[int64]bool, len(torrents))
+	for _, torrent := range torrents {
+		moved[torrent.int64("id")] = true
+	}
+
+	switch method {
+	case "queue-move-top", "queue-move-bottom":
+		head := make([]trTorrent, 0, len(queue))
+		tail := make([]trTorrent, 0, len(queue))
+		for _, torrent := range queue {
+			if moved[torrent.int64("id")] == (method == "queue-move-top") {
+				head = append(head, torrent)
+			} else {
+				tail = append(tail, torrent)
+			}
+		}
+		queue = append(head, tail...)
+	case "queue-move-up":
+		for i := 1; i < len(queue); i++ {
+			if moved[queue[i].int64("id")] && !moved[queue[i-1].int64("id")] {
+				queue[i-1], queue[i] = queue[i], queue[i-1]
+			}
+		}
+	case "queue-move-down":
+		for i := len(queue) - 2; i >= 0; i-- {
+			if moved[queue[i].int64("id")] && !moved[queue[i+1].int64("id")] {
+				queue[i+1], queue[i] = queue[i], queue[i+1]
+			}
+		}
+	}
+	for position, torrent := range queue {
+		torrent["queuePosition"] = int64(position)
+	}
+}
+
+// sessionStats 汇总种子的速度与数量
+func (s *TRServer) sessionStats() map[string]any {
+	stats := make(map[string]any, len(s.stats)+5)
+	// 响应在锁外编码，复制会被 AddSessionTraffic 修改的统计
+	for key, value := range s.stats {
+		details := make(map[string]int64)
+		for k, v := range value.(map[string]int64) {
+			details[k] = v
+		}
+		stats[key] = details
+	}
+	var downloadSpeed, uploadSpeed int64
+	active, paused := 0, 0
+	for _, torrent := range s.torrents {
+		downloadSpeed = downloadSpeed + torrent.int64("rateDownload")
+		uploadSpeed = uploadSpeed + torrent.int64("rateUpload")
+		if torrent.int64("status") == int64(transmissionrpc.TorrentStatusStopped) {
+			paused = paused + 1
+		} else {
+			active = active + 1
+		}
+	}
+	stats["downloadSpeed"] = downloadSpeed
+	stats["uploadSpeed"] = uploadSpeed
+	stats["activeTorrentCount"] = active
+	stats["pausedTorrentCount"] = paused
+	stats["torrentCount"] = len(s.torrents)
+	return stats
+}
+
+// addTorrent 添加种子，默认已下载完成并在做种
+func (s *TRServer) addTorrent(hash string, name string, downloadDir string, labels []string, paused bool) int64 {
+	id := s.nextID
+	s.nextID = s.nextID + 1
+
+	const pieceSize = int64(1 << 20)
+	const pieceCount = int64(8)
+	size := pieceSize * pieceCount
+	nowTime := time.Now().Unix()
+	status := transmissionrpc.TorrentStatusSeed
+	if paused {
+		status = transmissionrpc.TorrentStatusStopped
+	}
+	if labels == nil {
+		labels = []string{}
+	}
+
+	torrent := trTorrent{
+		"id":                 id,
+		"hashString":         hash,
+		"name":               name,
+		"comment":            "",
+		"creator":            "fake",
+		"downloadDir":        downloadDir,
+		"labels":             labels,
+		"status":             status,
+		"error":              int64(0),
+		"errorString":        "",
+		"addedDate":          nowTime,
+		"activityDate":       nowTime,
+		"dateCreated":        nowTime,
+		"doneDate":           nowTime,
+		"startDate":          nowTime,
+		"editDate":           int64(0),
+		"totalSize":          size,
+		"sizeWhenDone":       size,
+		"leftUntilDone":      int64(0),
+		"haveValid":          size,
+		"haveUnchecked":      int64(0),
+		"desiredAvailable":   int64(0),
+		"corruptEver":        int64(0),
+		"downloadedEver":     size,
+		"uploadedEver":       int64(0),
+		"uploadRatio":        0.0,
+		"percentDone":        1.0,
+		"isFinished":         true,
+		"isPrivate":          false,
+		"isStalled":          false,
+		"rateDownload":       int64(0),
+		"rateUpload":         int64(0),
+		"eta":                int64(-1),
+		"queuePosition":      int64(len(s.torrents)),
+		"downloadLimit":      int64(100),
+		"downloadLimited":    false,
+		"uploadLimit":        int64(100),
+		"uploadLimited":      false,
+		"seedIdleLimit":      int64(30),
+		"seedIdleMode":       int64(0),
+		"seedRatioLimit":     2.0,
+		"seedRatioMode":      int64(0),
+		"maxConnectedPeers":  int64(50),
+		"peer-limit":         int64(50),
+		"secondsDownloading": int64(0),
+		"secondsSeeding":     int64(0),
+		"pieceCount":         pieceCount,
+		"pieceSize":          pieceSize,
+		// 所有分块均已下载
+		"pieces":      "/w==",
+		"magnetLink":  fmt.Sprintf("magnet:?xt=urn:btih:%s&dn=%s", hash, url.QueryEscape(name)),
+		"torrentFile": fmt.Sprintf("/var/lib/transmission/torrents/%s.torrent", hash),
+		"files": []transmissionrpc.TorrentFile{
+			{Name: name, Length: size, BytesCompleted: size},
+		},
+		"fileStats": []transmissionrpc.TorrentFileStat{
+			{BytesCompleted: size, Wanted: true},
+		},
+		"wanted":              []int64{1},
+		"priorities":          []int64{0},
+		"webseeds":            []string{},
+		"webseedsSendingToUs": int64(0),
+		"trackerList":         "",
+		"trackers":            []transmissionrpc.Tracker{},
+		"trackerStats":        []transmissionrpc.TrackerStats{},
+	}
+	setTRPeers(torrent, []transmissionrpc.Peer{})
+	s.torrents = append(s.torrents, torrent)
+	return id
+}
+
+// int64 获取整数字段，通过 torrent-set 与 SetTorrentFields 设置的字段可能是其他数字类型
+func (t trTorrent) int64(key string) int64 {
+	switch value := t[key].(type) {
+	case int:
+		return int64(value)
+	case int64:
+		return value
+	case float64:
+		return int64(value)
+	case transmissionrpc.TorrentStatus:
+		return int64(value)
+	}
+	return 0
+}
+
+func (s *TRServer) removeTorrent(id int64) {
+	torrents := make([]trTorrent, 0, len(s.torrents))
+	for _, torrent := range s.torrents {
+		if torrent.int64("id") != id {
+			torrents = append(torrents, torrent)
+		}
+	}
+	s.torrents = torrents
+}
+
+func (s *TRServer) findTorrent(hash string) trTorrent {
+	hash = strings.ToLower(hash)
+	for _, torrent := range s.torrents {
+		if torrent["hashString"] == hash {
+			return torrent
+		}
+	}
+	return nil
+}
+
+func (s *TRServer) findTorrentByID(id int64) trTorrent {
+	for _, torrent := range s.torrents {
+		if torrent.int64("id") == id {
+			return torrent
+		}
+	}
+	return nil
+}
+
+// newTRSessionStats 空的会话统计
+func newTRSessionStats() map[string]any {
+	details := func() map[string]int64 {
+		return map[string]int64{
+			"downloadedBytes": 0,
+			"uploadedBytes":   0,
+			"filesAdded":      0,
+			"secondsActive":   0,
+			"sessionCount":    1,
+		}
+	}
+	return map[string]any{
+		"cumulative-stats": details(),
+		"current-stats":    details(),
+	}
+}
+
+// parseTRAddSource 根据添加的种子来源生成 hash 与名称
+func parseTRAddSource(filename string, metaInfo string) (hash string, name string) {
+	if strings.HasPrefix(filename, "magnet:") {
+		if magnet, err := url.Parse(filename); err == nil {
+			query := magnet.Query()
+			name = query.Get("dn")
+			for _, xt := range query["xt"] {
+				if strings.HasPrefix(xt, "urn:btih:") {
+					hash = strings.ToLower(strings.TrimPrefix(xt, "urn:btih:"))
+				}
+			}
+		}
+	}
+	if hash == "" {
+		source := filename
+		if metaInfo != "" {
+			source = metaInfo
+		}
+		sum := sha1.Sum([]byte(source))
+		hash = hex.EncodeToString(sum[:])
+	}
+	if name == "" {
+		name = hash
+		if filename != "" {
+			name = strings.TrimSuffix(filename[strings.LastIndex(filename, "/")+1:], ".torrent")
+		}
+	}
+	return hash, name
+}
+
+// selectFields 只保留请求的字段，没有指定字段时返回全部字段
+func selectFields(values map[string]any, fields []string) map[string]any {
+	if len(fields) == 0 {
+		res := make(map[string]any, len(values))
+		for key, value := range values {
+			res[key] = value
+		}
+		return res
+	}
+	res := make(map[string]any, len(fields))
+	for _, field := range fields {
+		if value, ok := values[field]; ok {
+			res[field] = value
+		}
+	}
+	return res
+}
+
+func unmarshalArguments(raw json.RawMessage, v any) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
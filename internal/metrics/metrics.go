@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Namespace Prometheus 指标命名空间
+const Namespace = "trproxy"
+
+// Registerer 收集各层定义的指标，由 NewRegistry 注册到私有的 Registry 中
+// 不使用全局的 prometheus.DefaultRegisterer，多次创建 HTTP 服务时不会重复注册
+var Registerer prometheus.Registerer = &registerer{}
+
+// registerer 保存通过 promauto.With(Registerer) 创建的指标
+type registerer struct {
+	mutex      sync.Mutex
+	collectors []prometheus.Collector
+}
+
+// Register .
+func (r *registerer) Register(c prometheus.Collector) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.collectors = append(r.collectors, c)
+	return nil
+}
+
+// MustRegister .
+func (r *registerer) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		_ = r.Register(c)
+	}
+}
+
+// Unregister .
+func (r *registerer) Unregister(c prometheus.Collector) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i, collector := range r.collectors {
+		if collector == c {
+			r.collectors = append(r.collectors[:i], r.collectors[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// NewRegistry 创建包含所有已定义指标、Go 运行时与进程指标以及 extra 的私有 Registry
+func NewRegistry(extra ...prometheus.Collector) *prometheus.Registry {
+	r := Registerer.(*registerer)
+	r.mutex.Lock()
+	defined := append([]prometheus.Collector(nil), r.collectors...)
+	r.mutex.Unlock()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	registry.MustRegister(defined...)
+	registry.MustRegister(extra...)
+	return registry
+}
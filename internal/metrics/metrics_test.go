@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+func TestNewRegistry(t *testing.T) {
+	counter := promauto.With(Registerer).NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "test_total",
+		Help:      "test",
+	})
+	defer Registerer.Unregister(counter)
+	counter.Inc()
+
+	// 每次都创建新的 Registry，多次创建不会重复注册
+	for i := 0; i < 2; i++ {
+		families, err := NewRegistry().Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, family := range families {
+			if family.GetName() == Namespace+"_test_total" {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("registry %d does not contain %s_test_total", i, Namespace)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"transmission-proxy/internal/domain"
+	"transmission-proxy/internal/errors"
+
+	pb "transmission-proxy/api/proxy/v1"
+
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const (
+	// bansDefaultPageSize 封禁列表默认每页数量
+	bansDefaultPageSize = 100
+	// bansMaxPageSize 封禁列表每页数量上限
+	bansMaxPageSize = 1000
+)
+
+// 可以通过管理接口立即执行的任务
+const (
+	TaskTrackerRefresh = "tracker_refresh" // 更新 Tracker 列表并添加到所有种子
+	TaskStatsSave      = "stats_save"      // 保存统计数据并清理过期的流量统计
+	TaskClientRefresh  = "client_refresh"  // 刷新 tr 客户端数据
+	TaskUnbanExpired   = "unban_expired"   // 解禁已经到期的ip
+)
+
+type AdminService struct {
+	pb.UnimplementedAdminServer
+
+	appUc     *domain.AppUsecase
+	torrentUc *domain.TorrentUsecase
+}
+
+func NewAdminService(appUc *domain.AppUsecase, torrentUc *domain.TorrentUsecase) *AdminService {
+	return &AdminService{
+		appUc:     appUc,
+		torrentUc: torrentUc,
+	}
+}
+
+// ListBans 搜索并分页获取封禁列表
+func (s *AdminService) ListBans(ctx context.Context, req *pb.ListBansRequest) (*pb.ListBansReply, error) {
+	page, pageSize := int(req.GetPage()), int(req.GetPageSize())
+	if page < 0 || pageSize < 0 || pageSize > bansMaxPageSize {
+		return nil, errors.InvalidArgument("page 不能小于 0，page_size 需要在 0 到 %d 之间", bansMaxPageSize)
+	}
+	if page == 0 {
+		page = 1
+	}
+	if pageSize == 0 {
+		pageSize = bansDefaultPageSize
+	}
+
+	bannedIPs, err := s.appUc.SearchBannedIPs(ctx, req.GetQuery())
+	if err != nil {
+		return nil, err
+	}
+	start := min((page-1)*pageSize, len(bannedIPs))
+	end := min(start+pageSize, len(bannedIPs))
+
+	res := &pb.ListBansReply{
+		Bans:     make([]*pb.BannedIP, 0, end-start),
+		Total:    int32(len(bannedIPs)),
+		Page:     int32(page),
+		PageSize: int32(pageSize),
+	}
+	for _, bannedIP := range bannedIPs[start:end] {
+		res.Bans = append(res.Bans, &pb.BannedIP{
+			Ip:        bannedIP.IP,
+			BannedAt:  unixTime(bannedIP.BannedAt),
+			Source:    string(bannedIP.Source),
+			Reason:    bannedIP.Reason,
+			ExpiresAt: unixTime(bannedIP.ExpiresAt),
+		})
+	}
+	return res, nil
+}
+
+// Ban 封禁ip
+func (s *AdminService) Ban(ctx context.Context, req *pb.BanRequest) (*pb.BanReply, error) {
+	if len(req.GetIps()) == 0 {
+		return nil, errors.InvalidArgument("ips 不能为空")
+	}
+	if req.GetTtl() < 0 {
+		return nil, errors.InvalidArgument("ttl 不能小于 0")
+	}
+	err := s.appUc.BanIPWithOptions(ctx, req.GetIps(), domain.BanOptions{
+		Reason: req.GetReason(),
+		TTL:    time.Duration(req.GetTtl()) * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.BanReply{Ips: req.GetIps()}, nil
+}
+
+// Unban 解禁ip
+func (s *AdminService) Unban(ctx context.Context, req *pb.UnbanRequest) (*pb.BanReply, error) {
+	if len(req.GetIps()) == 0 {
+		return nil, errors.InvalidArgument("ips 不能为空")
+	}
+	if err := s.appUc.UnbanIP(ctx, req.GetIps()); err != nil {
+		return nil, err
+	}
+	return &pb.BanReply{Ips: req.GetIps()}, nil
+}
+
+// ClearBans 清空封禁列表
+func (s *AdminService) ClearBans(ctx context.Context, _ *emptypb.Empty) (*pb.ListBansReply, error) {
+	if err := s.appUc.ClearBanList(ctx); err != nil {
+		return nil, err
+	}
+	return s.ListBans(ctx, &pb.ListBansRequest{})
+}
+
+// GetTrackers 获取 Tracker 池与订阅列表状态
+func (s *AdminService) GetTrackers(_ context.Context, _ *emptypb.Empty) (*pb.TrackersReply, error) {
+	trackerList := s.torrentUc.GetTrackerList()
+
+	res := &pb.TrackersReply{
+		Trackers: make([]*pb.Tracker, 0, len(trackerList.ConfigTrackers)+len(trackerList.SubscriptionTrackers)),
+		Subscription: &pb.TrackerSubscription{
+			Url:          trackerList.SubscriptionURL,
+			TrackerCount: int32(len(trackerList.SubscriptionTrackers)),
+			UpdatedAt:    unixTime(trackerList.UpdateTime),
+			CheckedAt:    unixTime(trackerList.CheckTime),
+		},
+		MaxSize: int32(trackerList.MaxSize),
+	}
+	if trackerList.Err != nil {
+		res.Subscription.Error = trackerList.Err.Error()
+	}
+	for _, tracker := range trackerList.ConfigTrackers {
+		res.Trackers = append(res.Trackers, &pb.Tracker{Url: tracker, Source: "config"})
+	}
+	for _, tracker := range trackerList.SubscriptionTrackers {
+		res.Trackers = append(res.Trackers, &pb.Tracker{Url: tracker, Source: "subscription"})
+	}
+	return res, nil
+}
+
+// GetStats 获取上传下载统计
+func (s *AdminService) GetStats(_ context.Context, _ *emptypb.Empty) (*pb.StatsReply, error) {
+	statistics := s.torrentUc.GetStatistics()
+	return &pb.StatsReply{
+		TotalDownloaded:        statistics.TotalDownloaded,
+		TotalUploaded:          statistics.TotalUploaded,
+		TotalDownloadedSession: statistics.TotalDownloadedSession,
+		TotalUploadedSession:   statistics.TotalUploadedSession,
+		DownloadSpeed:          statistics.DownloadSpeed,
+		UploadSpeed:            statistics.UploadSpeed,
+	}, nil
+}
+
+// ResetStats 清零上传下载总量
+func (s *AdminService) ResetStats(ctx context.Context, req *emptypb.Empty) (*pb.StatsReply, error) {
+	if err := s.torrentUc.ResetStatistics(); err != nil {
+		return nil, err
+	}
+	return s.GetStats(ctx, req)
+}
+
+// GetStatsHistory 获取全局的历史流量统计
+func (s *AdminService) GetStatsHistory(ctx context.Context, req *pb.GetStatsHistoryRequest) (*pb.GetStatsHistoryReply, error) {
+	resolution := domain.TrafficResolution(req.GetResolution())
+	if resolution == "" {
+		resolution = domain.TrafficResolutionDay
+	}
+	from, to := trafficRange(resolution, req.From, req.To)
+	points, err := s.torrentUc.GetTraffic(ctx, domain.TrafficScopeGlobal, "", resolution, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.GetStatsHistoryReply{
+		Resolution: string(resolution),
+		Points:     make([]*pb.StatsPoint, 0, len(points)),
+	}
+	for _, point := range points {
+		res.Points = append(res.Points, &pb.StatsPoint{
+			Time:       point.Time.Unix(),
+			Downloaded: point.Downloaded,
+			Uploaded:   point.Uploaded,
+		})
+	}
+	return res, nil
+}
+
+// RunTask 立即执行定时任务并等待完成
+func (s *AdminService) RunTask(ctx context.Context, req *pb.RunTaskRequest) (*pb.RunTaskReply, error) {
+	var task func() error
+	switch req.GetName() {
+	case TaskTrackerRefresh:
+		task = func() error { return s.torrentUc.RefreshTrackers(ctx) }
+	case TaskStatsSave:
+		task = func() error {
+			if err := s.torrentUc.SaveStatistics(); err != nil {
+				return err
+			}
+			return s.torrentUc.PruneTraffic(ctx)
+		}
+	case TaskClientRefresh:
+		task = func() error { return s.torrentUc.UpClientData(ctx) }
+	case TaskUnbanExpired:
+		task = func() error {
+			_, err := s.appUc.UnbanExpired(ctx)
+			return err
+		}
+	default:
+		return nil, errors.InvalidArgument("未知的任务: %s", req.GetName())
+	}
+
+	startTime := time.Now()
+	if err := task(); err != nil {
+		return nil, err
+	}
+	return &pb.RunTaskReply{
+		Name:      req.GetName(),
+		StartedAt: startTime.Unix(),
+		ElapsedMs: time.Since(startTime).Milliseconds(),
+	}, nil
+}
+
+// unixTime 转换为 Unix 时间戳，零值转换为 0
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+	stdjson "encoding/json"
+	"sort"
 	"strings"
 
 	pb "transmission-proxy/api/v2"
@@ -10,6 +12,8 @@ import (
 	"github.com/go-kratos/kratos/v2/encoding"
 	"github.com/go-kratos/kratos/v2/transport"
 	col "github.com/noxiouz/golang-generics-util/collection"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
@@ -78,14 +82,17 @@ func NewAppService(uc *domain.AppUsecase) *AppService {
 	}
 }
 
-func (s *AppService) Ping(_ context.Context, _ *emptypb.Empty) (*wrapperspb.StringValue, error) {
+func (s *AppService) Ping(ctx context.Context, _ *emptypb.Empty) (*wrapperspb.StringValue, error) {
+	if tr, ok := transport.FromServerContext(ctx); ok {
+		tr.ReplyHeader().Set("Content-Type", "text/html; charset=UTF-8")
+	}
 	return &wrapperspb.StringValue{Value: html}, nil
 }
 
 // GetVersion 获取应用程序版本
 func (s *AppService) GetVersion(ctx context.Context, _ *emptypb.Empty) (*wrapperspb.StringValue, error) {
 	if tr, ok := transport.FromServerContext(ctx); ok {
-		tr.ReplyHeader().Set("Content-Type", "text/plain")
+		tr.ReplyHeader().Set("Content-Type", "text/plain; charset=UTF-8")
 	}
 	return &wrapperspb.StringValue{Value: "v4.6.6.10"}, nil
 }
@@ -93,7 +100,7 @@ func (s *AppService) GetVersion(ctx context.Context, _ *emptypb.Empty) (*wrapper
 // GetWebAPIVersion 获取WebAPI版本
 func (s *AppService) GetWebAPIVersion(ctx context.Context, _ *emptypb.Empty) (*wrapperspb.StringValue, error) {
 	if tr, ok := transport.FromServerContext(ctx); ok {
-		tr.ReplyHeader().Set("Content-Type", "text/plain")
+		tr.ReplyHeader().Set("Content-Type", "text/plain; charset=UTF-8")
 	}
 	return &wrapperspb.StringValue{Value: "2.8.3"}, nil
 }
@@ -111,10 +118,7 @@ func (s *AppService) GetPreferences(ctx context.Context, _ *emptypb.Empty) (*pb.
 func (s *AppService) SetPreferences(ctx context.Context, req *pb.SetPreferencesRequest) (
 	*emptypb.Empty, error) {
 
-	pre := domain.Preferences{
-		ListenPort: col.None[int32](),
-		BanList:    col.None[[]string](),
-	}
+	pre := domain.NewPreferences()
 
 	json := req.GetJson()
 	codec := encoding.GetCodec("json")
@@ -123,19 +127,104 @@ func (s *AppService) SetPreferences(ctx context.Context, req *pb.SetPreferencesR
 	if err != nil {
 		return &emptypb.Empty{}, err
 	}
+	pre.Unsupported = unsupportedPreferences([]byte(json), &v)
 
-	if v.GetListenPort() != 0 {
+	if v.ListenPort != nil {
 		pre.ListenPort = col.Some(v.GetListenPort())
 	}
+	if v.Banned_IPs != nil {
+		pre.BanList = col.Some(strings.Split(v.GetBanned_IPs(), "\n"))
+	}
 
-	ips := strings.Split(v.GetBanned_IPs(), "\n")
-	if len(ips) > 0 {
-		pre.BanList = col.Some(ips)
+	if v.StartPausedEnabled != nil {
+		pre.StartPausedEnabled = col.Some(v.GetStartPausedEnabled())
+	}
+	if v.IncompleteFilesExt != nil {
+		pre.IncompleteFilesExt = col.Some(v.GetIncompleteFilesExt())
+	}
+	if v.SavePath != nil {
+		pre.SavePath = col.Some(v.GetSavePath())
+	}
+	if v.TempPathEnabled != nil {
+		pre.TempPathEnabled = col.Some(v.GetTempPathEnabled())
+	}
+	if v.TempPath != nil {
+		pre.TempPath = col.Some(v.GetTempPath())
+	}
+	if v.AutorunEnabled != nil {
+		pre.AutorunEnabled = col.Some(v.GetAutorunEnabled())
+	}
+	if v.AutorunProgram != nil {
+		pre.AutorunProgram = col.Some(v.GetAutorunProgram())
+	}
+	if v.QueueingEnabled != nil {
+		pre.QueueingEnabled = col.Some(v.GetQueueingEnabled())
+	}
+	if v.MaxActiveDownloads != nil {
+		pre.MaxActiveDownloads = col.Some(v.GetMaxActiveDownloads())
+	}
+	if v.MaxActiveUploads != nil {
+		pre.MaxActiveUploads = col.Some(v.GetMaxActiveUploads())
+	}
+	if v.MaxRatioEnabled != nil {
+		pre.MaxRatioEnabled = col.Some(v.GetMaxRatioEnabled())
+	}
+	if v.MaxRatio != nil {
+		pre.MaxRatio = col.Some(v.GetMaxRatio())
+	}
+	if v.Upnp != nil {
+		pre.Upnp = col.Some(v.GetUpnp())
+	}
+	if v.RandomPort != nil {
+		pre.RandomPort = col.Some(v.GetRandomPort())
+	}
+	if v.DlLimit != nil {
+		pre.DlLimit = col.Some(v.GetDlLimit())
+	}
+	if v.UpLimit != nil {
+		pre.UpLimit = col.Some(v.GetUpLimit())
+	}
+	if v.MaxConnec != nil {
+		pre.MaxConnec = col.Some(v.GetMaxConnec())
+	}
+	if v.MaxConnecPerTorrent != nil {
+		pre.MaxConnecPerTorrent = col.Some(v.GetMaxConnecPerTorrent())
+	}
+	if v.DontCountSlowTorrents != nil {
+		pre.DontCountSlowTorrents = col.Some(v.GetDontCountSlowTorrents())
+	}
+	if v.SlowTorrentDlRateThreshold != nil {
+		pre.SlowTorrentDlRateThreshold = col.Some(v.GetSlowTorrentDlRateThreshold())
+	}
+	if v.SlowTorrentUlRateThreshold != nil {
+		pre.SlowTorrentUlRateThreshold = col.Some(v.GetSlowTorrentUlRateThreshold())
+	}
+	if v.SlowTorrentInactiveTimer != nil {
+		pre.SlowTorrentInactiveTimer = col.Some(v.GetSlowTorrentInactiveTimer())
 	}
 
-	err = s.uc.SetPreferences(ctx, &pre)
+	err = s.uc.SetPreferences(ctx, pre)
 	if err != nil {
 		return &emptypb.Empty{}, err
 	}
 	return &emptypb.Empty{}, nil
 }
+
+// unsupportedPreferences 找出请求中没有对应字段的首选项
+func unsupportedPreferences(data []byte, v proto.Message) []string {
+	raw := make(map[string]stdjson.RawMessage)
+	if err := stdjson.Unmarshal(data, &raw); err != nil {
+		return nil
+	}
+
+	fields := v.ProtoReflect().Descriptor().Fields()
+	unsupported := make([]string, 0)
+	for key := range raw {
+		if fields.ByName(protoreflect.Name(key)) != nil || fields.ByJSONName(key) != nil {
+			continue
+		}
+		unsupported = append(unsupported, key)
+	}
+	sort.Strings(unsupported)
+	return unsupported
+}
@@ -4,8 +4,10 @@ import "github.com/google/wire"
 
 // ProviderSet is service providers.
 var ProviderSet = wire.NewSet(
+	NewAdminService,
 	NewAppService,
 	NewAuthService,
+	NewStatisticsService,
 	NewSyncService,
 	NewTorrentService,
 	NewTransferService,
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"transmission-proxy/internal/domain"
+
+	pb "transmission-proxy/api/v2"
+)
+
+// trafficDefaultPoints 没有指定开始时间时返回的统计区间数量
+const trafficDefaultPoints = 30
+
+type StatisticsService struct {
+	pb.UnimplementedStatisticsServer
+
+	uc *domain.TorrentUsecase
+}
+
+func NewStatisticsService(uc *domain.TorrentUsecase) *StatisticsService {
+	return &StatisticsService{
+		uc: uc,
+	}
+}
+
+// GetTraffic 获取流量时间序列
+func (s *StatisticsService) GetTraffic(ctx context.Context, req *pb.GetTrafficRequest) (*pb.GetTrafficResponse, error) {
+	scope := domain.TrafficScope(req.GetScope())
+	resolution := domain.TrafficResolution(req.GetResolution())
+
+	from, to := trafficRange(resolution, req.From, req.To)
+	points, err := s.uc.GetTraffic(ctx, scope, req.GetKey(), resolution, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.GetTrafficResponse{
+		Scope:      req.GetScope(),
+		Key:        req.GetKey(),
+		Resolution: req.GetResolution(),
+		Points:     make([]*pb.TrafficPoint, 0, len(points)),
+	}
+	for _, point := range points {
+		ratio := float64(-1)
+		if point.Downloaded > 0 {
+			ratio = float64(point.Uploaded) / float64(point.Downloaded)
+		}
+		res.Points = append(res.Points, &pb.TrafficPoint{
+			Time:       point.Time.Unix(),
+			Downloaded: point.Downloaded,
+			Uploaded:   point.Uploaded,
+			Ratio:      ratio,
+		})
+	}
+	return res, nil
+}
+
+// trafficRange 流量统计的时间范围，没有指定开始时间时返回 trafficDefaultPoints 个统计区间
+func trafficRange(resolution domain.TrafficResolution, fromUnix, toUnix *int64) (from time.Time, to time.Time) {
+	to = time.Now()
+	if toUnix != nil {
+		to = time.Unix(*toUnix, 0)
+	}
+	if fromUnix != nil {
+		return time.Unix(*fromUnix, 0), to
+	}
+	switch resolution {
+	case domain.TrafficResolutionMonth:
+		from = to.AddDate(0, -trafficDefaultPoints+1, 0)
+	case domain.TrafficResolutionDay:
+		from = to.AddDate(0, 0, -trafficDefaultPoints+1)
+	default:
+		from = to.Add(-(trafficDefaultPoints - 1) * time.Hour)
+	}
+	return from, to
+}
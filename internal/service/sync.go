@@ -2,12 +2,16 @@ package service
 
 import (
 	"context"
-	"fmt"
+	"net"
+	"strconv"
 	"strings"
+	"sync"
 
 	"transmission-proxy/internal/domain"
 
 	col "github.com/noxiouz/golang-generics-util/collection"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	pb "transmission-proxy/api/v2"
 )
 
@@ -15,11 +19,14 @@ type SyncService struct {
 	pb.UnimplementedSyncServer
 
 	uc *domain.TorrentUsecase
+
+	peerSync *peerSync
 }
 
 func NewSyncService(uc *domain.TorrentUsecase) *SyncService {
 	return &SyncService{
-		uc: uc,
+		uc:       uc,
+		peerSync: newPeerSync(),
 	}
 }
 
@@ -44,6 +51,9 @@ func (s *SyncService) GetMainData(ctx context.Context, req *pb.GetMainDataReques
 	}
 
 	statistics := s.uc.GetStatistics()
+	serverState := s.uc.GetServerState()
+	alltimeDl := statistics.TotalDownloaded + statistics.TotalDownloadedSession
+	alltimeUl := statistics.TotalUploaded + statistics.TotalUploadedSession
 
 	return &pb.GetMainDataResponse{
 		Rid:               req.Rid,
@@ -55,23 +65,23 @@ func (s *SyncService) GetMainData(ctx context.Context, req *pb.GetMainDataReques
 		Tags:              make([]string, 0),
 		TagsRemoved:       make([]string, 0),
 		ServerState: &pb.ServerState{
-			AlltimeDl:            statistics.TotalDownloaded + statistics.TotalDownloadedSession,
-			AlltimeUl:            statistics.TotalUploaded + statistics.TotalUploadedSession,
+			AlltimeDl:            alltimeDl,
+			AlltimeUl:            alltimeUl,
 			AverageTimeQueue:     0,
-			ConnectionStatus:     "",
-			DhtNodes:             0,
+			ConnectionStatus:     serverState.ConnectionStatus,
+			DhtNodes:             int32(serverState.DHTNodes),
 			DlInfoData:           statistics.TotalDownloadedSession,
 			DlInfoSpeed:          statistics.DownloadSpeed,
 			DlRateLimit:          0,
-			FreeSpaceOnDisk:      0,
-			GlobalRatio:          "",
+			FreeSpaceOnDisk:      serverState.FreeSpaceOnDisk,
+			GlobalRatio:          globalRatio(alltimeDl, alltimeUl),
 			QueuedIoJobs:         0,
 			Queueing:             false,
-			ReadCacheHits:        "",
-			ReadCacheOverload:    "",
+			ReadCacheHits:        "0",
+			ReadCacheOverload:    "0",
 			RefreshInterval:      0,
 			TotalBuffersSize:     0,
-			TotalPeerConnections: 0,
+			TotalPeerConnections: int32(serverState.TotalPeerConnections),
 			TotalQueuedSize:      0,
 			TotalWastedSession:   0,
 			UpInfoData:           statistics.TotalUploadedSession,
@@ -79,11 +89,23 @@ func (s *SyncService) GetMainData(ctx context.Context, req *pb.GetMainDataReques
 			UpRateLimit:          0,
 			UseAltSpeedLimits:    false,
 			UseSubcategories:     false,
-			WriteCacheOverload:   "",
+			WriteCacheOverload:   "0",
 		},
 	}, nil
 }
 
+// globalRatio 与 qb 一致的全局分享比，保留两位小数，大于等于 100 时为 "∞"
+func globalRatio(downloaded int64, uploaded int64) string {
+	if downloaded <= 0 || uploaded <= 0 {
+		return "0.00"
+	}
+	ratio := float64(uploaded) / float64(downloaded)
+	if ratio >= 100 {
+		return "∞"
+	}
+	return strconv.FormatFloat(ratio, 'f', 2, 64)
+}
+
 // GetTorrentPeers 获取种子 peer 数据
 func (s *SyncService) GetTorrentPeers(ctx context.Context, req *pb.GetTorrentPeersRequest) (
 	res *pb.GetTorrentPeersResponse, err error) {
@@ -92,58 +114,202 @@ func (s *SyncService) GetTorrentPeers(ctx context.Context, req *pb.GetTorrentPee
 	if err != nil {
 		return
 	}
+
+	peerInfos := make(map[string]*pb.PeerInfo)
+	if peers.HasValue() {
+		peerInfos = make(map[string]*pb.PeerInfo, len(peers.Value()))
+		for key, peer := range peers.Value() {
+			peerInfos[genAddr(&key)] = peerToQBPeerInfo(peer)
+		}
+	}
+
+	rid, fullUpdate, changed, removed := s.peerSync.update(req.GetHash(), req.GetRid(), peerInfos)
+	// 删除已经不存在的种子的快照
+	s.peerSync.prune(s.uc.HasTorrent)
 	res = &pb.GetTorrentPeersResponse{
-		FullUpdate: true, // 是否为完整更新 TR:noFunc
-		ShowFlags:  true, // 是否显示标志 TR:noFunc
-		Rid:        req.GetRid(),
-		Peers:      make(map[string]*pb.PeerInfo),
+		FullUpdate:   fullUpdate,
+		ShowFlags:    s.uc.CanResolvePeerCountries(ctx), // 与 qb 一致，能解析国家时显示国旗
+		Rid:          rid,
+		Peers:        changed,
+		PeersRemoved: removed,
 	}
+	return
+}
 
-	if !peers.HasValue() {
-		return
+// 构建key，key: <ip:port>，IPv6 为 <[ip]:port>
+var genAddr = func(key *domain.PeerKey) string {
+	return net.JoinHostPort(key.IP, strconv.Itoa(int(key.Port)))
+}
+
+// peerSyncHistorySize 每个种子保留的 Peer 快照数量
+const peerSyncHistorySize = 8
+
+// peerSync 记录每个种子返回过的 Peer 快照，用于根据 rid 计算增量更新
+type peerSync struct {
+	mutex sync.Mutex
+	rid   int32
+	// torrents key: <Hash>
+	torrents map[string]*torrentPeerSync
+}
+
+// torrentPeerSync 单个种子的 Peer 快照
+type torrentPeerSync struct {
+	// snapshots key: <rid>
+	snapshots map[int32]map[string]*pb.PeerInfo
+	// rids 按时间顺序排列的快照 rid
+	rids []int32
+}
+
+func newPeerSync() *peerSync {
+	return &peerSync{
+		torrents: make(map[string]*torrentPeerSync),
 	}
+}
+
+// update 保存本次的 Peer 快照，返回新的 rid 以及与请求 rid 对应快照的差异
+// 请求 rid 为 0 或快照已经过期时返回完整数据
+func (p *peerSync) update(hash string, reqRid int32, peers map[string]*pb.PeerInfo) (
+	rid int32, fullUpdate bool, changed map[string]*pb.PeerInfo, removed []string) {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.rid = p.rid + 1
+	rid = p.rid
 
-	res.Peers = make(map[string]*pb.PeerInfo, len(peers.Value()))
-	for key, peer := range peers.Value() {
-		res.Peers[genAddr(&key)] = peerToQBPeerInfo(peer)
+	torrent, ok := p.torrents[hash]
+	if !ok {
+		torrent = &torrentPeerSync{
+			snapshots: make(map[int32]map[string]*pb.PeerInfo, peerSyncHistorySize),
+			rids:      make([]int32, 0, peerSyncHistorySize),
+		}
+		p.torrents[hash] = torrent
+	}
+
+	previous, ok := torrent.snapshots[reqRid]
+	if reqRid == 0 || !ok {
+		fullUpdate = true
+		changed = peers
+		removed = make([]string, 0)
+	} else {
+		changed = make(map[string]*pb.PeerInfo)
+		for addr, peer := range peers {
+			previousPeer, exist := previous[addr]
+			if !exist {
+				changed[addr] = peer
+				continue
+			}
+			diff := diffPeerInfo(previousPeer, peer)
+			if diff != nil {
+				changed[addr] = diff
+			}
+		}
+		removed = make([]string, 0)
+		for addr := range previous {
+			if _, exist := peers[addr]; !exist {
+				removed = append(removed, addr)
+			}
+		}
 	}
 
+	torrent.snapshots[rid] = peers
+	torrent.rids = append(torrent.rids, rid)
+	if len(torrent.rids) > peerSyncHistorySize {
+		delete(torrent.snapshots, torrent.rids[0])
+		torrent.rids = torrent.rids[1:]
+	}
 	return
 }
 
-// 构建key，key: <ip:port>
-var genAddr = func(key *domain.PeerKey) string {
-	return fmt.Sprintf("%s%d", key.IP, key.Port)
+// prune 删除 exists 返回 false 的种子的快照
+func (p *peerSync) prune(exists func(hash string) bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for hash := range p.torrents {
+		if !exists(hash) {
+			delete(p.torrents, hash)
+		}
+	}
 }
 
-func peerToQBPeerInfo(peer *domain.Peer) *pb.PeerInfo {
-	runes := []rune(peer.Flags)
-	var b strings.Builder
-	for i, r := range runes {
-		if i > 0 {
-			b.WriteString(" ")
+// diffPeerInfo 返回只包含发生变化字段的 PeerInfo，没有变化时返回 nil
+func diffPeerInfo(previous *pb.PeerInfo, current *pb.PeerInfo) *pb.PeerInfo {
+	diff := &pb.PeerInfo{}
+	previousMsg := previous.ProtoReflect()
+	diffMsg := diff.ProtoReflect()
+	changed := false
+	current.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if !previousMsg.Has(fd) || !previousMsg.Get(fd).Equal(v) {
+			diffMsg.Set(fd, v)
+			changed = true
 		}
-		b.WriteRune(r)
+		return true
+	})
+	if !changed {
+		return nil
 	}
-	flags := b.String()
+	return diff
+}
+
+// qbPeerFlag qb 的 Peer 标志及描述
+type qbPeerFlag struct {
+	Flag string
+	Desc string
+}
+
+// trPeerFlags tr 的 Peer 标志对应的 qb 标志
+var trPeerFlags = map[rune]qbPeerFlag{
+	'O': {"O", "Optimistic unchoke"},
+	'D': {"D", "Interested (local) and unchoked (peer)"},
+	'd': {"d", "Interested (local) and choked (peer)"},
+	'U': {"U", "Interested (peer) and unchoked (local)"},
+	'u': {"u", "Interested (peer) and choked (local)"},
+	'K': {"K", "Not interested (local) and unchoked (peer)"},
+	'?': {"?", "Not interested (peer) and unchoked (local)"},
+	'E': {"E", "Encrypted traffic"},
+	'H': {"H", "Peer from DHT"},
+	'X': {"X", "Peer from PEX"},
+	'I': {"I", "Incoming connection"},
+	'T': {"P", "μTP"},
+}
+
+// trFlagsToQBFlags 将 tr 的 Peer 标志转换为 qb 的标志和标志描述
+func trFlagsToQBFlags(trFlags string) (flags string, flagsDesc string) {
+	flagList := make([]string, 0, len(trFlags))
+	descList := make([]string, 0, len(trFlags))
+	for _, r := range trFlags {
+		flag, ok := trPeerFlags[r]
+		if !ok {
+			continue
+		}
+		flagList = append(flagList, flag.Flag)
+		descList = append(descList, flag.Flag+" = "+flag.Desc)
+	}
+	return strings.Join(flagList, " "), strings.Join(descList, "\n")
+}
+
+func peerToQBPeerInfo(peer *domain.Peer) *pb.PeerInfo {
+	flags, flagsDesc := trFlagsToQBFlags(peer.Flags)
 
 	res := &pb.PeerInfo{
-		Client:       peer.ClientName,        // 客户端信息
-		Connection:   peer.Connection,        // 连接类型
-		Country:      "",                     // 国家 TR:noFunc
-		CountryCode:  "",                     // 国家代码 TR:noFunc
-		DlSpeed:      peer.DownloadSpeed,     // 下载速度（字节/秒）
-		Downloaded:   peer.Downloaded,        // 已下载数据量（字节） TR:noFunc 代理统计
-		Files:        "",                     // 文件信息 TR:noFunc
-		Flags:        flags,                  // 标志信息
-		FlagsDesc:    "",                     // 标志描述 TR:noFunc
-		Ip:           peer.IP,                // IP 地址
-		PeerIdClient: peer.ClientName,        // 客户端的 Peer ID TR:noFunc 代理统计
-		Port:         int32(peer.Port),       // 端口号
-		Progress:     float64(peer.Progress), // 进度（0-100%）
-		Relevance:    0,                      // 相关性 TR:noFunc
-		UpSpeed:      peer.UploadSpeed,       // 上传速度（字节/秒）
-		Uploaded:     peer.Uploaded,          // 已上传数据量（字节） TR:noFunc 代理统计
+		Client:       proto.String(peer.ClientName),                   // 客户端信息
+		Connection:   proto.String(peer.Connection),                   // 连接类型
+		Country:      proto.String(peer.Country),                      // 国家 代理统计
+		CountryCode:  proto.String(strings.ToLower(peer.CountryCode)), // 国家代码（qB 使用小写） 代理统计
+		DlSpeed:      proto.Int64(peer.DownloadSpeed),                 // 下载速度（字节/秒）
+		Downloaded:   proto.Int64(peer.Downloaded),                    // 已下载数据量（字节） TR:noFunc 代理统计
+		Files:        proto.String(strings.Join(peer.Files, "\n")),    // 文件信息 代理统计
+		Flags:        proto.String(flags),                             // 标志信息
+		FlagsDesc:    proto.String(flagsDesc),                         // 标志描述
+		Ip:           proto.String(peer.IP),                           // IP 地址
+		PeerIdClient: proto.String(peer.PeerIdClient),                 // 客户端的 Peer ID 前缀 代理统计
+		Port:         proto.Int32(int32(peer.Port)),                   // 端口号
+		Progress:     proto.Float64(float64(peer.Progress)),           // 进度（0-100%）
+		Relevance:    proto.Float64(float64(peer.Relevance)),          // 相关性 代理统计
+		UpSpeed:      proto.Int64(peer.UploadSpeed),                   // 上传速度（字节/秒）
+		Uploaded:     proto.Int64(peer.Uploaded),                      // 已上传数据量（字节） TR:noFunc 代理统计
+		Estimated:    proto.Bool(peer.Estimated),                      // 流量是否为估算值 代理扩展
 		// 没有验证Uploaded是否可以计算 -> int64(float64(*trt.TotalSize) * peer.Progress)
 	}
 
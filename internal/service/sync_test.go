@@ -0,0 +1,64 @@
+package service
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	pb "transmission-proxy/api/v2"
+)
+
+func TestPeerSyncUpdate(t *testing.T) {
+	p := newPeerSync()
+	peers := map[string]*pb.PeerInfo{
+		"203.0.113.7:6881": {Ip: proto.String("203.0.113.7"), DlSpeed: proto.Int64(1024)},
+		"203.0.113.8:6881": {Ip: proto.String("203.0.113.8"), DlSpeed: proto.Int64(0)},
+	}
+	rid, fullUpdate, changed, _ := p.update("a", 0, peers)
+	if !fullUpdate || len(changed) != 2 {
+		t.Fatalf("first update fullUpdate = %v, changed = %d, want full update with 2 peers", fullUpdate, len(changed))
+	}
+
+	next := map[string]*pb.PeerInfo{
+		"203.0.113.7:6881": {Ip: proto.String("203.0.113.7"), DlSpeed: proto.Int64(2048)},
+	}
+	_, fullUpdate, changed, removed := p.update("a", rid, next)
+	if fullUpdate {
+		t.Fatal("fullUpdate = true, want incremental update")
+	}
+	diff, ok := changed["203.0.113.7:6881"]
+	if !ok || diff.Ip != nil || diff.GetDlSpeed() != 2048 {
+		t.Errorf("changed = %v, want only dl_speed of 203.0.113.7:6881", changed)
+	}
+	if len(removed) != 1 || removed[0] != "203.0.113.8:6881" {
+		t.Errorf("removed = %v, want [203.0.113.8:6881]", removed)
+	}
+}
+
+func TestPeerSyncHistorySize(t *testing.T) {
+	p := newPeerSync()
+	first, _, _, _ := p.update("a", 0, map[string]*pb.PeerInfo{})
+	for i := 0; i < peerSyncHistorySize; i++ {
+		p.update("a", 0, map[string]*pb.PeerInfo{})
+	}
+	if _, fullUpdate, _, _ := p.update("a", first, map[string]*pb.PeerInfo{}); !fullUpdate {
+		t.Error("fullUpdate = false for an expired rid, want true")
+	}
+	if n := len(p.torrents["a"].snapshots); n != peerSyncHistorySize {
+		t.Errorf("snapshots = %d, want %d", n, peerSyncHistorySize)
+	}
+}
+
+func TestPeerSyncPrune(t *testing.T) {
+	p := newPeerSync()
+	p.update("a", 0, map[string]*pb.PeerInfo{})
+	p.update("b", 0, map[string]*pb.PeerInfo{})
+	p.prune(func(hash string) bool {
+		return hash == "a"
+	})
+	if _, ok := p.torrents["a"]; !ok {
+		t.Error("snapshots of existing torrent a were removed")
+	}
+	if _, ok := p.torrents["b"]; ok {
+		t.Error("snapshots of removed torrent b were kept")
+	}
+}
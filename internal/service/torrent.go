@@ -19,6 +19,7 @@ import (
 	col "github.com/noxiouz/golang-generics-util/collection"
 	"google.golang.org/genproto/googleapis/api/httpbody"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 type TorrentService struct {
@@ -34,8 +35,8 @@ func NewTorrentService(uc *domain.TorrentUsecase) *TorrentService {
 }
 
 // Add 添加种子
-func (s *TorrentService) Add(ctx context.Context, req *pb.AddRequest) (res *emptypb.Empty, err error) {
-	res = &emptypb.Empty{}
+func (s *TorrentService) Add(ctx context.Context, req *pb.AddRequest) (res *wrapperspb.StringValue, err error) {
+	res = &wrapperspb.StringValue{Value: "Fails."}
 	urlsStr := strings.Split(req.Urls, "\n")
 	urls := make([]string, 0, len(urlsStr))
 
@@ -108,8 +109,15 @@ func (s *TorrentService) Add(ctx context.Context, req *pb.AddRequest) (res *empt
 		torrents = append(torrents, torrent)
 	}
 
-	err = s.uc.Add(ctx, torrents)
-	return
+	added, err := s.uc.Add(ctx, torrents)
+	if err != nil {
+		return nil, err
+	}
+	// 与 qb 一致，没有成功添加任何种子时返回 Fails.
+	if added > 0 {
+		res.Value = "Ok."
+	}
+	return res, nil
 }
 
 func (s *TorrentService) cacheTorrent(ctx context.Context, fileHeader *multipart.FileHeader) (
@@ -156,20 +164,29 @@ func (s *TorrentService) GetInfo(ctx context.Context, req *pb.GetInfoRequest) (r
 		return
 	}
 
+	// 与 qb 一致，没有种子时返回空数组
 	if !qbTorrents.HasValue() {
+		return &httpbody.HttpBody{Data: []byte("[]")}, nil
+	}
+
+	data, err := marshalArray(qbTorrents.Value())
+	if err != nil {
 		return
 	}
+	return &httpbody.HttpBody{Data: data}, nil
+}
 
+// marshalArray 编码为json数组
+func marshalArray[T any](values []T) ([]byte, error) {
 	// 获取编解码器并编码json, qb需要返回一个纯数组`[{xxx},{xxx},...]`
 	// 直接编码[]any导致json默认值被省略，需要手动拼接
-	data := make([]byte, 0, len(qbTorrents.Value())*2048)
+	data := make([]byte, 0, len(values)*2048)
 	data = append(data, '[')
 	codec := encoding.GetCodec("json")
-	for _, torrent := range qbTorrents.Value() {
-		var json []byte
-		json, err = codec.Marshal(torrent)
+	for _, value := range values {
+		json, err := codec.Marshal(value)
 		if err != nil {
-			return
+			return nil, err
 		}
 		data = append(data, json...)
 		data = append(data, ',')
@@ -179,8 +196,7 @@ func (s *TorrentService) GetInfo(ctx context.Context, req *pb.GetInfoRequest) (r
 	} else {
 		data = append(data, ']')
 	}
-
-	return &httpbody.HttpBody{Data: data}, nil
+	return data, nil
 }
 
 // GetProperties 获取种子属性属性
@@ -198,6 +214,119 @@ func (s *TorrentService) GetProperties(ctx context.Context, req *pb.GetPropertie
 	return qbt.Value(), nil
 }
 
+// GetWebseeds 获取种子 Web 种子
+func (s *TorrentService) GetWebseeds(ctx context.Context, req *pb.GetWebseedsRequest) (*httpbody.HttpBody, error) {
+	webSeeds, err := s.uc.GetWebSeeds(ctx, req.GetHash())
+	if err != nil {
+		return nil, err
+	}
+	if !webSeeds.HasValue() {
+		return nil, errors.ResourceNotExist("DownloadTorrent hash was not found")
+	}
+
+	qbWebSeeds := make([]*pb.WebSeed, 0, len(webSeeds.Value()))
+	for _, webSeed := range webSeeds.Value() {
+		qbWebSeeds = append(qbWebSeeds, &pb.WebSeed{Url: webSeed})
+	}
+	data, err := marshalArray(qbWebSeeds)
+	if err != nil {
+		return nil, err
+	}
+	return &httpbody.HttpBody{Data: data}, nil
+}
+
+// GetPieceStates 获取种子片段状态
+func (s *TorrentService) GetPieceStates(ctx context.Context, req *pb.GetPieceStatesRequest) (*httpbody.HttpBody, error) {
+	states, err := s.uc.GetPieceStates(ctx, req.GetHash())
+	if err != nil {
+		return nil, err
+	}
+	if !states.HasValue() {
+		return nil, errors.ResourceNotExist("DownloadTorrent hash was not found")
+	}
+
+	data, err := marshalArray(states.Value())
+	if err != nil {
+		return nil, err
+	}
+	return &httpbody.HttpBody{Data: data}, nil
+}
+
+// GetPieceHashes 获取种子片段哈希值
+func (s *TorrentService) GetPieceHashes(ctx context.Context, req *pb.GetPieceHashesRequest) (*httpbody.HttpBody, error) {
+	hashes, err := s.uc.GetPieceHashes(ctx, req.GetHash())
+	if err != nil {
+		return nil, err
+	}
+	if !hashes.HasValue() {
+		return nil, errors.ResourceNotExist("DownloadTorrent hash was not found")
+	}
+
+	data, err := marshalArray(hashes.Value())
+	if err != nil {
+		return nil, err
+	}
+	return &httpbody.HttpBody{Data: data}, nil
+}
+
+// IncreasePrio 提高种子队列优先级
+func (s *TorrentService) IncreasePrio(ctx context.Context, req *pb.HashesRequest) (*emptypb.Empty, error) {
+	err := s.uc.IncreasePriority(ctx, splitHashes(req.GetHashes()))
+	if err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// DecreasePrio 降低种子队列优先级
+func (s *TorrentService) DecreasePrio(ctx context.Context, req *pb.HashesRequest) (*emptypb.Empty, error) {
+	err := s.uc.DecreasePriority(ctx, splitHashes(req.GetHashes()))
+	if err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// TopPrio 种子队列优先级设为最高
+func (s *TorrentService) TopPrio(ctx context.Context, req *pb.HashesRequest) (*emptypb.Empty, error) {
+	err := s.uc.TopPriority(ctx, splitHashes(req.GetHashes()))
+	if err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// BottomPrio 种子队列优先级设为最低
+func (s *TorrentService) BottomPrio(ctx context.Context, req *pb.HashesRequest) (*emptypb.Empty, error) {
+	err := s.uc.BottomPriority(ctx, splitHashes(req.GetHashes()))
+	if err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// SetForceStart 设置强制启动
+func (s *TorrentService) SetForceStart(ctx context.Context, req *pb.SetForceStartRequest) (*emptypb.Empty, error) {
+	value := strings.TrimSpace(req.GetValue()) == "true"
+	err := s.uc.SetForceStart(ctx, splitHashes(req.GetHashes()), value)
+	if err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// 拆分 `|` 分隔的种子哈希
+func splitHashes(hashes string) []string {
+	res := make([]string, 0)
+	for _, hash := range strings.Split(hashes, "|") {
+		hash = strings.TrimSpace(hash)
+		if hash != "" {
+			res = append(res, hash)
+		}
+	}
+	return res
+}
+
 // Download 下载
 // 用于给tr提供临时下载使用
 func (s *TorrentService) Download(ctx context.Context, req *pb.DownloadRequest) (res *emptypb.Empty, err error) {
@@ -0,0 +1,98 @@
+package trigger
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+
+	adminv1 "transmission-proxy/api/proxy/v1"
+	"transmission-proxy/conf"
+	"transmission-proxy/internal/errors"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/go-kratos/kratos/v2/transport/http"
+	"google.golang.org/grpc/peer"
+)
+
+// adminOperationPrefix 管理接口的 operation 前缀，HTTP 与 gRPC 相同
+var adminOperationPrefix = "/" + adminv1.Admin_ServiceDesc.ServiceName + "/"
+
+// AdminToken 管理接口的访问令牌，配置热更新后立即生效
+type AdminToken struct {
+	token atomic.Pointer[string]
+}
+
+// NewAdminToken 读取 trigger.admin.token 并订阅配置变化
+func NewAdminToken(bootstrap *conf.Bootstrap, reloader *conf.Reloader) *AdminToken {
+	t := &AdminToken{}
+	t.reload(nil, bootstrap)
+	reloader.Subscribe(t.reload)
+	return t
+}
+
+// Load 获取当前的访问令牌
+func (t *AdminToken) Load() string {
+	return *t.token.Load()
+}
+
+func (t *AdminToken) reload(_, current *conf.Bootstrap) {
+	token := current.GetTrigger().GetAdmin().GetToken()
+	t.token.Store(&token)
+}
+
+// AdminAuth 只对管理接口生效的认证中间件
+func AdminAuth(token *AdminToken) middleware.Middleware {
+	return selector.Server(adminAuth(token)).Prefix(adminOperationPrefix).Build()
+}
+
+// adminAuth 设置了 token 时校验 Authorization: Bearer <token>，否则只允许本机访问
+// 每次请求读取当前的访问令牌
+func adminAuth(adminToken *AdminToken) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			token := adminToken.Load()
+			if token == "" {
+				if !isLoopback(remoteAddr(ctx)) {
+					return nil, errors.Forbidden("没有设置 trigger.admin.token，管理接口只允许本机访问")
+				}
+				return handler(ctx, req)
+			}
+
+			authorization := ""
+			if tr, ok := transport.FromServerContext(ctx); ok {
+				authorization = tr.RequestHeader().Get("Authorization")
+			}
+			bearer, found := strings.CutPrefix(authorization, "Bearer ")
+			if !found || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+				return nil, errors.Unauthorized("无效的访问令牌")
+			}
+			return handler(ctx, req)
+		}
+	}
+}
+
+// remoteAddr 获取 HTTP 或 gRPC 请求的客户端地址
+func remoteAddr(ctx context.Context) string {
+	if req, ok := http.RequestFromServerContext(ctx); ok {
+		return req.RemoteAddr
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// isLoopback 判断客户端地址是否为本机
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.Unmap().IsLoopback()
+}
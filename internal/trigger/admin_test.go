@@ -0,0 +1,146 @@
+package trigger
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"transmission-proxy/conf"
+	"transmission-proxy/internal/errors"
+
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+// adminPath 代理自身管理接口的路径
+func adminPath(path string) string {
+	return "/api/proxy/v1" + path
+}
+
+// TestAdmin 检查代理自身管理接口的认证、封禁元数据、分页、Tracker 池、历史统计与任务
+func TestAdmin(t *testing.T) {
+	e := newTestEnv(t)
+	c := e.client(t)
+
+	// 没有访问令牌
+	if res := c.request(http.MethodGet, adminPath("/bans"), nil, nil); res.status != http.StatusUnauthorized {
+		t.Fatalf("没有访问令牌时返回 HTTP %d, 期望 %d", res.status, http.StatusUnauthorized)
+	}
+	c.token = adminToken
+
+	const ip = "198.51.100.9"
+	c.ok(c.postJSON(adminPath("/bans/ban"),
+		map[string]any{"ips": []string{ip, "198.51.100.20"}, "reason": "e2e check", "ttl": 3600}))
+	var bans map[string]any
+	c.getJSON(adminPath("/bans"), url.Values{"query": {"198.51.100.0/24"}}, &bans)
+	requireEqual(t, "bans", bans, "total", float64(2))
+	list, _ := bans["bans"].([]any)
+	if len(list) != 2 {
+		t.Fatalf("网段 198.51.100.0/24 的封禁列表 %v, 期望 2 个ip", list)
+	}
+	ban, _ := list[0].(map[string]any)
+	requireKeys(t, "bans[0]", ban, "ip", "banned_at", "source", "reason", "expires_at")
+	for key, want := range map[string]any{"ip": ip, "source": "admin", "reason": "e2e check"} {
+		requireEqual(t, "bans[0]", ban, key, want)
+	}
+	bannedAt, _ := ban["banned_at"].(float64)
+	expiresAt, _ := ban["expires_at"].(float64)
+	if diff := expiresAt - bannedAt; bannedAt <= 0 || diff < 3599 || diff > 3601 {
+		t.Errorf("banned_at = %v, expires_at = %v, 期望相差 3600 秒", bannedAt, expiresAt)
+	}
+
+	// 按封禁原因搜索与分页
+	c.getJSON(adminPath("/bans"), url.Values{"query": {"E2E"}, "page": {"2"}, "page_size": {"1"}}, &bans)
+	list, _ = bans["bans"].([]any)
+	if len(list) != 1 || bans["total"] != float64(2) {
+		t.Fatalf("第 2 页的封禁列表 %v, 期望 total 为 2 且有 1 个ip", bans)
+	}
+	if ban, _ := list[0].(map[string]any); ban["ip"] != "198.51.100.20" {
+		t.Errorf("第 2 页的ip为 %v, 期望 198.51.100.20", ban["ip"])
+	}
+
+	c.ok(c.postJSON(adminPath("/bans/unban"), map[string]any{"ips": []string{ip}}))
+	if slices.Contains(e.banIP.BannedIPs(), ip) {
+		t.Errorf("解禁后封禁列表中仍有 %s", ip)
+	}
+	if res := c.postJSON(adminPath("/bans/ban"), map[string]any{"ips": []string{}}); res.status != http.StatusBadRequest {
+		t.Errorf("ips 为空时封禁返回 HTTP %d, 期望 %d", res.status, http.StatusBadRequest)
+	}
+
+	// 到期后由任务解禁
+	c.ok(c.postJSON(adminPath("/bans/ban"), map[string]any{"ips": []string{"198.51.100.20"}, "ttl": 1}))
+	time.Sleep(1100 * time.Millisecond)
+	c.ok(c.postJSON(adminPath("/tasks/unban_expired"), map[string]any{}))
+	if slices.Contains(e.banIP.BannedIPs(), "198.51.100.20") {
+		t.Error("封禁到期后封禁列表中仍有 198.51.100.20")
+	}
+	if res := c.postJSON(adminPath("/tasks/unknown"), map[string]any{}); res.status != http.StatusBadRequest {
+		t.Errorf("执行未知的任务返回 HTTP %d, 期望 %d", res.status, http.StatusBadRequest)
+	}
+
+	var trackers map[string]any
+	c.getJSON(adminPath("/trackers"), nil, &trackers)
+	requireKeys(t, "trackers", trackers, "trackers", "subscription", "max_size")
+	subscription, _ := trackers["subscription"].(map[string]any)
+	requireKeys(t, "trackers.subscription", subscription, "url", "tracker_count", "updated_at",
+		"checked_at", "error")
+
+	var stats map[string]any
+	c.getJSON(adminPath("/stats"), nil, &stats)
+	requireKeys(t, "stats", stats, "total_downloaded", "total_uploaded", "total_downloaded_session",
+		"total_uploaded_session", "download_speed", "upload_speed")
+	var history map[string]any
+	c.getJSON(adminPath("/stats/history"), url.Values{"resolution": {"hour"}}, &history)
+	requireEqual(t, "stats/history", history, "resolution", "hour")
+	requireKeys(t, "stats/history", history, "points")
+}
+
+// TestAdminAuthLoopback 没有设置访问令牌时管理接口只允许本机访问
+func TestAdminAuthLoopback(t *testing.T) {
+	token := &AdminToken{}
+	token.reload(nil, &conf.Bootstrap{})
+	handler := adminAuth(token)(func(context.Context, interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+	for addr, allowed := range map[string]bool{
+		"127.0.0.1:51234":       true,
+		"[::1]:51234":           true,
+		"[::ffff:127.0.0.1]:80": true,
+		"192.0.2.1:51234":       false,
+		"[2001:db8::1]:51234":   false,
+	} {
+		tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: tcpAddr})
+		_, err = handler(ctx, nil)
+		if allowed && err != nil {
+			t.Errorf("%s 访问管理接口返回 %v, 期望允许", addr, err)
+		}
+		if !allowed && !errors.IsForbidden(err) {
+			t.Errorf("%s 访问管理接口返回 %v, 期望 403", addr, err)
+		}
+	}
+}
+
+// TestAdminTokenReload 配置热更新后新的访问令牌立即生效
+func TestAdminTokenReload(t *testing.T) {
+	e := newTestEnv(t)
+	c := e.client(t)
+	c.token = adminToken
+	c.get(adminPath("/bans"), nil)
+
+	current := proto.Clone(e.bootstrap).(*conf.Bootstrap)
+	current.GetTrigger().GetAdmin().Token = "reloaded"
+	e.adminToken.reload(e.bootstrap, current)
+	if res := c.request(http.MethodGet, adminPath("/bans"), nil, nil); res.status != http.StatusUnauthorized {
+		t.Errorf("使用旧的访问令牌返回 HTTP %d, 期望 %d", res.status, http.StatusUnauthorized)
+	}
+	c.token = "reloaded"
+	c.get(adminPath("/bans"), nil)
+}
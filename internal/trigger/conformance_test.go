@@ -0,0 +1,412 @@
+package trigger
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// update 使用代理当前的响应更新 testdata/qb 中的 .golden 文件
+//
+//	go test ./internal/trigger -run TestConformance -update
+var update = flag.Bool("update", false, "update golden files")
+
+// fixturesDir 每个接口的期望响应
+// <name>.json 为按 qb 4.6/5.0 的 WebAPI 文档编写的请求与期望响应，检查字段名与类型
+// <name>.golden 为代理的完整响应，使用 -update 重新生成
+const fixturesDir = "testdata/qb"
+
+// volatileValue 替换 .golden 中每次请求都会变化的值
+const volatileValue = "<volatile>"
+
+// fixture 一个接口的期望响应
+type fixture struct {
+	Description string `json:"description"`
+	Request     struct {
+		Method string            `json:"method"`
+		Path   string            `json:"path"`
+		Query  map[string]string `json:"query"`
+		Form   map[string]string `json:"form"`
+	} `json:"request"`
+
+	Status int `json:"status"`
+	// ContentType 为空时不检查
+	ContentType string `json:"content_type"`
+	// Text 纯文本响应体
+	Text *string `json:"text"`
+	// TextPattern 纯文本响应体需要匹配的正则表达式
+	TextPattern string `json:"text_pattern"`
+	// JSON 期望的 JSON 响应，检查字段名与类型
+	JSON json.RawMessage `json:"json"`
+	// Exact 需要与期望值完全一致的字段（JSON Pointer）
+	Exact []string `json:"exact"`
+	// Extra 允许代理额外返回的字段（JSON Pointer，* 匹配任意键）
+	Extra []string `json:"extra"`
+	// Partial 只检查期望中存在的字段
+	Partial bool `json:"partial"`
+	// Volatile 每次请求都会变化的字段（JSON Pointer，* 匹配任意键），在 .golden 中替换为 <volatile>
+	Volatile []string `json:"volatile"`
+}
+
+// TestConformance_AppVersion GET /api/v2/app/version
+func TestConformance_AppVersion(t *testing.T) {
+	runConformance(t, "00_app_version")
+}
+
+// TestConformance_AppWebAPIVersion GET /api/v2/app/webapiVersion
+func TestConformance_AppWebAPIVersion(t *testing.T) {
+	runConformance(t, "01_app_webapiVersion")
+}
+
+// TestConformance_AuthLogin POST /api/v2/auth/login
+func TestConformance_AuthLogin(t *testing.T) {
+	runConformance(t, "02_auth_login")
+}
+
+// TestConformance_AppPreferences GET /api/v2/app/preferences
+func TestConformance_AppPreferences(t *testing.T) {
+	runConformance(t, "03_app_preferences")
+}
+
+// TestConformance_TorrentsInfo GET /api/v2/torrents/info
+func TestConformance_TorrentsInfo(t *testing.T) {
+	runConformance(t, "10_torrents_info")
+}
+
+// TestConformance_TorrentsInfoEmpty GET /api/v2/torrents/info 没有匹配的种子
+func TestConformance_TorrentsInfoEmpty(t *testing.T) {
+	runConformance(t, "11_torrents_info_empty")
+}
+
+// TestConformance_TorrentsProperties GET /api/v2/torrents/properties
+func TestConformance_TorrentsProperties(t *testing.T) {
+	runConformance(t, "12_torrents_properties")
+}
+
+// TestConformance_TorrentsPropertiesNotFound GET /api/v2/torrents/properties 种子不存在
+func TestConformance_TorrentsPropertiesNotFound(t *testing.T) {
+	runConformance(t, "13_torrents_properties_not_found")
+}
+
+// TestConformance_TorrentsAdd POST /api/v2/torrents/add
+func TestConformance_TorrentsAdd(t *testing.T) {
+	runConformance(t, "20_torrents_add")
+}
+
+// TestConformance_TorrentsAddFails POST /api/v2/torrents/add 添加失败
+func TestConformance_TorrentsAddFails(t *testing.T) {
+	runConformance(t, "21_torrents_add_fails")
+}
+
+// TestConformance_TransferBanPeers POST /api/v2/transfer/banPeers
+func TestConformance_TransferBanPeers(t *testing.T) {
+	runConformance(t, "30_transfer_banPeers")
+}
+
+// TestConformance_SyncTorrentPeers GET /api/v2/sync/torrentPeers
+func TestConformance_SyncTorrentPeers(t *testing.T) {
+	runConformance(t, "40_sync_torrentPeers")
+}
+
+// TestConformance_SyncMainData GET /api/v2/sync/maindata
+func TestConformance_SyncMainData(t *testing.T) {
+	runConformance(t, "50_sync_maindata")
+}
+
+// runConformance 使用新的代理与 tr 请求 name 对应的接口，与 qb 的期望响应以及 .golden 比较
+func runConformance(t *testing.T, name string) {
+	data, err := os.ReadFile(filepath.Join(fixturesDir, name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fixture{}
+	if err := json.Unmarshal(data, f); err != nil {
+		t.Fatalf("%s.json: %v", name, err)
+	}
+
+	c := newTestEnv(t).client(t)
+	c.login()
+	res := requestFixture(c, f)
+	for _, problem := range compareFixture(f, res) {
+		t.Errorf("与 qb 不一致: %s", problem)
+	}
+
+	got, err := goldenResponse(f, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goldenPath := filepath.Join(fixturesDir, name+".golden")
+	if *update {
+		if err := os.WriteFile(goldenPath, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("%v，使用 -update 生成", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("响应与 %s 不一致，确认改动后使用 -update 更新\n--- got\n%s\n--- want\n%s", goldenPath, got, want)
+	}
+}
+
+// goldenResponse .golden 中保存的响应：状态码、Content-Type 与格式化后的响应体
+func goldenResponse(f *fixture, res *response) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "HTTP %d\nContent-Type: %s\n\n", res.status, res.contentType)
+	if !strings.HasPrefix(res.contentType, "application/json") {
+		b.Write(res.body)
+		return b.Bytes(), nil
+	}
+	body, err := decodeJSON(res.body)
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range f.Volatile {
+		body = replaceVolatile(body, "", pattern)
+	}
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(body); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// replaceVolatile 将 JSON Pointer 匹配 pattern 的值替换为 <volatile>
+func replaceVolatile(value any, pointer string, pattern string) any {
+	if matchPointer(pattern, pointer) {
+		return volatileValue
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = replaceVolatile(item, pointer+"/"+key, pattern)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = replaceVolatile(item, pointer+"/"+strconv.Itoa(i), pattern)
+		}
+	}
+	return value
+}
+
+// requestFixture 发送期望响应中的请求
+func requestFixture(c *testClient, f *fixture) *response {
+	c.t.Helper()
+	query := url.Values{}
+	for key, value := range f.Request.Query {
+		query.Set(key, value)
+	}
+	var form url.Values
+	if f.Request.Form != nil {
+		form = url.Values{}
+		for key, value := range f.Request.Form {
+			form.Set(key, value)
+		}
+	}
+	return c.request(f.Request.Method, f.Request.Path, query, form)
+}
+
+// compareFixture 比较响应与按 qb 文档编写的期望响应
+func compareFixture(f *fixture, res *response) []string {
+	problems := make([]string, 0)
+	if res.status != f.Status {
+		problems = append(problems, fmt.Sprintf("状态码 %d, 期望 %d", res.status, f.Status))
+	}
+	if f.ContentType != "" && res.contentType != f.ContentType {
+		problems = append(problems, fmt.Sprintf("Content-Type %q, 期望 %q", res.contentType, f.ContentType))
+	}
+	if f.Text != nil && string(res.body) != *f.Text {
+		problems = append(problems, fmt.Sprintf("响应 %q, 期望 %q", res.body, *f.Text))
+	}
+	if f.TextPattern != "" && !regexp.MustCompile(f.TextPattern).Match(res.body) {
+		problems = append(problems, fmt.Sprintf("响应 %q 不匹配 %s", res.body, f.TextPattern))
+	}
+	if len(f.JSON) == 0 {
+		return problems
+	}
+
+	want, err := decodeJSON(f.JSON)
+	if err != nil {
+		return append(problems, fmt.Sprintf("期望响应: %v", err))
+	}
+	got, err := decodeJSON(res.body)
+	if err != nil {
+		return append(problems, fmt.Sprintf("响应不是 JSON: %v", err))
+	}
+	cmp := &comparer{fixture: f}
+	cmp.compare("", want, got)
+	for _, pointer := range f.Exact {
+		wantValue, ok := lookup(want, pointer)
+		if !ok {
+			cmp.problem(pointer, "期望响应中没有该字段")
+			continue
+		}
+		if gotValue, _ := lookup(got, pointer); !reflect.DeepEqual(gotValue, wantValue) {
+			cmp.problem(pointer, fmt.Sprintf("值为 %v, 期望 %v", gotValue, wantValue))
+		}
+	}
+	return append(problems, cmp.problems...)
+}
+
+func decodeJSON(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	err := decoder.Decode(&value)
+	return value, err
+}
+
+// comparer 比较 JSON 的字段名与类型
+type comparer struct {
+	fixture  *fixture
+	problems []string
+}
+
+func (c *comparer) problem(pointer string, message string) {
+	if pointer == "" {
+		pointer = "/"
+	}
+	c.problems = append(c.problems, fmt.Sprintf("%s %s", pointer, message))
+}
+
+func (c *comparer) compare(pointer string, want any, got any) {
+	if jsonKind(want) != jsonKind(got) {
+		c.problem(pointer, fmt.Sprintf("类型为 %s, 期望 %s", jsonKind(got), jsonKind(want)))
+		return
+	}
+	switch want := want.(type) {
+	case json.Number:
+		// qb 的整数字段不能返回小数
+		if isInteger(want) && !isInteger(got.(json.Number)) {
+			c.problem(pointer, fmt.Sprintf("值 %s 不是整数", got))
+		}
+	case []any:
+		got := got.([]any)
+		if len(want) == 0 {
+			if len(got) != 0 && !c.fixture.Partial {
+				c.problem(pointer, fmt.Sprintf("有 %d 个元素, 期望为空", len(got)))
+			}
+			return
+		}
+		if len(got) != len(want) {
+			c.problem(pointer, fmt.Sprintf("有 %d 个元素, 期望 %d 个", len(got), len(want)))
+		}
+		for i := 0; i < len(got) && i < len(want); i++ {
+			c.compare(pointer+"/"+strconv.Itoa(i), want[i], got[i])
+		}
+	case map[string]any:
+		got := got.(map[string]any)
+		for _, key := range sortedKeys(want) {
+			value, ok := got[key]
+			if !ok {
+				c.problem(pointer+"/"+key, "缺少字段")
+				continue
+			}
+			c.compare(pointer+"/"+key, want[key], value)
+		}
+		if c.fixture.Partial {
+			return
+		}
+		for _, key := range sortedKeys(got) {
+			if _, ok := want[key]; !ok && !c.allowExtra(pointer+"/"+key) {
+				c.problem(pointer+"/"+key, "qb 没有该字段")
+			}
+		}
+	}
+}
+
+func (c *comparer) allowExtra(pointer string) bool {
+	for _, pattern := range c.fixture.Extra {
+		if matchPointer(pattern, pointer) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPointer 比较 JSON Pointer，模式中的 * 匹配任意一段
+func matchPointer(pattern string, pointer string) bool {
+	patternParts := strings.Split(pattern, "/")
+	pointerParts := strings.Split(pointer, "/")
+	if len(patternParts) != len(pointerParts) {
+		return false
+	}
+	for i := range patternParts {
+		if patternParts[i] != "*" && patternParts[i] != pointerParts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup 获取 JSON Pointer 指向的值
+func lookup(value any, pointer string) (any, bool) {
+	if pointer == "" {
+		return value, true
+	}
+	for _, part := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		switch v := value.(type) {
+		case map[string]any:
+			next, ok := v[part]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []any:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func jsonKind(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func isInteger(number json.Number) bool {
+	return !strings.ContainsAny(number.String(), ".eE")
+}
+
+func sortedKeys(object map[string]any) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
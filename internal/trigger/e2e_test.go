@@ -0,0 +1,455 @@
+package trigger
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"transmission-proxy/internal/domain"
+
+	"github.com/hekmon/transmissionrpc/v3"
+)
+
+// TestPBH 按 PeerBanHelper 的方式登录、获取活动种子与 Peer 并封禁 Peer
+func TestPBH(t *testing.T) {
+	e := newTestEnv(t)
+	c := e.client(t)
+	c.login()
+
+	if version := c.get("/api/v2/app/version", nil); !strings.Contains(string(version), "v") {
+		t.Errorf("版本响应 %q", version)
+	}
+	c.get("/api/v2/app/webapiVersion", nil)
+
+	torrents := c.torrents(url.Values{"filter": {"all"}})
+	torrent, ok := torrents[seedHash]
+	if !ok {
+		t.Fatalf("种子列表中没有 %s", seedHash)
+	}
+	requireKeys(t, "torrents/info", torrent, "hash", "name", "size", "total_size", "progress",
+		"state", "save_path", "upspeed", "dlspeed", "uploaded", "downloaded", "num_complete",
+		"num_incomplete", "added_on", "ratio", "category", "tags", "magnet_uri")
+	requireEqual(t, "torrents/info", torrent, "name", seedName)
+	requireEqual(t, "torrents/info", torrent, "progress", 1.0)
+
+	var properties map[string]any
+	c.getJSON("/api/v2/torrents/properties", url.Values{"hash": {seedHash}}, &properties)
+	requireKeys(t, "torrents/properties", properties, "save_path", "piece_size", "pieces_have",
+		"pieces_num", "total_size")
+
+	var peers struct {
+		FullUpdate bool                      `json:"full_update"`
+		Peers      map[string]map[string]any `json:"peers"`
+	}
+	c.getJSON("/api/v2/sync/torrentPeers", url.Values{"hash": {seedHash}, "rid": {"0"}}, &peers)
+	if len(peers.Peers) != 2 {
+		t.Fatalf("sync/torrentPeers 返回 %d 个 Peer, 期望 2", len(peers.Peers))
+	}
+	peer, ok := peers.Peers["203.0.113.7:6881"]
+	if !ok {
+		t.Fatal("sync/torrentPeers 中没有 203.0.113.7:6881")
+	}
+	requireKeys(t, "sync/torrentPeers", peer, "ip", "port", "client", "progress", "dl_speed",
+		"up_speed", "flags", "connection")
+	requireEqual(t, "sync/torrentPeers", peer, "client", "qBittorrent 4.6.5")
+
+	c.postForm("/api/v2/transfer/banPeers", url.Values{"peers": {"203.0.113.7:6881|[2001:db8::1]:51413"}})
+	banned := e.banIP.BannedIPs()
+	for _, ip := range []string{"203.0.113.7", "2001:db8::1"} {
+		if !slices.Contains(banned, ip) {
+			t.Errorf("封禁列表 %v 中没有 %s", banned, ip)
+		}
+	}
+}
+
+// addBangumi 按 AutoBangumi 的方式添加带分类与保存路径的种子
+func addBangumi(t *testing.T, e *testEnv, c *testClient) {
+	t.Helper()
+	magnet := fmt.Sprintf("magnet:?xt=urn:btih:%s&dn=%s", bangumiHash, url.QueryEscape(bangumiName))
+	c.postForm("/api/v2/torrents/add", url.Values{
+		"urls":     {magnet},
+		"savepath": {bangumiSavePath},
+		"category": {bangumiCategory},
+		"paused":   {"false"},
+	})
+	if err := e.uc.UpClientData(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestPeerEstimated 新连接的 Peer 的流量为估算值，连续两次轮询都获取到后不再是估算值
+func TestPeerEstimated(t *testing.T) {
+	e := newTestEnv(t)
+	c := e.client(t)
+	c.login()
+
+	estimated := func() any {
+		var peers struct {
+			Peers map[string]map[string]any `json:"peers"`
+		}
+		c.getJSON("/api/v2/sync/torrentPeers", url.Values{"hash": {seedHash}, "rid": {"0"}}, &peers)
+		peer, ok := peers.Peers["203.0.113.7:6881"]
+		if !ok {
+			t.Fatal("sync/torrentPeers 中没有 203.0.113.7:6881")
+		}
+		return peer["estimated"]
+	}
+	if got := estimated(); got != true {
+		t.Errorf("首次轮询后 estimated = %v, 期望 true", got)
+	}
+	if err := e.uc.UpClientData(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := estimated(); got != false {
+		t.Errorf("再次轮询后 estimated = %v, 期望 false", got)
+	}
+}
+
+// TestAutoBangumi 按 AutoBangumi 的方式添加带分类与保存路径的种子并按分类获取
+func TestAutoBangumi(t *testing.T) {
+	e := newTestEnv(t)
+	c := e.client(t)
+	c.login()
+
+	var preferences map[string]any
+	c.getJSON("/api/v2/app/preferences", nil, &preferences)
+	requireEqual(t, "app/preferences", preferences, "save_path", "/downloads")
+
+	addBangumi(t, e, c)
+	// 分类映射到 anime 后端
+	if calls := e.anime.Calls("torrent-add"); calls != 1 {
+		t.Errorf("anime 后端 torrent-add 调用 %d 次, 期望 1", calls)
+	}
+	if calls := e.tr.Calls("torrent-add"); calls != 0 {
+		t.Errorf("main 后端 torrent-add 调用 %d 次, 期望 0", calls)
+	}
+	added, ok := e.anime.Torrent(bangumiHash)
+	if !ok {
+		t.Fatalf("tr 中没有添加的种子 %s", bangumiHash)
+	}
+	if added["downloadDir"] != bangumiSavePath {
+		t.Errorf("tr 种子保存路径 %v, 期望 %s", added["downloadDir"], bangumiSavePath)
+	}
+	if labels, _ := added["labels"].([]string); !slices.Contains(labels, animeLabel) {
+		t.Errorf("tr 种子标签 %v 中没有后端标签 %s", added["labels"], animeLabel)
+	}
+
+	torrents := c.torrents(url.Values{"category": {bangumiCategory}})
+	if len(torrents) != 1 {
+		t.Fatalf("分类 %s 中有 %d 个种子, 期望 1", bangumiCategory, len(torrents))
+	}
+	torrent, ok := torrents[bangumiHash]
+	if !ok {
+		t.Fatalf("分类 %s 中没有 %s", bangumiCategory, bangumiHash)
+	}
+	requireEqual(t, "torrents/info", torrent, "name", bangumiName)
+	requireEqual(t, "torrents/info", torrent, "category", bangumiCategory)
+	requireEqual(t, "torrents/info", torrent, "save_path", bangumiSavePath)
+
+	torrents = c.torrents(url.Values{"hashes": {bangumiHash}})
+	if _, ok := torrents[bangumiHash]; !ok || len(torrents) != 1 {
+		t.Errorf("按 hash 获取到 %d 个种子", len(torrents))
+	}
+}
+
+// TestMainData 检查 sync/maindata 的服务器状态
+func TestMainData(t *testing.T) {
+	e := newTestEnv(t)
+	c := e.client(t)
+	var mainData struct {
+		Torrents    map[string]map[string]any `json:"torrents"`
+		ServerState map[string]any            `json:"server_state"`
+	}
+	c.getJSON("/api/v2/sync/maindata", url.Values{"rid": {"0"}}, &mainData)
+	if _, ok := mainData.Torrents[seedHash]; !ok {
+		t.Errorf("sync/maindata 中没有 %s", seedHash)
+	}
+	requireKeys(t, "sync/maindata server_state", mainData.ServerState, "dl_info_speed",
+		"up_info_speed", "free_space_on_disk", "connection_status", "total_peer_connections")
+}
+
+// TestBackends 检查多个 tr 后端的种子列表合并、按 hash 发送命令与健康检查
+func TestBackends(t *testing.T) {
+	e := newTestEnv(t)
+	c := e.client(t)
+	c.login()
+	addBangumi(t, e, c)
+
+	torrents := c.torrents(nil)
+	for _, hash := range []string{seedHash, animeSeedHash, bangumiHash} {
+		if _, ok := torrents[hash]; !ok {
+			t.Errorf("种子列表中没有 %s", hash)
+		}
+	}
+
+	// 两个后端中的种子 ID 相同，命令需要发送到种子所在的后端
+	c.postForm("/api/v2/torrents/topPrio", url.Values{"hashes": {animeSeedHash}})
+	if calls := e.anime.Calls("queue-move-top"); calls != 1 {
+		t.Errorf("anime 后端 queue-move-top 调用 %d 次, 期望 1", calls)
+	}
+	if calls := e.tr.Calls("queue-move-top"); calls != 0 {
+		t.Errorf("main 后端 queue-move-top 调用 %d 次, 期望 0", calls)
+	}
+
+	var health struct {
+		Transmission struct {
+			Reachable bool `json:"reachable"`
+			Backends  []struct {
+				Name      string `json:"name"`
+				Reachable bool   `json:"reachable"`
+			} `json:"backends"`
+		} `json:"transmission"`
+	}
+	c.getJSON("/healthz", nil, &health)
+	if !health.Transmission.Reachable || len(health.Transmission.Backends) != 2 {
+		t.Fatalf("健康检查的 tr 后端状态 %+v", health.Transmission)
+	}
+	for _, backend := range health.Transmission.Backends {
+		if !backend.Reachable {
+			t.Errorf("tr 后端 %s 不可访问", backend.Name)
+		}
+	}
+}
+
+// TestReconnect 检查 tr 后端无法访问时的重试、部分后端的数据、连接状态与重新连接
+func TestReconnect(t *testing.T) {
+	e := newTestEnv(t)
+	c := e.client(t)
+	c.login()
+	ctx := context.Background()
+
+	// 一个后端无法访问时使用其余后端的数据
+	e.anime.SetUnavailable(true)
+	calls := e.anime.Calls("session-stats")
+	if err := e.uc.UpClientData(ctx); err != nil {
+		t.Fatalf("anime 后端无法访问时刷新数据失败: %v", err)
+	}
+	// 无法访问时返回 503，不会计入调用次数；后端已被标记为未连接，后续请求不会发送到 tr
+	e.tr.AddTorrent(bangumiHash, bangumiName)
+	if err := e.uc.UpClientData(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if calls := e.anime.Calls("session-stats") - calls; calls != 0 {
+		t.Errorf("anime 后端 session-stats 调用 %d 次, 期望 0", calls)
+	}
+	if status := e.uc.GetServerState().ConnectionStatus; status == domain.ConnectionStatusDisconnected {
+		t.Errorf("只有 anime 后端无法访问时 connection_status = %s", status)
+	}
+	// 无法访问的后端保留上次的种子数据
+	torrents := c.torrents(nil)
+	for _, hash := range []string{seedHash, bangumiHash, animeSeedHash} {
+		if _, ok := torrents[hash]; !ok {
+			t.Errorf("anime 后端无法访问时种子列表中没有 %s", hash)
+		}
+	}
+	health := e.uc.GetHealth(ctx)
+	if health.TRReachable || !health.Degraded() {
+		t.Errorf("anime 后端无法访问时健康检查 reachable = %v, degraded = %v", health.TRReachable,
+			health.Degraded())
+	}
+	for _, backend := range health.Backends {
+		if reachable := backend.Name != "anime"; backend.Reachable != reachable {
+			t.Errorf("tr 后端 %s reachable = %v, 期望 %v", backend.Name, backend.Reachable, reachable)
+		}
+	}
+
+	// 添加种子只选择已连接的后端，分类对应的 anime 后端无法访问时添加到 main 后端
+	magnet := fmt.Sprintf("magnet:?xt=urn:btih:%s&dn=%s", strings.Repeat("ab", 20), "Show - 02")
+	c.postForm("/api/v2/torrents/add", url.Values{"urls": {magnet}, "category": {bangumiCategory}})
+	if calls := e.tr.Calls("torrent-add"); calls != 1 {
+		t.Errorf("main 后端 torrent-add 调用 %d 次, 期望 1", calls)
+	}
+
+	// 所有后端都无法访问时刷新失败，保留上次的数据，请求连续失败多次后标记为未连接
+	e.tr.SetUnavailable(true)
+	for range 3 {
+		if err := e.uc.UpClientData(ctx); err == nil {
+			t.Fatal("所有后端都无法访问时刷新数据没有失败")
+		}
+	}
+	if status := e.uc.GetServerState().ConnectionStatus; status != domain.ConnectionStatusDisconnected {
+		t.Errorf("connection_status = %s, 期望 %s", status, domain.ConnectionStatusDisconnected)
+	}
+	if _, ok := c.torrents(url.Values{"hashes": {animeSeedHash}})[animeSeedHash]; !ok {
+		t.Errorf("无法访问 tr 后种子列表中没有 %s", animeSeedHash)
+	}
+	if e.uc.GetHealth(ctx).Ready() {
+		t.Error("所有后端都无法访问时健康检查为可以提供服务")
+	}
+
+	// 重连任务按退避时间重新连接
+	e.tr.SetUnavailable(false)
+	e.anime.SetUnavailable(false)
+	deadline := time.Now().Add(10 * time.Second)
+	for !e.uc.GetHealth(ctx).TRReachable {
+		if time.Now().After(deadline) {
+			t.Fatal("tr 后端没有重新连接")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err := e.uc.UpClientData(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status := e.uc.GetServerState().ConnectionStatus; status == domain.ConnectionStatusDisconnected {
+		t.Errorf("重新连接后 connection_status = %s", status)
+	}
+}
+
+// TestStaleBackendPeers 后端无法访问时保留的种子不再累加 Peer 的流量，Peer 标记为不活跃
+func TestStaleBackendPeers(t *testing.T) {
+	e := newTestEnv(t)
+	ctx := context.Background()
+	key := domain.PeerKey{Hash: animeSeedHash, IP: "198.51.100.9", Port: 6881}
+	e.anime.SetPeers(animeSeedHash, []transmissionrpc.Peer{
+		{Address: key.IP, Port: int64(key.Port), ClientName: "qBittorrent 4.6.5", RateToClient: 1 << 20},
+	})
+	peer := func() *domain.Peer {
+		t.Helper()
+		peer, err := e.torrentRepo.GetPeer(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !peer.HasValue() {
+			t.Fatalf("没有 Peer %s", key)
+		}
+		return peer.Value()
+	}
+	if err := e.uc.UpClientData(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !peer().IsActive {
+		t.Fatal("anime 后端可以访问时 Peer 不活跃")
+	}
+
+	e.anime.SetUnavailable(true)
+	if err := e.uc.UpClientData(ctx); err != nil {
+		t.Fatal(err)
+	}
+	downloaded := peer().Downloaded
+	time.Sleep(50 * time.Millisecond)
+	if err := e.uc.UpClientData(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := peer(); got.IsActive || got.Downloaded != downloaded {
+		t.Errorf("anime 后端无法访问时 Peer active = %v, downloaded = %d, 期望 false, %d",
+			got.IsActive, got.Downloaded, downloaded)
+	}
+	for _, torrent := range e.uc.GetTorrents() {
+		if stale := torrent.Backend == "anime"; torrent.Stale != stale {
+			t.Errorf("种子 %s stale = %v, 期望 %v", torrent.Hash, torrent.Stale, stale)
+		}
+	}
+}
+
+// TestSlowQueueBackendDown 慢速种子只增加所在后端的队列数量，有后端无法访问时已连接后端的队列数量不会重复增加
+func TestSlowQueueBackendDown(t *testing.T) {
+	e := newTestEnv(t)
+	c := e.client(t)
+	c.login()
+	ctx := context.Background()
+	c.postForm("/api/v2/app/setPreferences", url.Values{"json": {`{"queueing_enabled":true,` +
+		`"max_active_uploads":3,"dont_count_slow_torrents":true,"slow_torrent_inactive_timer":0}`}})
+	seedQueueSizes := func() map[string]int64 {
+		t.Helper()
+		pres, err := e.appRepo.GetBackendPreferences(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes := make(map[string]int64, len(pres))
+		for _, pre := range pres {
+			sizes[pre.Backend] = *pre.Preferences.SeedQueueSize
+		}
+		return sizes
+	}
+	upSlowTorrentQueue := func() {
+		t.Helper()
+		if err := e.uc.UpClientData(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.uc.UpSlowTorrentQueue(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 每个后端各有一个做种的慢速种子
+	upSlowTorrentQueue()
+	if got, want := seedQueueSizes(), map[string]int64{"main": 4, "anime": 4}; !maps.Equal(got, want) {
+		t.Errorf("做种队列数量 %v, 期望 %v", got, want)
+	}
+
+	// anime 后端无法访问后 main 后端的队列数量保持不变
+	e.anime.SetUnavailable(true)
+	for range 3 {
+		upSlowTorrentQueue()
+	}
+	if got, want := seedQueueSizes(), map[string]int64{"main": 4}; !maps.Equal(got, want) {
+		t.Errorf("anime 后端无法访问时做种队列数量 %v, 期望 %v", got, want)
+	}
+	var pre map[string]any
+	c.getJSON("/api/v2/app/preferences", nil, &pre)
+	if got := pre["max_active_uploads"]; got != float64(3) {
+		t.Errorf("max_active_uploads = %v, 期望 3", got)
+	}
+}
+
+// TestRetry 检查只有只读的 tr RPC 请求在失败时重试
+func TestRetry(t *testing.T) {
+	e := newTestEnv(t)
+	c := e.client(t)
+	c.login()
+	ctx := context.Background()
+
+	// torrent-get 失败后重试
+	calls := e.tr.Calls("torrent-get")
+	e.tr.FailAfterCall("torrent-get", 1)
+	if err := e.uc.UpClientData(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if calls := e.tr.Calls("torrent-get") - calls; calls != 2 {
+		t.Errorf("main 后端 torrent-get 调用 %d 次, 期望 2", calls)
+	}
+
+	// torrent-add 可能已经在 tr 中执行，失败后不重试
+	e.tr.FailAfterCall("torrent-add", 1)
+	magnet := fmt.Sprintf("magnet:?xt=urn:btih:%s&dn=%s", strings.Repeat("cd", 20), "Retry")
+	c.request(http.MethodPost, "/api/v2/torrents/add", nil, url.Values{"urls": {magnet}})
+	if calls := e.tr.Calls("torrent-add"); calls != 1 {
+		t.Errorf("main 后端 torrent-add 调用 %d 次, 期望 1", calls)
+	}
+}
+
+// TestCanceledRequest 调用方取消的请求与单次失败的请求不会使后端断开连接
+func TestCanceledRequest(t *testing.T) {
+	e := newTestEnv(t)
+	connected := func() {
+		t.Helper()
+		for _, backend := range e.uc.GetHealth(context.Background()).Backends {
+			if !backend.Reachable {
+				t.Errorf("tr 后端 %s 断开连接", backend.Name)
+			}
+		}
+	}
+
+	// 多次取消也不计入失败次数
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for range 5 {
+		if err := e.uc.UpClientData(ctx); err == nil {
+			t.Fatal("取消的请求没有失败")
+		}
+	}
+	connected()
+
+	// torrent-get 重试后仍然失败，只失败一次时保持连接
+	e.tr.FailAfterCall("torrent-get", 2)
+	if err := e.uc.UpClientData(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	connected()
+}
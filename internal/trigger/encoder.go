@@ -0,0 +1,29 @@
+package trigger
+
+import (
+	nethttp "net/http"
+
+	"github.com/go-kratos/kratos/v2/transport/http"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// TextContentType qb 文本响应的内容类型
+const TextContentType = "text/plain; charset=UTF-8"
+
+// ResponseEncoder 与 qb 一致的响应编码
+// 文本响应（Ok.、Fails.、版本号等）使用 text/plain，空响应没有响应体，其余使用默认编码
+func ResponseEncoder(w nethttp.ResponseWriter, r *nethttp.Request, v interface{}) error {
+	switch reply := v.(type) {
+	case *emptypb.Empty:
+		return nil
+	case *wrapperspb.StringValue:
+		// 服务可以通过 ReplyHeader 指定其他内容类型
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", TextContentType)
+		}
+		_, err := w.Write([]byte(reply.GetValue()))
+		return err
+	}
+	return http.DefaultResponseEncoder(w, r, v)
+}
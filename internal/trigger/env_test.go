@@ -0,0 +1,329 @@
+package trigger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"transmission-proxy/conf"
+	"transmission-proxy/internal/data"
+	"transmission-proxy/internal/domain"
+	"transmission-proxy/internal/fake"
+	"transmission-proxy/internal/service"
+
+	_ "github.com/azicen/kratos-extension/encoding"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/hekmon/transmissionrpc/v3"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	_ "transmission-proxy/encoding"
+)
+
+const (
+	// seedHash 预先存在于 tr 中的种子
+	seedHash = "0123456789abcdef0123456789abcdef01234567"
+	seedName = "Big Buck Bunny"
+	// bangumiHash AutoBangumi 添加的种子
+	bangumiHash     = "89abcdef0123456789abcdef0123456789abcdef"
+	bangumiName     = "[Sub] Show - 01 [1080p]"
+	bangumiCategory = "Bangumi"
+	bangumiSavePath = "/downloads/Bangumi/Show/Season 1"
+	torrentLabel    = "trp"
+	// animeSeedHash 预先存在于第二个 tr 后端中的种子
+	animeSeedHash = "76543210fedcba9876543210fedcba9876543210"
+	animeSeedName = "[Sub] Show - 00 [1080p]"
+	animeLabel    = "anime"
+	// adminToken 管理接口的访问令牌
+	adminToken = "e2e"
+)
+
+// testEnv 模拟的 tr、仓储与代理服务
+// 代理连接两个模拟的 tr 后端，tr 仓储使用真实实现，nftables、GeoIP 与流量统计使用内存实现
+type testEnv struct {
+	tr *fake.TRServer
+	// anime 第二个 tr 后端，AutoBangumi 分类的种子添加到该后端
+	anime  *fake.TRServer
+	banIP  *fake.BanIPRepo
+	uc     *domain.TorrentUsecase
+	server *httptest.Server
+	// grpcAddr gRPC 服务地址
+	grpcAddr string
+	// appRepo 代理使用的首选项仓储
+	appRepo domain.AppRepo
+	// torrentRepo 代理使用的种子仓储
+	torrentRepo domain.TorrentRepo
+	// bootstrap 代理的配置
+	bootstrap *conf.Bootstrap
+	// adminToken 管理接口的访问令牌，调用 reload 模拟配置热更新
+	adminToken *AdminToken
+}
+
+// newTestEnv 启动模拟的 tr 与代理的 HTTP、gRPC 服务，测试结束时关闭
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	tr := fake.NewTRServer()
+	t.Cleanup(tr.Close)
+	tr.AddTorrent(seedHash, seedName)
+	tr.SetPeers(seedHash, []transmissionrpc.Peer{
+		{Address: "203.0.113.7", Port: 6881, ClientName: "qBittorrent 4.6.5", FlagStr: "DE",
+			Progress: 0.5, RateToClient: 1024},
+		{Address: "2001:db8::1", Port: 51413, ClientName: "Transmission 4.0.6", FlagStr: "UI",
+			IsIncoming: true, IsUTP: true, RateToPeer: 2048},
+	})
+	anime := fake.NewTRServer()
+	t.Cleanup(anime.Close)
+	anime.AddTorrent(animeSeedHash, animeSeedName)
+
+	conf.FlagConf = t.TempDir()
+	bootstrap := &conf.Bootstrap{
+		Trigger: &conf.Trigger{
+			Http:  &conf.Trigger_HTTP{},
+			Grpc:  &conf.Trigger_GRPC{Host: "127.0.0.1"},
+			Admin: &conf.Trigger_Admin{Token: adminToken},
+		},
+		Infra: &conf.Infra{Tr: &conf.Infra_TR{
+			Backends: []*conf.Infra_TR_Backend{
+				{Name: "main", RpcUrl: tr.RPCURL()},
+				{Name: "anime", RpcUrl: anime.RPCURL(), Labels: []string{animeLabel},
+					Categories: []string{bangumiCategory}},
+			},
+			RequestInterval: durationpb.New(time.Second),
+			RpcTimeout:      durationpb.New(2 * time.Second),
+			RpcRetries:      proto.Uint32(1),
+			AddTorrentLabel: torrentLabel,
+		}},
+	}
+	logger := log.NewFilter(log.NewStdLogger(io.Discard))
+	if testing.Verbose() {
+		logger = log.NewFilter(log.NewStdLogger(os.Stderr), log.FilterLevel(log.LevelError))
+	}
+
+	infra, infraCleanup, err := data.NewTRInfra(bootstrap, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(infraCleanup)
+	appRepo := data.NewAppDao(infra, logger)
+	banIPRepo := fake.NewBanIPRepo()
+	torrentRepo, err := data.NewTorrentDao(infra, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queueLock := domain.NewQueueLock()
+	appUc := domain.NewAppUsecase(bootstrap, appRepo, banIPRepo, queueLock, logger)
+	uc := domain.NewTorrentUsecase(bootstrap, appRepo, banIPRepo, fake.NewGeoIPRepo(), torrentRepo,
+		fake.NewTrafficRepo(), queueLock, logger)
+	adminSrv := service.NewAdminService(appUc, uc)
+	appSrv := service.NewAppService(appUc)
+	authSrv := service.NewAuthService(uc)
+	statisticsSrv := service.NewStatisticsService(uc)
+	syncSrv := service.NewSyncService(uc)
+	torrentSrv := service.NewTorrentService(uc)
+	transferSrv := service.NewTransferService(appUc)
+
+	adminToken := &AdminToken{}
+	adminToken.reload(nil, bootstrap)
+
+	httpServer := NewHTTPServer(bootstrap, adminSrv, appSrv, authSrv, statisticsSrv, syncSrv, torrentSrv,
+		transferSrv, uc, NewMetricsRegistry(uc), adminToken, logger)
+	server := httptest.NewServer(httpServer)
+	t.Cleanup(server.Close)
+
+	grpcServer := NewGRPCServer(bootstrap, adminSrv, appSrv, authSrv, statisticsSrv, syncSrv, torrentSrv,
+		transferSrv, adminToken, logger)
+	endpoint, err := grpcServer.Endpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = grpcServer.Start(context.Background())
+	}()
+	t.Cleanup(func() {
+		_ = grpcServer.Stop(context.Background())
+	})
+
+	if err := uc.UpClientData(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return &testEnv{
+		tr:          tr,
+		anime:       anime,
+		banIP:       banIPRepo,
+		uc:          uc,
+		server:      server,
+		grpcAddr:    endpoint.Host,
+		appRepo:     appRepo,
+		torrentRepo: torrentRepo,
+		bootstrap:   bootstrap,
+		adminToken:  adminToken,
+	}
+}
+
+// client 创建保存登录 Cookie 的 qb WebUI 客户端
+func (e *testEnv) client(t *testing.T) *testClient {
+	jar, _ := cookiejar.New(nil)
+	return &testClient{
+		t:       t,
+		baseURL: e.server.URL,
+		http:    &http.Client{Jar: jar, Timeout: 10 * time.Second},
+	}
+}
+
+// testClient 请求代理 HTTP 接口的客户端，请求失败时结束测试
+type testClient struct {
+	t       *testing.T
+	baseURL string
+	http    *http.Client
+	// token 管理接口的访问令牌，不为空时添加 Authorization 请求头
+	token string
+}
+
+// response HTTP 响应
+type response struct {
+	status      int
+	contentType string
+	body        []byte
+}
+
+// request 发送请求，form 不为空时使用表单提交
+func (c *testClient) request(method string, path string, query url.Values, form url.Values) *response {
+	c.t.Helper()
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, c.baseURL+path+"?"+query.Encode(), body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	return c.do(req)
+}
+
+// postJSON 以 JSON 提交请求，用于代理自身的管理接口
+func (c *testClient) postJSON(path string, in any) *response {
+	c.t.Helper()
+	data, err := json.Marshal(in)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req)
+}
+
+func (c *testClient) do(req *http.Request) *response {
+	c.t.Helper()
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.t.Logf("%s %s -> %d %s", req.Method, req.URL.RequestURI(), res.StatusCode, data)
+	return &response{
+		status:      res.StatusCode,
+		contentType: res.Header.Get("Content-Type"),
+		body:        data,
+	}
+}
+
+// ok 要求响应为 200 并返回响应体
+func (c *testClient) ok(res *response) []byte {
+	c.t.Helper()
+	if res.status != http.StatusOK {
+		c.t.Fatalf("HTTP %d %s", res.status, res.body)
+	}
+	return res.body
+}
+
+func (c *testClient) get(path string, query url.Values) []byte {
+	c.t.Helper()
+	return c.ok(c.request(http.MethodGet, path, query, nil))
+}
+
+func (c *testClient) postForm(path string, form url.Values) []byte {
+	c.t.Helper()
+	return c.ok(c.request(http.MethodPost, path, nil, form))
+}
+
+// getJSON 获取 JSON 响应并解析到 v
+func (c *testClient) getJSON(path string, query url.Values, v any) {
+	c.t.Helper()
+	if err := json.Unmarshal(c.get(path, query), v); err != nil {
+		c.t.Fatalf("%s 不是 JSON: %v", path, err)
+	}
+}
+
+// login 登录并检查 SID Cookie
+func (c *testClient) login() {
+	c.t.Helper()
+	body := c.postForm("/api/v2/auth/login", url.Values{"username": {"admin"}, "password": {"adminadmin"}})
+	if string(body) != "Ok." {
+		c.t.Fatalf("登录响应 %q", body)
+	}
+	baseURL, _ := url.Parse(c.baseURL)
+	for _, cookie := range c.http.Jar.Cookies(baseURL) {
+		if cookie.Name == "SID" && cookie.Value != "" {
+			return
+		}
+	}
+	c.t.Fatal("登录后没有 SID Cookie")
+}
+
+// torrents 获取种子列表，返回 hash 到种子的映射
+func (c *testClient) torrents(query url.Values) map[string]map[string]any {
+	c.t.Helper()
+	var list []map[string]any
+	c.getJSON("/api/v2/torrents/info", query, &list)
+	torrents := make(map[string]map[string]any, len(list))
+	for _, torrent := range list {
+		hash, _ := torrent["hash"].(string)
+		torrents[hash] = torrent
+	}
+	return torrents
+}
+
+// requireKeys 检查 JSON 对象包含 qb 的字段
+func requireKeys(t *testing.T, name string, object map[string]any, keys ...string) {
+	t.Helper()
+	missing := make([]string, 0)
+	for _, key := range keys {
+		if _, ok := object[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		t.Errorf("%s 缺少字段 %v", name, missing)
+	}
+}
+
+// requireEqual 检查 JSON 字段的值
+func requireEqual(t *testing.T, name string, object map[string]any, key string, want any) {
+	t.Helper()
+	if got := object[key]; got != want {
+		t.Errorf("%s.%s = %v (%T), 期望 %v (%T)", name, key, got, got, want, want)
+	}
+}
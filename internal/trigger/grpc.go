@@ -0,0 +1,64 @@
+package trigger
+
+import (
+	"fmt"
+
+	adminv1 "transmission-proxy/api/proxy/v1"
+	v2 "transmission-proxy/api/v2"
+	"transmission-proxy/conf"
+	"transmission-proxy/internal/service"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware/logging"
+	"github.com/go-kratos/kratos/v2/middleware/recovery"
+	"github.com/go-kratos/kratos/v2/middleware/tracing"
+	"github.com/go-kratos/kratos/v2/middleware/validate"
+	"github.com/go-kratos/kratos/v2/transport/grpc"
+)
+
+// NewGRPCServer new a gRPC server.
+// 没有设置 trigger.grpc 时返回 nil，不启动 gRPC 服务
+func NewGRPCServer(
+	bootstrap *conf.Bootstrap,
+	adminSrv *service.AdminService,
+	appSrv *service.AppService,
+	authSrv *service.AuthService,
+	statisticsSrv *service.StatisticsService,
+	syncSrv *service.SyncService,
+	torrentSrv *service.TorrentService,
+	transferSrv *service.TransferService,
+	adminToken *AdminToken,
+	logger log.Logger,
+) *grpc.Server {
+	config := bootstrap.GetTrigger().GetGrpc()
+	if config == nil {
+		return nil
+	}
+	opts := []grpc.ServerOption{
+		grpc.Middleware(
+			recovery.Recovery(),
+			MetricsServer(),
+			tracing.Server(),
+			logging.Server(logger),
+			validate.Validator(),
+			AdminAuth(adminToken),
+		),
+	}
+	if config.Host != "" || config.Port != 0 {
+		opts = append(opts, grpc.Address(fmt.Sprintf("%s:%v", config.Host, config.Port)))
+	}
+	if config.Timeout != nil {
+		opts = append(opts, grpc.Timeout(config.Timeout.AsDuration()))
+	}
+
+	server := grpc.NewServer(opts...)
+	adminv1.RegisterAdminServer(server, adminSrv)
+	v2.RegisterAppServer(server, appSrv)
+	v2.RegisterAuthServer(server, authSrv)
+	v2.RegisterStatisticsServer(server, statisticsSrv)
+	v2.RegisterSyncServer(server, syncSrv)
+	v2.RegisterTorrentServer(server, torrentSrv)
+	v2.RegisterTransferServer(server, transferSrv)
+
+	return server
+}
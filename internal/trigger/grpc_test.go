@@ -0,0 +1,106 @@
+package trigger
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	adminv1 "transmission-proxy/api/proxy/v1"
+	v2 "transmission-proxy/api/v2"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/transport/grpc"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// TestGRPC 使用 gRPC 客户端调用与 HTTP 相同的接口以及管理接口
+func TestGRPC(t *testing.T) {
+	e := newTestEnv(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := grpc.DialInsecure(ctx, grpc.WithEndpoint(e.grpcAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	version, err := v2.NewAppClient(conn).GetWebAPIVersion(ctx, &emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.GetValue() == "" {
+		t.Error("WebAPI 版本为空")
+	}
+
+	mainData, err := v2.NewSyncClient(conn).GetMainData(ctx, &v2.GetMainDataRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mainData.GetTorrents()[seedHash]; !ok {
+		t.Errorf("sync/maindata 中没有 %s", seedHash)
+	}
+
+	const ip = "198.51.100.10"
+	if _, err := v2.NewTransferClient(conn).BanPeers(ctx, &v2.BanPeersRequest{Peers: ip + ":6881"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 管理接口需要访问令牌，错误通过 gRPC 状态码返回
+	admin := adminv1.NewAdminClient(conn)
+	_, err = admin.ListBans(ctx, &adminv1.ListBansRequest{})
+	if code := status.Code(err); code != codes.Unauthenticated {
+		t.Fatalf("没有访问令牌时返回 %v, 期望 %v", code, codes.Unauthenticated)
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+adminToken)
+
+	bans, err := admin.ListBans(ctx, &adminv1.ListBansRequest{Query: ip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bans.GetBans()) != 1 || bans.GetBans()[0].GetSource() != "qb" {
+		t.Errorf("封禁列表 %v, 期望通过 qb 接口封禁的 %s", bans.GetBans(), ip)
+	}
+	if _, err := admin.Unban(ctx, &adminv1.UnbanRequest{Ips: []string{ip}}); err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(e.banIP.BannedIPs(), ip) {
+		t.Errorf("解禁后封禁列表中仍有 %s", ip)
+	}
+
+	// 与 HTTP 使用相同的中间件，由 validate 中间件校验请求并记录请求指标
+	requests := httpRequests.WithLabelValues(adminv1.OperationAdminBan, "400")
+	count := counterValue(t, requests)
+	_, err = admin.Ban(ctx, &adminv1.BanRequest{})
+	if code := status.Code(err); code != codes.InvalidArgument {
+		t.Errorf("ips 为空时封禁返回 %v, 期望 %v", code, codes.InvalidArgument)
+	}
+	if reason := errors.Reason(err); reason != "VALIDATOR" {
+		t.Errorf("ips 为空时封禁的错误原因 %q, 期望由 validate 中间件返回", reason)
+	}
+	if count := counterValue(t, requests) - count; count != 1 {
+		t.Errorf("gRPC 请求 %s 记录 %v 次, 期望 1", adminv1.OperationAdminBan, count)
+	}
+	task, err := admin.RunTask(ctx, &adminv1.RunTaskRequest{Name: "client_refresh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.GetStartedAt() == 0 {
+		t.Error("任务没有开始时间")
+	}
+}
+
+// counterValue 读取计数器的值
+func counterValue(t *testing.T, counter prometheus.Counter) float64 {
+	t.Helper()
+	metric := &dto.Metric{}
+	if err := counter.Write(metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetCounter().GetValue()
+}
@@ -0,0 +1,114 @@
+package trigger
+
+import (
+	nethttp "net/http"
+	"time"
+
+	"transmission-proxy/internal/domain"
+
+	"github.com/go-kratos/kratos/v2/transport/http"
+)
+
+// healthReply 健康检查响应
+type healthReply struct {
+	// Status ok、degraded（部分 tr 后端无法访问）或 unavailable
+	Status string `json:"status"`
+
+	Transmission struct {
+		Reachable bool           `json:"reachable"`
+		Version   int64          `json:"rpc_version,omitempty"`
+		Error     string         `json:"error,omitempty"`
+		Backends  []backendReply `json:"backends"`
+	} `json:"transmission"`
+
+	ClientData struct {
+		LastRefresh   *time.Time `json:"last_refresh,omitempty"`
+		SinceSeconds  *float64   `json:"since_seconds,omitempty"`
+		FirstFinished bool       `json:"first_finished"`
+	} `json:"client_data"`
+
+	NFTables struct {
+		Ready bool   `json:"ready"`
+		Error string `json:"error,omitempty"`
+	} `json:"nftables"`
+
+	TrackerSubscription struct {
+		LastSuccess  *time.Time `json:"last_success,omitempty"`
+		SinceSeconds *float64   `json:"since_seconds,omitempty"`
+	} `json:"tracker_subscription"`
+
+	Statistics struct {
+		SaveError string `json:"save_error,omitempty"`
+	} `json:"statistics"`
+}
+
+// backendReply tr 后端的健康状态
+type backendReply struct {
+	Name      string `json:"name"`
+	Reachable bool   `json:"reachable"`
+	Version   int64  `json:"rpc_version,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// RegisterHealthHTTPServer 注册 /healthz 与 /readyz
+// /healthz 只要进程可以响应就返回 200，/readyz 在服务不可用时返回 503
+func RegisterHealthHTTPServer(s *http.Server, uc *domain.TorrentUsecase) {
+	r := s.Route("/")
+	r.GET("/healthz", HealthHttpHandler(uc, false))
+	r.GET("/readyz", HealthHttpHandler(uc, true))
+}
+
+func HealthHttpHandler(uc *domain.TorrentUsecase, readiness bool) func(ctx http.Context) error {
+	return func(ctx http.Context) error {
+		health := uc.GetHealth(ctx)
+		reply := newHealthReply(health, time.Now())
+
+		code := nethttp.StatusOK
+		if readiness && !health.Ready() {
+			code = nethttp.StatusServiceUnavailable
+		}
+		return ctx.JSON(code, reply)
+	}
+}
+
+func newHealthReply(health *domain.Health, nowTime time.Time) *healthReply {
+	reply := &healthReply{Status: "ok"}
+	switch {
+	case !health.Ready():
+		reply.Status = "unavailable"
+	case health.Degraded():
+		reply.Status = "degraded"
+	}
+
+	reply.Transmission.Reachable = health.TRReachable
+	reply.Transmission.Version = health.TRVersion
+	reply.Transmission.Error = health.TRError
+	reply.Transmission.Backends = make([]backendReply, 0, len(health.Backends))
+	for _, backend := range health.Backends {
+		reply.Transmission.Backends = append(reply.Transmission.Backends, backendReply{
+			Name:      backend.Name,
+			Reachable: backend.Reachable,
+			Version:   backend.Version,
+			Error:     backend.Error,
+		})
+	}
+
+	reply.ClientData.FirstFinished = !health.LastClientDataTime.IsZero()
+	if reply.ClientData.FirstFinished {
+		since := nowTime.Sub(health.LastClientDataTime).Seconds()
+		reply.ClientData.LastRefresh = &health.LastClientDataTime
+		reply.ClientData.SinceSeconds = &since
+	}
+
+	reply.NFTables.Ready = health.NFTablesReady
+	reply.NFTables.Error = health.NFTablesError
+
+	if !health.LastTrackerListTime.IsZero() {
+		since := nowTime.Sub(health.LastTrackerListTime).Seconds()
+		reply.TrackerSubscription.LastSuccess = &health.LastTrackerListTime
+		reply.TrackerSubscription.SinceSeconds = &since
+	}
+
+	reply.Statistics.SaveError = health.SaveStatisticsError
+	return reply
+}
@@ -4,14 +4,20 @@ import (
 	"context"
 	"fmt"
 
+	adminv1 "transmission-proxy/api/proxy/v1"
 	v2 "transmission-proxy/api/v2"
 	"transmission-proxy/conf"
+	"transmission-proxy/internal/domain"
 	"transmission-proxy/internal/service"
 
 	"github.com/go-kratos/kratos/v2/log"
 	"github.com/go-kratos/kratos/v2/middleware/logging"
 	"github.com/go-kratos/kratos/v2/middleware/recovery"
+	"github.com/go-kratos/kratos/v2/middleware/tracing"
+	"github.com/go-kratos/kratos/v2/middleware/validate"
 	"github.com/go-kratos/kratos/v2/transport/http"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
@@ -19,21 +25,30 @@ import (
 // NewHTTPServer new an HTTP server.
 func NewHTTPServer(
 	bootstrap *conf.Bootstrap,
+	adminSrv *service.AdminService,
 	appSrv *service.AppService,
 	authSrv *service.AuthService,
+	statisticsSrv *service.StatisticsService,
 	syncSrv *service.SyncService,
 	torrentSrv *service.TorrentService,
 	transferSrv *service.TransferService,
+	torrentUc *domain.TorrentUsecase,
+	registry *prometheus.Registry,
+	adminToken *AdminToken,
 	logger log.Logger,
 ) *http.Server {
 	config := bootstrap.GetTrigger()
 	opts := []http.ServerOption{
 		http.Middleware(
 			recovery.Recovery(),
+			MetricsServer(),
+			tracing.Server(),
 			logging.Server(logger),
+			validate.Validator(),
+			AdminAuth(adminToken),
 		),
 	}
-	opts = append(opts, http.Network("tcp"))
+	opts = append(opts, http.Network("tcp"), http.ResponseEncoder(ResponseEncoder))
 	if config.Http.Host != "" || config.Http.Port != 0 {
 		opts = append(opts, http.Address(fmt.Sprintf("%s:%v", config.Http.Host, config.Http.Port)))
 	}
@@ -42,11 +57,15 @@ func NewHTTPServer(
 	}
 
 	server := http.NewServer(opts...)
+	server.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
 	RegisterPingHTTPServer(server, appSrv)
+	RegisterHealthHTTPServer(server, torrentUc)
 	RegisterFormDataHTTPServer(server, torrentSrv)
 	RegisterDeficienciesContentTypeHTTPServer(server, authSrv)
+	adminv1.RegisterAdminHTTPServer(server, adminSrv)
 	v2.RegisterAppHTTPServer(server, appSrv)
 	v2.RegisterAuthHTTPServer(server, authSrv)
+	v2.RegisterStatisticsHTTPServer(server, statisticsSrv)
 	v2.RegisterSyncHTTPServer(server, syncSrv)
 	v2.RegisterTorrentHTTPServer(server, torrentSrv)
 	v2.RegisterTransferHTTPServer(server, transferSrv)
@@ -125,6 +144,8 @@ func TorrentAddHttpHandler(srv v2.TorrentHTTPServer) func(ctx http.Context) erro
 		in.Urls = req.FormValue("urls")
 		path := req.FormValue("savepath")
 		in.Savepath = &path
+		category := req.FormValue("category")
+		in.Category = &category
 		cookie := req.FormValue("cookie")
 		in.Cookie = &cookie
 		tags := req.FormValue("tags")
@@ -135,10 +156,11 @@ func TorrentAddHttpHandler(srv v2.TorrentHTTPServer) func(ctx http.Context) erro
 		h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
 			return srv.Add(ctx, req.(*v2.AddRequest))
 		})
-		_, err := h(ctx, &in)
+		out, err := h(ctx, &in)
 		if err != nil {
 			return err
 		}
-		return ctx.Result(200, []byte{})
+		reply := out.(*wrapperspb.StringValue)
+		return ctx.Result(200, reply)
 	}
 }
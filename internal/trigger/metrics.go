@@ -0,0 +1,151 @@
+package trigger
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"transmission-proxy/internal/domain"
+	"transmission-proxy/internal/metrics"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.With(metrics.Registerer).NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP 与 gRPC 请求数量",
+	}, []string{"operation", "code"})
+
+	httpRequestDuration = promauto.With(metrics.Registerer).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP 与 gRPC 请求耗时（秒）",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+)
+
+// MetricsServer 记录 HTTP 与 gRPC 请求指标的中间件，gRPC 请求的错误码同样转换为 HTTP 状态码
+func MetricsServer() middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			operation := ""
+			if tr, ok := transport.FromServerContext(ctx); ok {
+				operation = tr.Operation()
+			}
+			startTime := time.Now()
+			reply, err = handler(ctx, req)
+			code := 200
+			if se := errors.FromError(err); se != nil {
+				code = int(se.Code)
+			}
+			httpRequests.WithLabelValues(operation, strconv.Itoa(code)).Inc()
+			httpRequestDuration.WithLabelValues(operation).Observe(time.Since(startTime).Seconds())
+			return
+		}
+	}
+}
+
+// NewMetricsRegistry 创建 /metrics 使用的私有 Registry
+func NewMetricsRegistry(torrentUc *domain.TorrentUsecase) *prometheus.Registry {
+	return metrics.NewRegistry(newTorrentCollector(torrentUc))
+}
+
+// torrentCollector 在采集时从 TorrentUsecase 读取种子与统计数据
+type torrentCollector struct {
+	uc *domain.TorrentUsecase
+
+	torrentDownloadSpeed *prometheus.Desc
+	torrentUploadSpeed   *prometheus.Desc
+	torrentPeers         *prometheus.Desc
+	downloadSpeed        *prometheus.Desc
+	uploadSpeed          *prometheus.Desc
+	sessionDownloaded    *prometheus.Desc
+	sessionUploaded      *prometheus.Desc
+	alltimeDownloaded    *prometheus.Desc
+	alltimeUploaded      *prometheus.Desc
+	peers                *prometheus.Desc
+	torrents             *prometheus.Desc
+}
+
+func newTorrentCollector(uc *domain.TorrentUsecase) *torrentCollector {
+	name := func(name string) string {
+		return prometheus.BuildFQName(metrics.Namespace, "", name)
+	}
+	torrentLabels := []string{"hash"}
+	return &torrentCollector{
+		uc: uc,
+
+		torrentDownloadSpeed: prometheus.NewDesc(name("torrent_download_speed_bytes"),
+			"种子下载速度（字节/秒）", torrentLabels, nil),
+		torrentUploadSpeed: prometheus.NewDesc(name("torrent_upload_speed_bytes"),
+			"种子上传速度（字节/秒）", torrentLabels, nil),
+		torrentPeers: prometheus.NewDesc(name("torrent_peers"),
+			"种子连接的 Peer 数量", torrentLabels, nil),
+		downloadSpeed: prometheus.NewDesc(name("download_speed_bytes"),
+			"全局下载速度（字节/秒）", nil, nil),
+		uploadSpeed: prometheus.NewDesc(name("upload_speed_bytes"),
+			"全局上传速度（字节/秒）", nil, nil),
+		sessionDownloaded: prometheus.NewDesc(name("session_downloaded_bytes_total"),
+			"本次会话下载的数据量（字节）", nil, nil),
+		sessionUploaded: prometheus.NewDesc(name("session_uploaded_bytes_total"),
+			"本次会话上传的数据量（字节）", nil, nil),
+		alltimeDownloaded: prometheus.NewDesc(name("alltime_downloaded_bytes_total"),
+			"所有时间下载的数据量（字节）", nil, nil),
+		alltimeUploaded: prometheus.NewDesc(name("alltime_uploaded_bytes_total"),
+			"所有时间上传的数据量（字节）", nil, nil),
+		peers: prometheus.NewDesc(name("peers"),
+			"所有种子连接的 Peer 数量", nil, nil),
+		torrents: prometheus.NewDesc(name("torrents"),
+			"种子数量", nil, nil),
+	}
+}
+
+// Describe .
+func (c *torrentCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.torrentDownloadSpeed
+	ch <- c.torrentUploadSpeed
+	ch <- c.torrentPeers
+	ch <- c.downloadSpeed
+	ch <- c.uploadSpeed
+	ch <- c.sessionDownloaded
+	ch <- c.sessionUploaded
+	ch <- c.alltimeDownloaded
+	ch <- c.alltimeUploaded
+	ch <- c.peers
+	ch <- c.torrents
+}
+
+// Collect .
+func (c *torrentCollector) Collect(ch chan<- prometheus.Metric) {
+	torrents := c.uc.GetTorrents()
+	peers := 0
+	for _, torrent := range torrents {
+		ch <- prometheus.MustNewConstMetric(c.torrentDownloadSpeed, prometheus.GaugeValue,
+			float64(torrent.DownloadSpeed), torrent.Hash)
+		ch <- prometheus.MustNewConstMetric(c.torrentUploadSpeed, prometheus.GaugeValue,
+			float64(torrent.UploadSpeed), torrent.Hash)
+		ch <- prometheus.MustNewConstMetric(c.torrentPeers, prometheus.GaugeValue,
+			float64(len(torrent.Peers)), torrent.Hash)
+		peers = peers + len(torrent.Peers)
+	}
+
+	statistics := c.uc.GetStatistics()
+	ch <- prometheus.MustNewConstMetric(c.downloadSpeed, prometheus.GaugeValue, float64(statistics.DownloadSpeed))
+	ch <- prometheus.MustNewConstMetric(c.uploadSpeed, prometheus.GaugeValue, float64(statistics.UploadSpeed))
+	ch <- prometheus.MustNewConstMetric(c.sessionDownloaded, prometheus.CounterValue,
+		float64(statistics.TotalDownloadedSession))
+	ch <- prometheus.MustNewConstMetric(c.sessionUploaded, prometheus.CounterValue,
+		float64(statistics.TotalUploadedSession))
+	ch <- prometheus.MustNewConstMetric(c.alltimeDownloaded, prometheus.CounterValue,
+		float64(statistics.TotalDownloaded+statistics.TotalDownloadedSession))
+	ch <- prometheus.MustNewConstMetric(c.alltimeUploaded, prometheus.CounterValue,
+		float64(statistics.TotalUploaded+statistics.TotalUploadedSession))
+	ch <- prometheus.MustNewConstMetric(c.peers, prometheus.GaugeValue, float64(peers))
+	ch <- prometheus.MustNewConstMetric(c.torrents, prometheus.GaugeValue, float64(len(torrents)))
+}
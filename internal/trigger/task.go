@@ -2,6 +2,7 @@ package trigger
 
 import (
 	"context"
+	"sync/atomic"
 	"time"
 
 	"transmission-proxy/conf"
@@ -10,34 +11,78 @@ import (
 	"github.com/go-kratos/kratos/v2/log"
 )
 
+// singleFlight 保证同一任务同一时间只有一个在执行
+type singleFlight struct {
+	running atomic.Bool
+}
+
+// Do 执行任务，任务正在执行时直接跳过并返回 false
+func (s *singleFlight) Do(task func()) bool {
+	if !s.running.CompareAndSwap(false, true) {
+		return false
+	}
+	defer s.running.Store(false)
+	task()
+	return true
+}
+
+// unbanExpiredInterval 检查封禁到期的时间间隔
+const unbanExpiredInterval = 30 * time.Second
+
+// defaultTransferRequestInterval 配置文件中没有设置 transfer_request_interval 时 transfer 刷新到种子的时间间隔
+const defaultTransferRequestInterval = 3 * time.Hour
+
+// transferRequestInterval transfer 刷新到种子的时间间隔
+func transferRequestInterval(bootstrap *conf.Bootstrap) time.Duration {
+	interval := bootstrap.GetInfra().GetTr().GetTransferRequestInterval()
+	if interval == nil {
+		return defaultTransferRequestInterval
+	}
+	return interval.AsDuration()
+}
+
 type ScheduledTask struct {
-	ctx context.Context
-	uc  *domain.TorrentUsecase
+	ctx   context.Context
+	appUc *domain.AppUsecase
+	uc    *domain.TorrentUsecase
 
 	// 客户端状态刷新间隔
 	stateRefreshInterval time.Duration
 	// transfer刷新到种子的时间间隔
 	transferRequestInterval time.Duration
 
+	// 配置热更新时重置间隔
+	statisticsTicker *time.Ticker
+	trackerTicker    *time.Ticker
+
+	// 防止耗时较长的任务在下一次触发时重叠执行
+	statisticsFlight singleFlight
+	saveFlight       singleFlight
+	trackerFlight    singleFlight
+
 	log *log.Helper
 }
 
-func NewScheduledTask(bootstrap *conf.Bootstrap, uc *domain.TorrentUsecase, logger log.Logger) (
-	*ScheduledTask, func()) {
+func NewScheduledTask(bootstrap *conf.Bootstrap, reloader *conf.Reloader, appUc *domain.AppUsecase,
+	uc *domain.TorrentUsecase, logger log.Logger) (*ScheduledTask, func()) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	task := &ScheduledTask{
 		ctx:                     ctx,
+		appUc:                   appUc,
 		uc:                      uc,
 		stateRefreshInterval:    time.Duration(uc.GetStateRefreshInterval()) * time.Second,
-		transferRequestInterval: bootstrap.GetInfra().GetTr().GetTransferRequestInterval().AsDuration(),
+		transferRequestInterval: transferRequestInterval(bootstrap),
 		log:                     log.NewHelper(logger),
 	}
 
+	task.restoreBans()
 	task.RunStatisticsTask()
 	saveHistoricalCancel := task.RunSaveHistoricalTask()
 	task.RunUpTrackerTask()
+	task.RunUnbanExpiredTask()
+	reloader.Subscribe(task.reload)
 
 	return task, func() {
 		cancel()
@@ -51,16 +96,24 @@ func (t *ScheduledTask) RunStatisticsTask() {
 	ctx, cancel := context.WithCancel(t.ctx)
 	_ = cancel
 	ticker := time.NewTicker(t.stateRefreshInterval)
+	t.statisticsTicker = ticker
 	go func() {
 		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
-				t.log.Debugf("执行更新状态任务")
-				err := t.uc.UpClientData(t.ctx)
-				if err != nil {
-					t.log.Errorw("err", err)
-				}
+				t.statisticsFlight.Do(func() {
+					t.log.Debugf("执行更新状态任务")
+					err := t.uc.UpClientData(t.ctx)
+					if err != nil {
+						t.log.Errorw("err", err)
+						return
+					}
+					err = t.uc.UpSlowTorrentQueue(t.ctx)
+					if err != nil {
+						t.log.Errorw("err", err)
+					}
+				})
 				break
 
 			case <-ctx.Done():
@@ -83,11 +136,17 @@ func (t *ScheduledTask) RunSaveHistoricalTask() (cancel func()) {
 		for {
 			select {
 			case <-ticker.C:
-				t.log.Debugf("执行定时保存任务")
-				err := t.uc.SaveStatistics()
-				if err != nil {
-					t.log.Errorw("err", err)
-				}
+				t.saveFlight.Do(func() {
+					t.log.Debugf("执行定时保存任务")
+					err := t.uc.SaveStatistics()
+					if err != nil {
+						t.log.Errorw("err", err)
+					}
+					err = t.uc.PruneTraffic(ctx)
+					if err != nil {
+						t.log.Errorw("err", err)
+					}
+				})
 				break
 
 			case <-ctx.Done():
@@ -115,29 +174,20 @@ func (t *ScheduledTask) RunUpTrackerTask() {
 
 	//ticker := time.NewTicker(t.stateRefreshInterval)
 	ticker := time.NewTicker(t.transferRequestInterval)
+	t.trackerTicker = ticker
 
-	task := func() {
-		taskCtx, taskCancel := context.WithCancel(ctx)
-		defer taskCancel()
-		t.log.Infof("执行更新Tracker任务")
-		err := t.uc.UpTrackerList(taskCtx)
-		if err != nil {
-			t.log.Errorw("err", err)
-		}
-		err = t.uc.UpTorrentALLTrackerList(taskCtx)
-		if err != nil {
-			t.log.Errorw("err", err)
-		}
-	}
-
-	task()
+	t.trackerFlight.Do(t.upTracker)
 
 	go func() {
 		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
-				go task()
+				go func() {
+					if !t.trackerFlight.Do(t.upTracker) {
+						t.log.Warnf("上一次更新Tracker任务仍在执行，跳过本次任务")
+					}
+				}()
 				break
 
 			case <-ctx.Done():
@@ -147,3 +197,84 @@ func (t *ScheduledTask) RunUpTrackerTask() {
 		}
 	}()
 }
+
+// RunUnbanExpiredTask 解禁到期ip任务
+func (t *ScheduledTask) RunUnbanExpiredTask() {
+	t.log.Debugf("启动解禁到期ip任务")
+	ticker := time.NewTicker(unbanExpiredInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				ips, err := t.appUc.UnbanExpired(t.ctx)
+				if err != nil {
+					t.log.Errorw("err", err)
+					break
+				}
+				if len(ips) > 0 {
+					t.log.Infof("封禁到期，已解禁: %v", ips)
+				}
+
+			case <-t.ctx.Done():
+				t.log.Debugf("解禁到期ip任务结束: %v", t.ctx.Err())
+				return
+			}
+		}
+	}()
+}
+
+// restoreBans 恢复上次运行时通过管理接口封禁的ip
+func (t *ScheduledTask) restoreBans() {
+	ips, err := t.appUc.RestoreBans(t.ctx)
+	if err != nil {
+		t.log.Errorf("恢复封禁ip失败: %v", err)
+		return
+	}
+	if len(ips) > 0 {
+		t.log.Infof("已恢复封禁: %v", ips)
+	}
+}
+
+// upTracker 更新Tracker列表并添加到所有种子
+func (t *ScheduledTask) upTracker() {
+	taskCtx, taskCancel := context.WithCancel(t.ctx)
+	defer taskCancel()
+	t.log.Infof("执行更新Tracker任务")
+	err := t.uc.UpTrackerList(taskCtx)
+	if err != nil {
+		t.log.Errorw("err", err)
+	}
+	err = t.uc.UpTorrentALLTrackerList(taskCtx)
+	if err != nil {
+		t.log.Errorw("err", err)
+	}
+}
+
+// reload 配置热更新，更新用例配置并重置任务间隔
+func (t *ScheduledTask) reload(_, current *conf.Bootstrap) {
+	trackersChanged := t.uc.ApplyConfig(current)
+
+	stateRefreshInterval := time.Duration(t.uc.GetStateRefreshInterval()) * time.Second
+	if stateRefreshInterval > 0 && stateRefreshInterval != t.stateRefreshInterval {
+		t.stateRefreshInterval = stateRefreshInterval
+		t.statisticsTicker.Reset(stateRefreshInterval)
+	}
+
+	interval := transferRequestInterval(current)
+	if interval != t.transferRequestInterval {
+		t.log.Infof("配置已更新: infra.tr.transfer_request_interval %v -> %v",
+			t.transferRequestInterval, interval)
+		t.transferRequestInterval = interval
+		t.trackerTicker.Reset(interval)
+	}
+
+	// Tracker 配置变化后立即更新一次，不等待下一次触发
+	if trackersChanged {
+		go func() {
+			if !t.trackerFlight.Do(t.upTracker) {
+				t.log.Warnf("更新Tracker任务正在执行，新的Tracker配置将在下一次任务生效")
+			}
+		}()
+	}
+}
@@ -3,4 +3,4 @@ package trigger
 import "github.com/google/wire"
 
 // ProviderSet is server providers.
-var ProviderSet = wire.NewSet(NewHTTPServer, NewScheduledTask)
+var ProviderSet = wire.NewSet(NewAdminToken, NewMetricsRegistry, NewHTTPServer, NewGRPCServer, NewScheduledTask)